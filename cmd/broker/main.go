@@ -1,10 +1,12 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"lightkafka/internal/broker"
@@ -14,15 +16,29 @@ import (
 )
 
 func main() {
+	logDirs := flag.String("log-dirs", "./data", "comma-separated data directories, e.g. one per disk")
+	placement := flag.String("placement", partition.PlacementFewestPartitions, "log directory for new partitions: partitions or free-space")
+	timestampType := flag.String("message-timestamp-type", partition.TimestampTypeCreateTime, "record timestamps: CreateTime (producer) or LogAppendTime (broker)")
+	flag.Parse()
+
 	segConfig := segment.Config{
 		SegmentMaxBytes:    10 * 1024 * 1024, // 10MB per segment
 		IndexMaxBytes:      100 * 1024,       // 100KB index
-		BaseDir:            "./data",         // Data directory
 		IndexIntervalBytes: 4 * 1024,         // 4KB - index every 4KB of log data
+
+		FlushIntervalMessages: 10000, // msync at least every 10k records
 	}
 
 	partitionConfig := partition.PartitionConfig{
-		SegmentConfig: segConfig,
+		SegmentConfig:            segConfig,
+		SegmentMaxAgeMs:          7 * 24 * 60 * 60 * 1000, // roll at least weekly
+		RetentionMs:              7 * 24 * 60 * 60 * 1000, // 7 days
+		RetentionBytes:           1024 * 1024 * 1024,      // 1GB
+		RetentionCheckIntervalMs: 5 * 60 * 1000,           // 5 minutes
+		FlushIntervalMs:          1000,                    // background flush every second
+		MaxMessageBytes:          1024 * 1024,             // 1MB per produced batch
+		TimestampType:            *timestampType,
+		MaxTimestampDiffMs:       24 * 60 * 60 * 1000, // CreateTime must be within a day of broker time
 	}
 
 	listenAddr := ":9092" // Kafka Standard Port
@@ -31,12 +47,22 @@ func main() {
 	resCache := resource.NewSegmentCache(50)
 	defer resCache.Close()
 
+	// NOTE(Danu): 데이터 디렉토리마다 잠금을 잡고, 기존 파티션을 모든 디렉토리에서 찾아서 엶
+	// NOTE(Danu): 디스크 I/O 오류가 나면 해당 디렉토리의 파티션만 offline 처리됨
 	fmt.Println("[Init] Initializing Partition Storage...")
-	p, err := partition.NewPartition(segConfig.BaseDir, "events", 0, partitionConfig, resCache)
+	logs, err := partition.NewLogManager(partition.LogManagerConfig{
+		LogDirs:   strings.Split(*logDirs, ","),
+		Placement: *placement,
+	}, partitionConfig, resCache)
+	if err != nil {
+		log.Fatalf("Failed to open log directories: %v", err)
+	}
+	defer logs.Close()
+
+	p, err := logs.GetOrCreate("events", 0)
 	if err != nil {
 		log.Fatalf("Failed to initialize partition: %v", err)
 	}
-	defer p.Close()
 
 	brk := broker.NewBroker(broker.Config{ListenAddr: listenAddr}, p)
 
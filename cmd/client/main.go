@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"math/rand"
@@ -17,6 +18,9 @@ const (
 )
 
 func main() {
+	compression := flag.String("compression", "none", "레코드 압축 코덱 (none, gzip, snappy, lz4, zstd)")
+	flag.Parse()
+
 	// 랜덤 시드 설정
 	rand.Seed(time.Now().UnixNano())
 
@@ -52,12 +56,19 @@ func main() {
 
 		// 2. 배치 빌더를 사용하여 RecordBatch 생성
 		builder := client.NewRecordBatchBuilder()
+		if err := builder.SetCompression(*compression); err != nil {
+			log.Fatalf("Invalid compression: %v", err)
+		}
 		for i := 0; i < currentBatchSize; i++ {
 			msgNum := totalSent + i + 1
 			// Key와 Value 생성
 			key := []byte(fmt.Sprintf("k-%d", msgNum))
 			val := []byte(fmt.Sprintf("Hello LightKafka #%d", msgNum))
-			builder.Add(key, val)
+			// 라우팅용 헤더 (trace-id, tenant)
+			builder.Add(key, val,
+				message.Header{Key: []byte("trace-id"), Value: []byte(fmt.Sprintf("%016x", rand.Uint64()))},
+				message.Header{Key: []byte("tenant"), Value: []byte("test")},
+			)
 		}
 
 		batchBytes := builder.Build()
@@ -124,7 +135,7 @@ func main() {
 					fmt.Printf("    ... (skip %d records)\n", len(records)-3)
 					break
 				}
-				fmt.Printf("    [%d] Offset: %d | Key: %-5s | Value: %s\n", j, r.Offset, r.Key, r.Value)
+				fmt.Printf("    [%d] Offset: %d | Key: %-5s | Value: %s | Headers: %v\n", j, r.Offset, r.Key, r.Value, r.Headers)
 			}
 			fmt.Println("    --------------------------------")
 		}
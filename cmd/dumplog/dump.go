@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"lightkafka/internal/message"
+)
+
+const (
+	indexMagic          = "LKIX"
+	indexVersion        = 1
+	indexHeaderSize     = 8  // Magic(4) + Version(2) + Reserved(2)
+	indexEntryWidth     = 12 // RelativeOffset(4) + Position(8)
+	timeIndexEntryWidth = 12 // Timestamp(8) + RelativeOffset(4)
+)
+
+// Problem is a piece of corruption found in a file, located by byte position.
+type Problem struct {
+	File     string `json:"file"`
+	Position int64  `json:"position"`
+	Message  string `json:"message"`
+}
+
+type BatchInfo struct {
+	Position             int64        `json:"position"`
+	Size                 int64        `json:"size"`
+	BaseOffset           int64        `json:"baseOffset"`
+	LastOffset           int64        `json:"lastOffset"`
+	Count                int32        `json:"count"`
+	PartitionLeaderEpoch int32        `json:"partitionLeaderEpoch"`
+	Magic                int8         `json:"magic"`
+	CRC                  uint32       `json:"crc"`
+	CRCValid             bool         `json:"crcValid"`
+	Attributes           int16        `json:"attributes"`
+	Compression          string       `json:"compression"`
+	TimestampType        string       `json:"timestampType"`
+	BaseTimestamp        int64        `json:"baseTimestamp"`
+	MaxTimestamp         int64        `json:"maxTimestamp"`
+	ProducerId           int64        `json:"producerId"`
+	ProducerEpoch        int16        `json:"producerEpoch"`
+	BaseSequence         int32        `json:"baseSequence"`
+	Records              []RecordInfo `json:"records,omitempty"`
+}
+
+type RecordInfo struct {
+	Offset       int64    `json:"offset"`
+	Timestamp    int64    `json:"timestamp"`
+	KeySize      int      `json:"keySize"`
+	ValueSize    int      `json:"valueSize"`
+	HeadersCount int      `json:"headersCount"`
+	HeaderKeys   []string `json:"headerKeys,omitempty"`
+	Key          string   `json:"key,omitempty"`
+	Value        string   `json:"value,omitempty"`
+}
+
+// LogDump is the result of walking a .log file.
+type LogDump struct {
+	File       string      `json:"file"`
+	BaseOffset int64       `json:"baseOffset"`
+	ValidBytes int64       `json:"validBytes"` // End of the last well-formed batch
+	Batches    []BatchInfo `json:"batches"`
+	Problems   []Problem   `json:"problems"`
+}
+
+// IndexEntry is an offset index entry. Position is the entry's byte position in the index file.
+type IndexEntry struct {
+	Position         int64 `json:"position"`
+	Offset           int64 `json:"offset"`
+	PhysicalPosition int64 `json:"physicalPosition"`
+}
+
+type TimeIndexEntry struct {
+	Position  int64 `json:"position"`
+	Timestamp int64 `json:"timestamp"`
+	Offset    int64 `json:"offset"`
+}
+
+// IndexDump is the result of checking an .index or .timeindex file against its log.
+type IndexDump struct {
+	File        string           `json:"file"`
+	Entries     []IndexEntry     `json:"entries,omitempty"`
+	TimeEntries []TimeIndexEntry `json:"timeEntries,omitempty"`
+	Problems    []Problem        `json:"problems"`
+}
+
+type dumpOptions struct {
+	printRecords bool
+	printData    bool
+}
+
+// baseOffsetFromPath parses the segment base offset from "{%020d}.{suffix}".
+func baseOffsetFromPath(path string) (int64, error) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	base, err := strconv.ParseInt(name, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse base offset from file name %q", filepath.Base(path))
+	}
+	return base, nil
+}
+
+// dumpLog walks every batch of a log file, checking CRCs and offset order.
+// Walking stops at the first batch whose length cannot be trusted, or at the
+// zero-filled tail left by preallocation.
+func dumpLog(path string, opts dumpOptions) (*LogDump, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	base, err := baseOffsetFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &LogDump{File: path, BaseOffset: base, Batches: []BatchInfo{}, Problems: []Problem{}}
+	report := func(pos int64, format string, args ...any) {
+		d.Problems = append(d.Problems, Problem{File: path, Position: pos, Message: fmt.Sprintf(format, args...)})
+	}
+
+	pos := int64(0)
+	nextOffset := base
+	for pos < int64(len(data)) {
+		rest := data[pos:]
+		if isZero(rest) {
+			break // Preallocated space of an active segment
+		}
+		if len(rest) < message.BATCH_HEADER_SIZE {
+			report(pos, "truncated batch header: %d bytes left", len(rest))
+			break
+		}
+
+		h, err := message.DecodeHeader(rest)
+		if err != nil {
+			report(pos, "invalid batch header: %v", err)
+			break
+		}
+		size := 12 + int64(h.BatchLength)
+		if h.BatchLength < message.BATCH_HEADER_SIZE-12 || size > int64(len(rest)) {
+			report(pos, "batch length %d does not fit in the %d bytes left", h.BatchLength, len(rest))
+			break
+		}
+		batchData := rest[:size]
+
+		info := BatchInfo{
+			Position:             pos,
+			Size:                 size,
+			BaseOffset:           h.BaseOffset,
+			LastOffset:           h.BaseOffset + int64(h.LastOffsetDelta),
+			Count:                h.RecordsCount,
+			PartitionLeaderEpoch: h.PartitionLeaderEpoch,
+			Magic:                h.Magic,
+			CRC:                  h.CRC,
+			CRCValid:             true,
+			Attributes:           h.Attributes,
+			Compression:          h.Compression().String(),
+			TimestampType:        h.TimestampType().String(),
+			BaseTimestamp:        h.BaseTimestamp,
+			MaxTimestamp:         h.MaxTimestamp,
+			ProducerId:           h.ProducerId,
+			ProducerEpoch:        h.ProducerEpoch,
+			BaseSequence:         h.BaseSequence,
+		}
+
+		if _, err := message.DecodeBatch(batchData); errors.Is(err, message.ErrCRCMismatch) {
+			info.CRCValid = false
+			report(pos, "batch %d: %v", h.BaseOffset, err)
+		} else if err != nil {
+			report(pos, "batch %d: %v", h.BaseOffset, err)
+		}
+
+		if h.BaseOffset < nextOffset {
+			report(pos, "batch base offset %d is below the previous batch end %d", h.BaseOffset, nextOffset)
+		}
+		if h.LastOffsetDelta < 0 || h.RecordsCount < 0 {
+			report(pos, "batch %d: negative LastOffsetDelta (%d) or RecordsCount (%d)", h.BaseOffset, h.LastOffsetDelta, h.RecordsCount)
+		}
+
+		if opts.printRecords {
+			info.Records = dumpRecords(pos, batchData, h, opts, report)
+		}
+
+		d.Batches = append(d.Batches, info)
+		nextOffset = info.LastOffset + 1
+		pos += size
+		d.ValidBytes = pos
+	}
+
+	return d, nil
+}
+
+func dumpRecords(pos int64, batchData []byte, h message.BatchHeader, opts dumpOptions, report func(int64, string, ...any)) []RecordInfo {
+	batch := &message.RecordBatch{Header: h, Payload: batchData[message.BATCH_HEADER_SIZE:]}
+	records := []RecordInfo{}
+
+	var rec message.Record
+	it := batch.NewIterator()
+	for it.Next(&rec) {
+		info := RecordInfo{
+			Offset:       rec.Offset,
+			Timestamp:    rec.Timestamp,
+			KeySize:      len(rec.Key),
+			ValueSize:    len(rec.Value),
+			HeadersCount: rec.HeadersCount,
+		}
+		if rec.Key == nil {
+			info.KeySize = -1
+		}
+		if rec.Value == nil {
+			info.ValueSize = -1
+		}
+		if opts.printData {
+			info.Key, info.Value = string(rec.Key), string(rec.Value)
+		}
+		headers := rec.Headers()
+		for h, ok := headers.Next(); ok; h, ok = headers.Next() {
+			info.HeaderKeys = append(info.HeaderKeys, string(h.Key))
+		}
+		if len(info.HeaderKeys) != info.HeadersCount {
+			report(pos, "record %d: decoded %d of %d headers", rec.Offset, len(info.HeaderKeys), info.HeadersCount)
+		}
+		records = append(records, info)
+	}
+	if err := it.Err(); err != nil {
+		report(pos, "batch %d: %v", h.BaseOffset, err)
+		return records
+	}
+
+	if int32(len(records)) != h.RecordsCount {
+		report(pos, "batch %d: decoded %d of %d records", h.BaseOffset, len(records), h.RecordsCount)
+	}
+	return records
+}
+
+// dumpIndex reads an offset index and checks that every entry points at a batch
+// boundary of the log with the indexed offset, and that entries increase.
+func dumpIndex(path string, log *LogDump) (*IndexDump, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	d := &IndexDump{File: path, Problems: []Problem{}}
+	report := func(pos int64, format string, args ...any) {
+		d.Problems = append(d.Problems, Problem{File: path, Position: pos, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(data) == 0 {
+		return d, nil
+	}
+	if len(data) < indexHeaderSize || string(data[:4]) != indexMagic {
+		report(0, "missing index header (legacy format, rebuilt when the segment is opened)")
+		return d, nil
+	}
+	if version := binary.BigEndian.Uint16(data[4:]); version != indexVersion {
+		report(4, "unsupported index version %d", version)
+		return d, nil
+	}
+	entries := data[indexHeaderSize:]
+
+	// Preallocation may leave a zero-filled partial entry at the end
+	if tail := len(entries) / indexEntryWidth * indexEntryWidth; !isZero(entries[tail:]) {
+		report(int64(indexHeaderSize+tail), "trailing %d bytes are not a whole entry", len(entries)-tail)
+	}
+	// A preallocated, untrimmed index ends with zero entries ((0, 0) is valid only first)
+	n := len(entries) / indexEntryWidth
+	for n > 1 && isZero(entries[(n-1)*indexEntryWidth:n*indexEntryWidth]) {
+		n--
+	}
+
+	batches := batchesByPosition(log)
+	var prevOff int32 = -1
+	var prevPos int64 = -1
+	for i := 0; i < n; i++ {
+		entryPos := int64(indexHeaderSize + i*indexEntryWidth)
+		relOff := int32(binary.BigEndian.Uint32(data[entryPos:]))
+		physPos := int64(binary.BigEndian.Uint64(data[entryPos+4:]))
+		if i == 0 && relOff == 0 && physPos == 0 && len(log.Batches) == 0 {
+			break // Empty segment
+		}
+
+		offset := log.BaseOffset + int64(relOff)
+		d.Entries = append(d.Entries, IndexEntry{Position: entryPos, Offset: offset, PhysicalPosition: physPos})
+
+		if relOff <= prevOff {
+			report(entryPos, "offset %d does not increase (previous %d)", offset, log.BaseOffset+int64(prevOff))
+		}
+		if physPos <= prevPos {
+			report(entryPos, "position %d does not increase (previous %d)", physPos, prevPos)
+		}
+		prevOff, prevPos = relOff, physPos
+
+		batch, ok := batches[physPos]
+		switch {
+		case physPos >= log.ValidBytes:
+			report(entryPos, "offset %d points at position %d, past the end of valid log data (%d)", offset, physPos, log.ValidBytes)
+		case !ok:
+			report(entryPos, "offset %d points at position %d, which is not a batch boundary", offset, physPos)
+		case batch.BaseOffset != offset:
+			report(entryPos, "offset %d points at position %d, which holds batch %d", offset, physPos, batch.BaseOffset)
+		}
+	}
+
+	return d, nil
+}
+
+// dumpTimeIndex reads a time index and checks that timestamps increase and every
+// entry refers to the base offset of a batch in the log.
+func dumpTimeIndex(path string, log *LogDump) (*IndexDump, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	d := &IndexDump{File: path, Problems: []Problem{}}
+	report := func(pos int64, format string, args ...any) {
+		d.Problems = append(d.Problems, Problem{File: path, Position: pos, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// Preallocation may leave a zero-filled partial entry at the end
+	if tail := len(data) / timeIndexEntryWidth * timeIndexEntryWidth; !isZero(data[tail:]) {
+		report(int64(tail), "trailing %d bytes are not a whole entry", len(data)-tail)
+	}
+	n := len(data) / timeIndexEntryWidth
+	for n > 0 && isZero(data[(n-1)*timeIndexEntryWidth:n*timeIndexEntryWidth]) {
+		n--
+	}
+
+	batchOffsets := make(map[int64]bool, len(log.Batches))
+	for _, b := range log.Batches {
+		batchOffsets[b.BaseOffset] = true
+	}
+
+	prevTs, prevOff := int64(-1), int64(-1)
+	for i := 0; i < n; i++ {
+		entryPos := int64(i * timeIndexEntryWidth)
+		ts := int64(binary.BigEndian.Uint64(data[entryPos:]))
+		offset := log.BaseOffset + int64(int32(binary.BigEndian.Uint32(data[entryPos+8:])))
+		d.TimeEntries = append(d.TimeEntries, TimeIndexEntry{Position: entryPos, Timestamp: ts, Offset: offset})
+
+		if ts <= prevTs {
+			report(entryPos, "timestamp %d does not increase (previous %d)", ts, prevTs)
+		}
+		if offset < prevOff {
+			report(entryPos, "offset %d goes backwards (previous %d)", offset, prevOff)
+		}
+		if !batchOffsets[offset] {
+			report(entryPos, "offset %d is not the base offset of a batch in the log", offset)
+		}
+		prevTs, prevOff = ts, offset
+	}
+
+	return d, nil
+}
+
+func batchesByPosition(log *LogDump) map[int64]BatchInfo {
+	m := make(map[int64]BatchInfo, len(log.Batches))
+	for _, b := range log.Batches {
+		m[b.Position] = b
+	}
+	return m
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
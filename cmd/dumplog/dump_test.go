@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"lightkafka/internal/message"
+)
+
+// testSegment is three batches (offsets 0-2, 3-4, 5-8) and both of their indexes,
+// every batch indexed.
+type testSegment struct {
+	log       []byte
+	positions []int64 // Of each batch
+	index     []byte
+	timeIndex []byte
+}
+
+func newTestSegment() *testSegment {
+	s := &testSegment{index: []byte(indexMagic)}
+	s.index = binary.BigEndian.AppendUint16(s.index, indexVersion)
+	s.index = append(s.index, 0, 0)
+
+	base := int64(0)
+	for i, count := range []int32{3, 2, 4} {
+		var records []byte
+		for d := range count {
+			records = message.AppendRecord(records, &message.Record{OffsetDelta: d, Key: []byte("key"), Value: []byte("value")})
+		}
+		ts := int64(1000 * (i + 1))
+		batch := message.EncodeBatch(message.BatchHeader{
+			BaseOffset:      base,
+			LastOffsetDelta: count - 1,
+			BaseTimestamp:   ts,
+			MaxTimestamp:    ts,
+			RecordsCount:    count,
+		}, records)
+
+		pos := int64(len(s.log))
+		s.positions = append(s.positions, pos)
+		s.log = append(s.log, batch...)
+		s.index = binary.BigEndian.AppendUint32(s.index, uint32(base))
+		s.index = binary.BigEndian.AppendUint64(s.index, uint64(pos))
+		s.timeIndex = binary.BigEndian.AppendUint64(s.timeIndex, uint64(ts))
+		s.timeIndex = binary.BigEndian.AppendUint32(s.timeIndex, uint32(base))
+		base += int64(count)
+	}
+	return s
+}
+
+// writeFile writes data as the segment file with the given suffix and returns its path.
+func writeFile(t *testing.T, dir, suffix string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, "00000000000000000000"+suffix)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return path
+}
+
+// checkProblems fails unless problems is empty (want == "") or its first message contains want.
+func checkProblems(t *testing.T, name string, problems []Problem, want string) {
+	t.Helper()
+	switch {
+	case want == "" && len(problems) > 0:
+		t.Errorf("%s: unexpected problems: %+v", name, problems)
+	case want != "" && len(problems) == 0:
+		t.Errorf("%s: corruption not detected, want %q", name, want)
+	case want != "" && !strings.Contains(problems[0].Message, want):
+		t.Errorf("%s: want %q, got %+v", name, want, problems)
+	}
+}
+
+func TestDumpLog(t *testing.T) {
+	seg := newTestSegment()
+	end := int64(len(seg.log))
+
+	for name, tc := range map[string]struct {
+		corrupt    func(log []byte) []byte
+		want       string // Substring of the first problem, "" if the log is valid
+		validBytes int64
+		batches    int
+	}{
+		"valid": {func(log []byte) []byte { return log }, "", end, 3},
+		"zero-filled tail": {func(log []byte) []byte {
+			return append(log, make([]byte, 4096)...) // Preallocated space of an active segment
+		}, "", end, 3},
+		"truncated batch": {func(log []byte) []byte {
+			return log[:end-10]
+		}, "does not fit", seg.positions[2], 2},
+		"truncated header": {func(log []byte) []byte {
+			return log[:seg.positions[2]+30]
+		}, "truncated batch header", seg.positions[2], 2},
+		"bad trailing bytes": {func(log []byte) []byte {
+			return append(log, 0xde, 0xad, 0xbe, 0xef)
+		}, "truncated batch header", end, 3},
+		"crc mismatch": {func(log []byte) []byte {
+			log[seg.positions[2]-1]++ // Last byte of the second batch's last value
+			return log
+		}, "crc mismatch", end, 3},
+		"offset goes backwards": {func(log []byte) []byte {
+			binary.BigEndian.PutUint64(log[seg.positions[2]:], 1)
+			return log
+		}, "below the previous batch end", end, 3},
+	} {
+		path := writeFile(t, t.TempDir(), ".log", tc.corrupt(slices.Clone(seg.log)))
+
+		d, err := dumpLog(path, dumpOptions{printRecords: true})
+		if err != nil {
+			t.Fatalf("%s: dumpLog failed: %v", name, err)
+		}
+		checkProblems(t, name, d.Problems, tc.want)
+		if d.ValidBytes != tc.validBytes || len(d.Batches) != tc.batches {
+			t.Errorf("%s: want %d batches in %d valid bytes, got %d in %d", name, tc.batches, tc.validBytes, len(d.Batches), d.ValidBytes)
+		}
+	}
+}
+
+func TestDumpIndex(t *testing.T) {
+	seg := newTestSegment()
+	entry := func(i int) int { return indexHeaderSize + i*indexEntryWidth }
+
+	for name, tc := range map[string]struct {
+		corrupt func(index []byte) []byte
+		want    string
+	}{
+		"valid": {func(index []byte) []byte { return index }, ""},
+		"preallocated tail": {func(index []byte) []byte {
+			return append(index, make([]byte, 10*indexEntryWidth+5)...)
+		}, ""},
+		"offsets do not increase": {func(index []byte) []byte {
+			binary.BigEndian.PutUint32(index[entry(2):], 0)
+			return index
+		}, "does not increase"},
+		"positions do not increase": {func(index []byte) []byte {
+			binary.BigEndian.PutUint64(index[entry(2)+4:], uint64(seg.positions[1]))
+			return index
+		}, fmt.Sprintf("position %d does not increase", seg.positions[1])},
+		"mid-batch position": {func(index []byte) []byte {
+			binary.BigEndian.PutUint64(index[entry(1)+4:], uint64(seg.positions[1]+1))
+			return index
+		}, "not a batch boundary"},
+		"wrong batch": {func(index []byte) []byte {
+			binary.BigEndian.PutUint32(index[entry(1):], 4)
+			return index
+		}, "which holds batch 3"},
+		"past the log": {func(index []byte) []byte {
+			binary.BigEndian.PutUint64(index[entry(2)+4:], uint64(len(seg.log)))
+			return index
+		}, "past the end of valid log data"},
+		"bad trailing bytes": {func(index []byte) []byte {
+			return append(index, 1, 2, 3)
+		}, "trailing 3 bytes"},
+		"legacy format": {func(index []byte) []byte {
+			return index[indexHeaderSize:]
+		}, "missing index header"},
+	} {
+		dir := t.TempDir()
+		logPath := writeFile(t, dir, ".log", seg.log)
+		path := writeFile(t, dir, ".index", tc.corrupt(slices.Clone(seg.index)))
+
+		log, err := dumpLog(logPath, dumpOptions{})
+		if err != nil {
+			t.Fatalf("%s: dumpLog failed: %v", name, err)
+		}
+		d, err := dumpIndex(path, log)
+		if err != nil {
+			t.Fatalf("%s: dumpIndex failed: %v", name, err)
+		}
+		checkProblems(t, name, d.Problems, tc.want)
+	}
+}
+
+func TestDumpTimeIndex(t *testing.T) {
+	seg := newTestSegment()
+
+	for name, tc := range map[string]struct {
+		corrupt func(timeIndex []byte) []byte
+		want    string
+	}{
+		"valid": {func(timeIndex []byte) []byte { return timeIndex }, ""},
+		"preallocated tail": {func(timeIndex []byte) []byte {
+			return append(timeIndex, make([]byte, 10*timeIndexEntryWidth+5)...)
+		}, ""},
+		"timestamps do not increase": {func(timeIndex []byte) []byte {
+			binary.BigEndian.PutUint64(timeIndex[2*timeIndexEntryWidth:], 2000)
+			return timeIndex
+		}, "timestamp 2000 does not increase"},
+		"offsets go backwards": {func(timeIndex []byte) []byte {
+			binary.BigEndian.PutUint32(timeIndex[2*timeIndexEntryWidth+8:], 0)
+			return timeIndex
+		}, "goes backwards"},
+		"offset off a batch boundary": {func(timeIndex []byte) []byte {
+			binary.BigEndian.PutUint32(timeIndex[timeIndexEntryWidth+8:], 4)
+			return timeIndex
+		}, "not the base offset of a batch"},
+		"bad trailing bytes": {func(timeIndex []byte) []byte {
+			return append(timeIndex, 1, 2, 3)
+		}, "trailing 3 bytes"},
+	} {
+		dir := t.TempDir()
+		logPath := writeFile(t, dir, ".log", seg.log)
+		path := writeFile(t, dir, ".timeindex", tc.corrupt(slices.Clone(seg.timeIndex)))
+
+		log, err := dumpLog(logPath, dumpOptions{})
+		if err != nil {
+			t.Fatalf("%s: dumpLog failed: %v", name, err)
+		}
+		d, err := dumpTimeIndex(path, log)
+		if err != nil {
+			t.Fatalf("%s: dumpTimeIndex failed: %v", name, err)
+		}
+		checkProblems(t, name, d.Problems, tc.want)
+	}
+}
+
+func TestDumpFile_Text(t *testing.T) {
+	seg := newTestSegment()
+	dir := t.TempDir()
+	logPath := writeFile(t, dir, ".log", seg.log)
+	writeFile(t, dir, ".index", seg.index)
+	writeFile(t, dir, ".timeindex", append(slices.Clone(seg.timeIndex), 1))
+
+	var out bytes.Buffer
+	report := &Report{}
+	if err := dumpFile(report, logPath, dumpOptions{}, true, true, &out); err != nil {
+		t.Fatalf("dumpFile failed: %v", err)
+	}
+	if report.Problems != 1 || len(report.Logs) != 1 || len(report.Indexes) != 2 {
+		t.Errorf("Report mismatch: %d problems, %d logs, %d indexes", report.Problems, len(report.Logs), len(report.Indexes))
+	}
+	if !strings.Contains(out.String(), "Found 1 problem(s)") {
+		t.Errorf("Problem not printed:\n%s", out.String())
+	}
+}
@@ -0,0 +1,206 @@
+// Command dumplog prints and verifies segment files written by segment.Segment,
+// like Kafka's DumpLogSegments.
+//
+//	dumplog [-format text|json] [-print-records] [-print-data] [-verify-index=false] FILE...
+//
+// FILE is a .log, .index or .timeindex file. Index files are checked against the .log
+// next to them; for a .log file both of its indexes are checked unless -verify-index=false.
+// The exit status is 1 if any corruption was found.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"lightkafka/internal/segment"
+)
+
+// Report is the JSON output of a run.
+type Report struct {
+	Logs     []*LogDump   `json:"logs"`
+	Indexes  []*IndexDump `json:"indexes"`
+	Problems int          `json:"problems"`
+}
+
+func main() {
+	format := flag.String("format", "text", "output format: text or json")
+	printRecords := flag.Bool("print-records", false, "print every record of every batch")
+	printData := flag.Bool("print-data", false, "print record keys and values (implies -print-records)")
+	verifyIndex := flag.Bool("verify-index", true, "check the indexes of each .log file")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] FILE...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 || (*format != "text" && *format != "json") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts := dumpOptions{printRecords: *printRecords || *printData, printData: *printData}
+	out := os.Stdout
+
+	report := &Report{Logs: []*LogDump{}, Indexes: []*IndexDump{}}
+	for _, path := range flag.Args() {
+		if err := dumpFile(report, path, opts, *verifyIndex, *format == "text", out); err != nil {
+			fmt.Fprintf(os.Stderr, "dumplog: %s: %v\n", path, err)
+			os.Exit(2)
+		}
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			fmt.Fprintf(os.Stderr, "dumplog: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	if report.Problems > 0 {
+		os.Exit(1)
+	}
+}
+
+// dumpFile dumps one file into report, printing it as text right away if text is set.
+func dumpFile(report *Report, path string, opts dumpOptions, verifyIndex, text bool, out io.Writer) error {
+	ext := filepath.Ext(path)
+	logPath := strings.TrimSuffix(path, ext) + segment.LogFileSuffix
+
+	switch ext {
+	case segment.LogFileSuffix:
+		log, err := dumpLog(path, opts)
+		if err != nil {
+			return err
+		}
+		report.add(log)
+		if text {
+			printLog(out, log, opts)
+		}
+
+		if !verifyIndex {
+			return nil
+		}
+		for _, suffix := range []string{segment.IndexFileSuffix, segment.TimeIndexFileSuffix} {
+			indexPath := strings.TrimSuffix(path, ext) + suffix
+			if _, err := os.Stat(indexPath); os.IsNotExist(err) {
+				continue
+			}
+			idx, err := dumpIndexFile(indexPath, log)
+			if err != nil {
+				return err
+			}
+			report.addIndex(idx)
+			if text {
+				printIndex(out, idx, false)
+			}
+		}
+		return nil
+
+	case segment.IndexFileSuffix, segment.TimeIndexFileSuffix:
+		log, err := dumpLog(logPath, dumpOptions{})
+		if err != nil {
+			return fmt.Errorf("reading log for index: %w", err)
+		}
+		idx, err := dumpIndexFile(path, log)
+		if err != nil {
+			return err
+		}
+		report.addIndex(idx)
+		if text {
+			printIndex(out, idx, true)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown file type %q (want %s, %s or %s)", ext,
+			segment.LogFileSuffix, segment.IndexFileSuffix, segment.TimeIndexFileSuffix)
+	}
+}
+
+func dumpIndexFile(path string, log *LogDump) (*IndexDump, error) {
+	if filepath.Ext(path) == segment.TimeIndexFileSuffix {
+		return dumpTimeIndex(path, log)
+	}
+	return dumpIndex(path, log)
+}
+
+func (r *Report) add(log *LogDump) {
+	r.Logs = append(r.Logs, log)
+	r.Problems += len(log.Problems)
+}
+
+func (r *Report) addIndex(idx *IndexDump) {
+	r.Indexes = append(r.Indexes, idx)
+	r.Problems += len(idx.Problems)
+}
+
+func printLog(out io.Writer, log *LogDump, opts dumpOptions) {
+	fmt.Fprintf(out, "Dumping %s\n", log.File)
+	fmt.Fprintf(out, "Starting offset: %d\n", log.BaseOffset)
+
+	for _, b := range log.Batches {
+		fmt.Fprintf(out,
+			"baseOffset: %d lastOffset: %d count: %d position: %d size: %d magic: %d attributes: %d compresscodec: %s crc: %d isValid: %v "+
+				"timestampType: %s baseTimestamp: %s maxTimestamp: %s producerId: %d producerEpoch: %d baseSequence: %d partitionLeaderEpoch: %d\n",
+			b.BaseOffset, b.LastOffset, b.Count, b.Position, b.Size, b.Magic, b.Attributes, b.Compression, b.CRC, b.CRCValid,
+			b.TimestampType, formatTimestamp(b.BaseTimestamp), formatTimestamp(b.MaxTimestamp),
+			b.ProducerId, b.ProducerEpoch, b.BaseSequence, b.PartitionLeaderEpoch)
+
+		for _, r := range b.Records {
+			fmt.Fprintf(out, "| offset: %d timestamp: %s keySize: %d valueSize: %d headers: %d",
+				r.Offset, formatTimestamp(r.Timestamp), r.KeySize, r.ValueSize, r.HeadersCount)
+			if len(r.HeaderKeys) > 0 {
+				fmt.Fprintf(out, " headerKeys: [%s]", strings.Join(r.HeaderKeys, ","))
+			}
+			if opts.printData {
+				fmt.Fprintf(out, " key: %q value: %q", r.Key, r.Value)
+			}
+			fmt.Fprintln(out)
+		}
+	}
+
+	fmt.Fprintf(out, "Valid bytes: %d, batches: %d\n", log.ValidBytes, len(log.Batches))
+	printProblems(out, log.Problems)
+}
+
+func printIndex(out io.Writer, idx *IndexDump, entries bool) {
+	fmt.Fprintf(out, "Dumping %s\n", idx.File)
+	if entries {
+		for _, e := range idx.Entries {
+			fmt.Fprintf(out, "offset: %d position: %d\n", e.Offset, e.PhysicalPosition)
+		}
+		for _, e := range idx.TimeEntries {
+			fmt.Fprintf(out, "timestamp: %s offset: %d\n", formatTimestamp(e.Timestamp), e.Offset)
+		}
+	}
+	fmt.Fprintf(out, "Entries: %d\n", len(idx.Entries)+len(idx.TimeEntries))
+	printProblems(out, idx.Problems)
+}
+
+func printProblems(out io.Writer, problems []Problem) {
+	if len(problems) == 0 {
+		fmt.Fprintln(out, "No corruption found")
+		fmt.Fprintln(out)
+		return
+	}
+	fmt.Fprintf(out, "Found %d problem(s):\n", len(problems))
+	for _, p := range problems {
+		fmt.Fprintf(out, "  position %d: %s\n", p.Position, p.Message)
+	}
+	fmt.Fprintln(out)
+}
+
+func formatTimestamp(ts int64) string {
+	if ts < 0 {
+		return fmt.Sprintf("%d", ts)
+	}
+	return fmt.Sprintf("%d (%s)", ts, time.UnixMilli(ts).UTC().Format(time.RFC3339Nano))
+}
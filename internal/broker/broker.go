@@ -82,13 +82,23 @@ func (b *Broker) handleConnection(conn net.Conn) {
 			// NOTE(Danu): 요청 처리 후 메모리 반납
 			defer req.Release()
 
-			respBody, handleErr := b.handleRequest(req)
+			resp, handleErr := b.handleRequest(req)
 			if handleErr != nil {
 				fmt.Printf("[Broker] Handler Error: %v\n", handleErr)
 				return handleErr
 			}
 
-			return protocol.SendResponse(conn, req.Header.CorrelationID, respBody)
+			// NOTE(Danu): Fetch 응답은 body(Error Code) 뒤의 Records를 sendfile로 세그먼트 파일에서 소켓으로 직접 전송 후 반납
+			// 파일이 없는 저장소(memory)의 view는 Data를 그대로 전송
+			if resp.view != nil {
+				defer resp.view.Release()
+				if resp.view.File == nil {
+					return protocol.SendResponse(conn, req.Header.CorrelationID, resp.body, resp.view.Data)
+				}
+				return protocol.SendFileResponse(conn, req.Header.CorrelationID, resp.body, resp.view.File, resp.view.Position, resp.view.Length)
+			}
+
+			return protocol.SendResponse(conn, req.Header.CorrelationID, resp.body)
 		}()
 
 		if err != nil {
@@ -2,63 +2,184 @@ package broker
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 
+	"lightkafka/internal/message"
 	"lightkafka/internal/protocol"
+	"lightkafka/internal/resource"
+	"lightkafka/internal/segment"
 )
 
 const (
-	PRODUCE_RESPONSE_BODY_SIZE = 8 //NOTE(Danu): OFFSET의 크기는 8바이트
+	FETCH_REQUEST_BODY_SIZE  = 12 //NOTE(Danu): OFFSET(8) + MAX_BYTES(4)
+	FETCH_RESPONSE_HEAD_SIZE = 2  //NOTE(Danu): ERROR_CODE(2), 뒤에 RecordBatch들이 이어짐
 
-	FETCH_REQUEST_BODY_SIZE = 12 //NOTE(Danu): OFFSET(8) + MAX_BYTES(4)
+	LIST_OFFSETS_REQUEST_BODY_SIZE  = 8  //NOTE(Danu): TIMESTAMP(8)
+	LIST_OFFSETS_RESPONSE_BODY_SIZE = 10 //NOTE(Danu): ERROR_CODE(2) + OFFSET(8)
+
+	DELETE_RECORDS_REQUEST_BODY_SIZE  = 8  //NOTE(Danu): OFFSET(8)
+	DELETE_RECORDS_RESPONSE_BODY_SIZE = 10 //NOTE(Danu): ERROR_CODE(2) + LOW_WATERMARK(8)
 )
 
-func (b *Broker) handleRequest(req *protocol.Request) ([]byte, error) {
+// response is a handler result. Fetch responses carry a segment view after the body:
+// it is sent with sendfile and must be released after the write.
+type response struct {
+	body []byte
+	view *segment.View
+}
+
+func (b *Broker) handleRequest(req *protocol.Request) (response, error) {
+	var resp response
+	var err error
+
 	switch req.Header.ApiKey {
 	case protocol.ApiKeyProduce:
-		return b.handleProduce(req)
+		resp.body, err = b.handleProduce(req)
 	case protocol.ApiKeyFetch:
-		return b.handleFetch(req)
+		resp.body, resp.view, err = b.handleFetch(req)
+	case protocol.ApiKeyListOffsets:
+		resp.body, err = b.handleListOffsets(req)
+	case protocol.ApiKeyDeleteRecords:
+		resp.body, err = b.handleDeleteRecords(req)
 	default:
-		return nil, fmt.Errorf("unknown api key: %d", req.Header.ApiKey)
+		err = fmt.Errorf("unknown api key: %d", req.Header.ApiKey)
 	}
+	return resp, err
 }
 
 func (b *Broker) handleProduce(req *protocol.Request) ([]byte, error) {
 
 	//NOTE(Danu): Bytepool에 할당된 메모리가 바로  mmap으로 복사됨
 	offset, err := b.Partition.Append(req.Body)
+
+	// NOTE(Danu): Append 실패는 연결을 끊지 않고 Error Code로 Producer에게 알림 (OFFSET은 -1)
+	// NOTE(Danu): 잘못된 레코드는 배치 내 위치(RECORD_INDEX)와 사유(ERROR_MESSAGE)도 함께 보냄 (해당 없으면 -1)
+	resp := protocol.ProduceResponse{ErrorCode: protocol.ErrorNone, Offset: offset, RecordIndex: -1}
 	if err != nil {
-		return nil, err
+		fmt.Printf("[Broker] Produce error: %v\n", err)
+		resp.ErrorCode = errorCode(err)
+		resp.Offset = -1
+		var recErr *message.RecordError
+		if errors.As(err, &recErr) {
+			resp.RecordIndex = int32(recErr.Index)
+		}
+		resp.ErrorMessage = err.Error()
 	}
 
-	// NOTE(Danu): OFFSET의 크기는 8바이트
-	resp := make([]byte, PRODUCE_RESPONSE_BODY_SIZE)
-	binary.BigEndian.PutUint64(resp, uint64(offset))
+	return resp.Encode(), nil
+}
 
-	return resp, nil
+// errorCode maps a partition error to the error code sent to the client.
+// Disk errors, a full disk and an offline log directory are all KAFKA_STORAGE_ERROR.
+// Batches that cannot be decoded are the producer's fault and are not retried as-is.
+func errorCode(err error) protocol.ErrorCode {
+	switch {
+	case errors.Is(err, segment.ErrOffsetOutOfRange):
+		return protocol.ErrorOffsetOutOfRange
+	case errors.Is(err, message.ErrUnsupportedCompression):
+		return protocol.ErrorUnsupportedCompressionType
+	case errors.Is(err, message.ErrInvalidTimestamp):
+		return protocol.ErrorInvalidTimestamp
+	case errors.Is(err, message.ErrRecordTooLarge):
+		return protocol.ErrorMessageTooLarge
+	case errors.Is(err, message.ErrInvalidRecord):
+		return protocol.ErrorInvalidRecord
+	case errors.Is(err, message.ErrInsufficientData),
+		errors.Is(err, message.ErrInvalidMagic),
+		errors.Is(err, message.ErrCRCMismatch),
+		errors.Is(err, message.ErrCorruptCompressed):
+		return protocol.ErrorCorruptMessage
+	case errors.Is(err, segment.ErrStorage),
+		errors.Is(err, resource.ErrLogDirOffline),
+		errors.Is(err, resource.ErrInsufficientSpace):
+		return protocol.ErrorKafkaStorageError
+	default:
+		return protocol.ErrorUnknownServerError
+	}
 }
 
-func (b *Broker) handleFetch(req *protocol.Request) ([]byte, error) {
+func (b *Broker) handleFetch(req *protocol.Request) ([]byte, *segment.View, error) {
 
 	if len(req.Body) < FETCH_REQUEST_BODY_SIZE {
-		return nil, fmt.Errorf("invalid fetch body size")
+		return nil, nil, fmt.Errorf("invalid fetch body size")
 	}
 
 	fetchOffset := int64(binary.BigEndian.Uint64(req.Body[0:8]))
 	maxBytes := int32(binary.BigEndian.Uint32(req.Body[8:12]))
 
-	// NOTE(Danu): mmap pointer를 반환하여 메모리에 매핑된 데이터를 읽음
-	data, err := b.Partition.Read(fetchOffset, maxBytes)
+	// NOTE(Danu): 데이터를 복사하지 않고 세그먼트 파일의 위치(File, Position, Length)만 반환
+	// NOTE(Danu): View가 Release될 때까지 세그먼트가 Unmap/Close되지 않음 (Cache Eviction 보호)
+	// NOTE(Danu): Read 실패는 연결을 끊지 않고 Error Code로 Consumer에게 알림 (Log Start Offset 이전이면 OFFSET_OUT_OF_RANGE)
+	head := make([]byte, FETCH_RESPONSE_HEAD_SIZE)
+	view, err := b.Partition.Read(fetchOffset, maxBytes)
 	if err != nil {
-
 		fmt.Printf("[Broker] Read error (offset %d): %v\n", fetchOffset, err)
-		return []byte{}, nil
+		binary.BigEndian.PutUint16(head, uint16(errorCode(err)))
+		return head, nil, nil
 	}
 
-	if data == nil {
-		return []byte{}, nil
+	// NOTE(Danu): view가 nil이면 Records 없는 빈 응답
+	return head, view, nil
+}
+
+func (b *Broker) handleListOffsets(req *protocol.Request) ([]byte, error) {
+
+	if len(req.Body) < LIST_OFFSETS_REQUEST_BODY_SIZE {
+		return nil, fmt.Errorf("invalid list offsets body size")
 	}
 
-	return data, nil
+	timestamp := int64(binary.BigEndian.Uint64(req.Body[0:8]))
+
+	// NOTE(Danu): 조회 실패는 연결을 끊지 않고 Error Code로 알림 (OFFSET은 -1)
+	code := protocol.ErrorNone
+	var offset int64
+	switch timestamp {
+	case protocol.LATEST_TIMESTAMP:
+		offset = b.Partition.LogEndOffset()
+	case protocol.EARLIEST_TIMESTAMP:
+		offset = b.Partition.LogStartOffset()
+	default:
+		var err error
+		offset, err = b.Partition.OffsetForTimestamp(timestamp)
+		if err != nil {
+			fmt.Printf("[Broker] List offsets error (timestamp %d): %v\n", timestamp, err)
+			code = errorCode(err)
+			offset = -1
+		}
+	}
+
+	resp := make([]byte, LIST_OFFSETS_RESPONSE_BODY_SIZE)
+	binary.BigEndian.PutUint16(resp[0:2], uint16(code))
+	binary.BigEndian.PutUint64(resp[2:10], uint64(offset))
+
+	return resp, nil
+}
+
+func (b *Broker) handleDeleteRecords(req *protocol.Request) ([]byte, error) {
+
+	if len(req.Body) < DELETE_RECORDS_REQUEST_BODY_SIZE {
+		return nil, fmt.Errorf("invalid delete records body size")
+	}
+
+	// NOTE(Danu): LATEST_TIMESTAMP(-1)은 Kafka와 동일하게 High Watermark(LEO)까지 삭제
+	offset := int64(binary.BigEndian.Uint64(req.Body[0:8]))
+	if offset == protocol.LATEST_TIMESTAMP {
+		offset = b.Partition.LogEndOffset()
+	}
+
+	// NOTE(Danu): 실패는 연결을 끊지 않고 Error Code로 알림 (LOW_WATERMARK는 -1)
+	lowWatermark, err := b.Partition.DeleteRecordsBefore(offset)
+	code := protocol.ErrorNone
+	if err != nil {
+		fmt.Printf("[Broker] Delete records error (offset %d): %v\n", offset, err)
+		code = errorCode(err)
+		lowWatermark = -1
+	}
+
+	resp := make([]byte, DELETE_RECORDS_RESPONSE_BODY_SIZE)
+	binary.BigEndian.PutUint16(resp[0:2], uint16(code))
+	binary.BigEndian.PutUint64(resp[2:10], uint64(lowWatermark))
+
+	return resp, nil
 }
@@ -4,17 +4,21 @@ import (
 	"encoding/binary"
 	"hash/crc32"
 	"time"
+
+	"lightkafka/internal/message"
 )
 
 // RecordBatchBuilder helps constructing a valid Kafka RecordBatch (v2).
 type RecordBatchBuilder struct {
 	records        []simpleRecord
 	firstTimestamp int64
+	compression    message.CompressionCodec
 }
 
 type simpleRecord struct {
-	key   []byte
-	value []byte
+	key     []byte
+	value   []byte
+	headers []message.Header
 }
 
 func NewRecordBatchBuilder() *RecordBatchBuilder {
@@ -24,9 +28,20 @@ func NewRecordBatchBuilder() *RecordBatchBuilder {
 	}
 }
 
-// Add appends a key-value record to the batch.
-func (b *RecordBatchBuilder) Add(key, value []byte) {
-	b.records = append(b.records, simpleRecord{key: key, value: value})
+// Add appends a key-value record with optional headers to the batch.
+func (b *RecordBatchBuilder) Add(key, value []byte, headers ...message.Header) {
+	b.records = append(b.records, simpleRecord{key: key, value: value, headers: headers})
+}
+
+// SetCompression sets the codec (compression.type) the records are compressed with,
+// e.g. "zstd". The default is "none".
+func (b *RecordBatchBuilder) SetCompression(name string) error {
+	codec, err := message.ParseCompressionCodec(name)
+	if err != nil {
+		return err
+	}
+	b.compression = codec
+	return nil
 }
 
 // Build encodes the batch into raw bytes ready to be sent to the broker.
@@ -38,9 +53,13 @@ func (b *RecordBatchBuilder) Build() []byte {
 	baseTimestamp := b.firstTimestamp
 
 	for i, r := range b.records {
-		recordsBuf = append(recordsBuf, encodeRecord(i, baseTimestamp, r.key, r.value)...)
+		recordsBuf = append(recordsBuf, encodeRecord(i, baseTimestamp, r.key, r.value, r.headers)...)
 	}
 
+	// 압축은 레코드 영역에만 적용 (헤더 61바이트는 항상 평문)
+	// SetCompression이 지원하는 코덱만 받으므로 Compress는 실패하지 않음
+	recordsBuf, _ = message.Compress(b.compression, recordsBuf)
+
 	// 2. Prepare Header (61 bytes)
 	header := make([]byte, 61)
 
@@ -61,8 +80,8 @@ func (b *RecordBatchBuilder) Build() []byte {
 
 	// [Offset 17-20] CRC (Will fill later)
 
-	// [Offset 21-22] Attributes (0)
-	binary.BigEndian.PutUint16(header[21:23], 0)
+	// [Offset 21-22] Attributes (Compression codec in bits 0~2)
+	binary.BigEndian.PutUint16(header[21:23], uint16(b.compression))
 
 	// [Offset 23-26] LastOffsetDelta
 	binary.BigEndian.PutUint32(header[23:27], uint32(len(b.records)-1))
@@ -96,8 +115,8 @@ func (b *RecordBatchBuilder) Build() []byte {
 }
 
 // encodeRecord encodes a single record into Kafka v2 format.
-// Format: [Length(varint)] [Attributes(1)] [TimestampDelta(varint)] [OffsetDelta(varint)] [KeyLen(varint)] [Key] [ValLen(varint)] [Value] [Headers(varint)]
-func encodeRecord(deltaOffset int, baseTimestamp int64, key, value []byte) []byte {
+// Format: [Length(varint)] [Attributes(1)] [TimestampDelta(varint)] [OffsetDelta(varint)] [KeyLen(varint)] [Key] [ValLen(varint)] [Value] [Headers(varint)] [Header...]
+func encodeRecord(deltaOffset int, baseTimestamp int64, key, value []byte, headers []message.Header) []byte {
 	// Body Buffer
 	var body []byte
 	var buf [10]byte // varint buffer
@@ -133,9 +152,12 @@ func encodeRecord(deltaOffset int, baseTimestamp int64, key, value []byte) []byt
 		body = append(body, value...)
 	}
 
-	// Headers Count (0)
-	n = binary.PutVarint(buf[:], 0)
+	// Headers Count & Headers ([KeyLen(varint)] [Key] [ValLen(varint)] [Value] 반복)
+	n = binary.PutVarint(buf[:], int64(len(headers)))
 	body = append(body, buf[:n]...)
+	for _, h := range headers {
+		body = message.AppendHeader(body, h)
+	}
 
 	// Total Record Length (varint) + Body
 	recLen := int64(len(body))
@@ -48,21 +48,51 @@ func (c *Client) Produce(batch *message.RecordBatch) (int64, error) {
 		return 0, err
 	}
 
-	// 3. Read Response (Offset 8 bytes)
+	// 3. Read Response: protocol.ProduceResponse
 	respBody, err := c.readResponse()
 	if err != nil {
 		return 0, err
 	}
 
-	if len(respBody) < 8 {
-		return 0, fmt.Errorf("invalid response size: %d", len(respBody))
+	resp, err := protocol.DecodeProduceResponse(respBody)
+	if err != nil {
+		return 0, err
+	}
+	if resp.ErrorCode != protocol.ErrorNone {
+		return 0, &ProduceError{
+			Code:        resp.ErrorCode,
+			RecordIndex: int(resp.RecordIndex),
+			Message:     resp.ErrorMessage,
+		}
 	}
+	return resp.Offset, nil
+}
 
-	offset := int64(binary.BigEndian.Uint64(respBody))
-	return offset, nil
+// ProduceError is a batch rejected by the broker. errors.Is matches its Code,
+// e.g. errors.Is(err, protocol.ErrorInvalidRecord).
+type ProduceError struct {
+	Code        protocol.ErrorCode
+	RecordIndex int    // Position of the invalid record in the batch, -1 if not a single record
+	Message     string // Broker's reason, may be empty
 }
 
-// Fetch requests data from the broker.
+func (e *ProduceError) Error() string {
+	msg := fmt.Sprintf("produce failed: %v", e.Code)
+	if e.RecordIndex >= 0 {
+		msg += fmt.Sprintf(" (record %d)", e.RecordIndex)
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+func (e *ProduceError) Unwrap() error {
+	return e.Code
+}
+
+// Fetch requests data from the broker. A broker error code is returned as an error
+// that errors.Is matches, e.g. errors.Is(err, protocol.ErrorOffsetOutOfRange).
 func (c *Client) Fetch(offset int64, maxBytes int32) ([]byte, error) {
 	// 1. Prepare Request Body: [Offset(8)] + [MaxBytes(4)]
 	reqBody := make([]byte, 12)
@@ -74,8 +104,75 @@ func (c *Client) Fetch(offset int64, maxBytes int32) ([]byte, error) {
 		return nil, err
 	}
 
-	// 3. Read Response (Raw RecordBatch Data)
-	return c.readResponse()
+	// 3. Read Response: [ErrorCode(2)] + [Raw RecordBatch Data]
+	respBody, err := c.readResponse()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(respBody) < 2 {
+		return nil, fmt.Errorf("invalid response size: %d", len(respBody))
+	}
+	if code := protocol.ErrorCode(binary.BigEndian.Uint16(respBody[0:2])); code != protocol.ErrorNone {
+		return nil, fmt.Errorf("fetch failed: %w", code)
+	}
+
+	return respBody[2:], nil
+}
+
+// ListOffset returns the first offset whose timestamp is >= timestamp.
+// protocol.LATEST_TIMESTAMP and protocol.EARLIEST_TIMESTAMP query the log boundaries.
+func (c *Client) ListOffset(timestamp int64) (int64, error) {
+	// 1. Prepare Request Body: [Timestamp(8)]
+	reqBody := make([]byte, 8)
+	binary.BigEndian.PutUint64(reqBody, uint64(timestamp))
+
+	// 2. Send Request
+	if err := c.sendRequest(protocol.ApiKeyListOffsets, reqBody); err != nil {
+		return 0, err
+	}
+
+	// 3. Read Response: [ErrorCode(2)] + [Offset(8)]
+	respBody, err := c.readResponse()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(respBody) < 10 {
+		return 0, fmt.Errorf("invalid response size: %d", len(respBody))
+	}
+	if code := protocol.ErrorCode(binary.BigEndian.Uint16(respBody[0:2])); code != protocol.ErrorNone {
+		return 0, fmt.Errorf("list offsets failed: %w", code)
+	}
+
+	return int64(binary.BigEndian.Uint64(respBody[2:10])), nil
+}
+
+// DeleteRecords deletes every record before offset and returns the new low watermark.
+func (c *Client) DeleteRecords(offset int64) (int64, error) {
+	// 1. Prepare Request Body: [Offset(8)]
+	reqBody := make([]byte, 8)
+	binary.BigEndian.PutUint64(reqBody, uint64(offset))
+
+	// 2. Send Request
+	if err := c.sendRequest(protocol.ApiKeyDeleteRecords, reqBody); err != nil {
+		return 0, err
+	}
+
+	// 3. Read Response: [ErrorCode(2)] + [LowWatermark(8)]
+	respBody, err := c.readResponse()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(respBody) < 10 {
+		return 0, fmt.Errorf("invalid response size: %d", len(respBody))
+	}
+	if code := protocol.ErrorCode(binary.BigEndian.Uint16(respBody[0:2])); code != protocol.ErrorNone {
+		return 0, fmt.Errorf("delete records failed: %w", code)
+	}
+
+	return int64(binary.BigEndian.Uint64(respBody[2:10])), nil
 }
 
 // sendRequest encodes and writes the request packet.
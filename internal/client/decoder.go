@@ -3,13 +3,22 @@ package client
 import (
 	"encoding/binary"
 	"fmt"
+
+	"lightkafka/internal/message"
 )
 
 // ParsedRecord is a human-readable representation of a Kafka record.
 type ParsedRecord struct {
-	Offset int64
-	Key    string
-	Value  string
+	Offset  int64
+	Key     string
+	Value   string
+	Headers []ParsedHeader
+}
+
+// ParsedHeader is a record header, e.g. a trace id.
+type ParsedHeader struct {
+	Key   string
+	Value string
 }
 
 // DecodeBatch parses the raw bytes of a RecordBatch and returns individual records.
@@ -21,16 +30,24 @@ func DecodeBatch(data []byte) ([]ParsedRecord, error) {
 	// 1. Parse Batch Header
 	baseOffset := int64(binary.BigEndian.Uint64(data[0:8]))
 	batchLength := int32(binary.BigEndian.Uint32(data[8:12]))
+	attributes := int16(binary.BigEndian.Uint16(data[21:23]))
 	recordsCount := int32(binary.BigEndian.Uint32(data[57:61]))
 
 	// Validation
-	if int(batchLength)+12 > len(data) {
+	if int(batchLength)+12 > len(data) || int(batchLength)+12 < 61 {
 		return nil, fmt.Errorf("batch length mismatch")
 	}
 
-	// 2. Parse Records
-	// Records start at offset 61
-	offset := 61
+	// 2. Decompress Records
+	// Records start at offset 61 and end with the batch
+	codec := message.BatchHeader{Attributes: attributes}.Compression()
+	data, err := message.Decompress(codec, data[61:12+int(batchLength)])
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. Parse Records
+	offset := 0
 	var records []ParsedRecord
 
 	for i := 0; i < int(recordsCount); i++ {
@@ -57,45 +74,62 @@ func DecodeBatch(data []byte) ([]ParsedRecord, error) {
 		offsetDelta, n := binary.Varint(data[offset:])
 		offset += n
 
-		// [Key Length] (varint)
-		keyLen, n := binary.Varint(data[offset:])
-		offset += n
+		// [Key Length] (varint) + [Key]
+		var key, value []byte
+		if key, offset, err = readField(data, offset); err != nil {
+			return nil, err
+		}
 
-		var key string
-		if keyLen >= 0 {
-			key = string(data[offset : offset+int(keyLen)])
-			offset += int(keyLen)
+		// [Value Length] (varint) + [Value]
+		if value, offset, err = readField(data, offset); err != nil {
+			return nil, err
 		}
 
-		// [Value Length] (varint)
-		valLen, n := binary.Varint(data[offset:])
+		// [Headers] (varint count) + [KeyLen][Key][ValLen][Value] 반복
+		headersCount, n := binary.Varint(data[offset:])
 		offset += n
 
-		var value string
-		if valLen >= 0 {
-			value = string(data[offset : offset+int(valLen)])
-			offset += int(valLen)
+		var headers []ParsedHeader
+		for j := 0; j < int(headersCount); j++ {
+			var hKey, hValue []byte
+			if hKey, offset, err = readField(data, offset); err != nil {
+				return nil, err
+			}
+			if hValue, offset, err = readField(data, offset); err != nil {
+				return nil, err
+			}
+			headers = append(headers, ParsedHeader{Key: string(hKey), Value: string(hValue)})
 		}
 
-		// [Headers] (varint count) - Skip for now
-		// headersCount, n := binary.Varint(data[offset:])
-		// offset += n
-
-		// 실제로는 여기서 헤더 루프를 돌아야 하지만,
-		// 우리가 만든 Builder는 헤더를 0개 넣으므로 일단 무시하거나
-		// 다음 레코드 위치를 정확히 찾기 위해 `recLen`을 이용해 점프하는 게 안전함.
-
-		// 안전한 다음 레코드 위치 계산:
-		// 현재 레코드의 끝 = startPos + recLen
+		// 다음 레코드 위치는 recLen 기준으로 계산 (현재 레코드의 끝 = startPos + recLen)
 		nextRecordPos := startPos + int(recLen)
 		offset = nextRecordPos
 
 		records = append(records, ParsedRecord{
-			Offset: baseOffset + offsetDelta, // 절대 오프셋 계산
-			Key:    key,
-			Value:  value,
+			Offset:  baseOffset + offsetDelta, // 절대 오프셋 계산
+			Key:     string(key),
+			Value:   string(value),
+			Headers: headers,
 		})
 	}
 
 	return records, nil
 }
+
+// readField reads a [Length(varint)][Bytes] field at offset and returns the offset after it.
+// A length of -1 is null and returns nil.
+func readField(data []byte, offset int) ([]byte, int, error) {
+	if offset >= len(data) {
+		return nil, 0, fmt.Errorf("record truncated at %d", offset)
+	}
+	length, n := binary.Varint(data[offset:])
+	if n <= 0 || length > int64(len(data)-offset-n) {
+		return nil, 0, fmt.Errorf("record field at %d runs past the batch", offset)
+	}
+	offset += n
+
+	if length < 0 {
+		return nil, offset, nil
+	}
+	return data[offset : offset+int(length)], offset + int(length), nil
+}
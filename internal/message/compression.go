@@ -0,0 +1,210 @@
+package message
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	ErrUnsupportedCompression = errors.New("unsupported compression codec")
+	ErrCorruptCompressed      = errors.New("corrupt compressed records")
+)
+
+// CompressionCodec is the codec of a batch's records, stored in Attributes bits 0~2.
+// The 61-byte header is never compressed; everything after it is.
+type CompressionCodec int8
+
+const (
+	CompressionNone   CompressionCodec = 0
+	CompressionGzip   CompressionCodec = 1
+	CompressionSnappy CompressionCodec = 2
+	CompressionLZ4    CompressionCodec = 3
+	CompressionZstd   CompressionCodec = 4
+
+	compressionCodecMask = 0x07
+)
+
+// MaxDecompressedBytes bounds the records of one batch after decompression, so a small
+// compressed batch cannot make the broker allocate without limit.
+const MaxDecompressedBytes = 128 * 1024 * 1024
+
+var codecNames = map[CompressionCodec]string{
+	CompressionNone:   "none",
+	CompressionGzip:   "gzip",
+	CompressionSnappy: "snappy",
+	CompressionLZ4:    "lz4",
+	CompressionZstd:   "zstd",
+}
+
+func (c CompressionCodec) String() string {
+	if name, ok := codecNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("codec(%d)", int8(c))
+}
+
+// ParseCompressionCodec returns the codec called name (compression.type), e.g. "zstd".
+func ParseCompressionCodec(name string) (CompressionCodec, error) {
+	for codec, n := range codecNames {
+		if n == name {
+			return codec, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnsupportedCompression, name)
+}
+
+// Compression returns the codec of the batch's records.
+func (h BatchHeader) Compression() CompressionCodec {
+	return CompressionCodec(h.Attributes & compressionCodecMask)
+}
+
+// Compress encodes records with codec. CompressionNone returns records as-is.
+func Compress(codec CompressionCodec, records []byte) ([]byte, error) {
+	switch codec {
+	case CompressionNone:
+		return records, nil
+
+	case CompressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(records); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+
+	case CompressionSnappy:
+		return snappy.Encode(nil, records), nil
+
+	case CompressionLZ4:
+		return compressLZ4(records), nil
+
+	case CompressionZstd:
+		return zstdEncoder().EncodeAll(records, nil), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedCompression, codec)
+}
+
+// Decompress decodes records compressed with codec. The result may not exceed
+// MaxDecompressedBytes. CompressionNone returns data as-is.
+func Decompress(codec CompressionCodec, data []byte) ([]byte, error) {
+	var out []byte
+	var err error
+
+	switch codec {
+	case CompressionNone:
+		return data, nil
+
+	case CompressionGzip:
+		var r *gzip.Reader
+		if r, err = gzip.NewReader(bytes.NewReader(data)); err == nil {
+			out, err = readAtMost(r)
+		}
+
+	case CompressionSnappy:
+		out, err = decodeSnappy(data)
+
+	case CompressionLZ4:
+		out, err = decompressLZ4(data)
+
+	case CompressionZstd:
+		out, err = zstdDecoder().DecodeAll(data, nil)
+
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCompression, codec)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w (%s): %v", ErrCorruptCompressed, codec, err)
+	}
+	return out, nil
+}
+
+// readAtMost reads r to the end, failing beyond MaxDecompressedBytes.
+func readAtMost(r io.Reader) ([]byte, error) {
+	out, err := io.ReadAll(io.LimitReader(r, MaxDecompressedBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > MaxDecompressedBytes {
+		return nil, fmt.Errorf("more than %d bytes", MaxDecompressedBytes)
+	}
+	return out, nil
+}
+
+// xerialHeader starts snappy data framed by the Java client (snappy-java's SnappyOutputStream):
+// magic(8) + version(4) + compatible version(4), then blocks of [length(4)][snappy block].
+var xerialHeader = []byte{0x82, 'S', 'N', 'A', 'P', 'P', 'Y', 0}
+
+const xerialHeaderSize = 16
+
+// decodeSnappy accepts both a plain snappy block and xerial framing.
+func decodeSnappy(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, xerialHeader) {
+		return decodeSnappyBlock(nil, data)
+	}
+
+	var out []byte
+	for rest := data[min(xerialHeaderSize, len(data)):]; len(rest) > 0; {
+		if len(rest) < 4 {
+			return nil, errors.New("truncated xerial block length")
+		}
+		n := binary.BigEndian.Uint32(rest)
+		if uint64(n) > uint64(len(rest)-4) {
+			return nil, errors.New("truncated xerial block")
+		}
+
+		var err error
+		if out, err = decodeSnappyBlock(out, rest[4:4+n]); err != nil {
+			return nil, err
+		}
+		rest = rest[4+n:]
+	}
+	return out, nil
+}
+
+// decodeSnappyBlock appends one decoded snappy block to dst.
+func decodeSnappyBlock(dst, block []byte) ([]byte, error) {
+	n, err := snappy.DecodedLen(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(dst)+n > MaxDecompressedBytes {
+		return nil, fmt.Errorf("more than %d bytes", MaxDecompressedBytes)
+	}
+
+	decoded, err := snappy.Decode(nil, block)
+	if err != nil {
+		return nil, err
+	}
+	return append(dst, decoded...), nil
+}
+
+// The zstd encoder and decoder are safe for concurrent EncodeAll/DecodeAll and
+// expensive to create, so every batch shares one of each.
+var (
+	zstdEncoder = sync.OnceValue(func() *zstd.Encoder {
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			panic(err) // Only fails on invalid options
+		}
+		return enc
+	})
+	zstdDecoder = sync.OnceValue(func() *zstd.Decoder {
+		dec, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(MaxDecompressedBytes))
+		if err != nil {
+			panic(err)
+		}
+		return dec
+	})
+)
@@ -0,0 +1,148 @@
+package message
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+)
+
+func TestCompression_RoundTrip(t *testing.T) {
+	records := bytes.Repeat([]byte("trace-id=3f2a tenant=acme "), 10000)
+	records = append(records, "tail"...)
+
+	for _, codec := range []CompressionCodec{CompressionNone, CompressionGzip, CompressionSnappy, CompressionLZ4, CompressionZstd} {
+		compressed, err := Compress(codec, records)
+		if err != nil {
+			t.Fatalf("Compress(%s) failed: %v", codec, err)
+		}
+		if codec != CompressionNone && len(compressed) >= len(records) {
+			t.Errorf("%s did not compress: %d -> %d bytes", codec, len(records), len(compressed))
+		}
+
+		got, err := Decompress(codec, compressed)
+		if err != nil {
+			t.Fatalf("Decompress(%s) failed: %v", codec, err)
+		}
+		if !bytes.Equal(got, records) {
+			t.Errorf("%s round trip mismatch", codec)
+		}
+
+		if codec != CompressionNone {
+			if _, err := Decompress(codec, compressed[:len(compressed)/2]); !errors.Is(err, ErrCorruptCompressed) {
+				t.Errorf("Decompress(%s) of truncated data: want ErrCorruptCompressed, got %v", codec, err)
+			}
+		}
+	}
+
+	if _, err := Decompress(5, records); !errors.Is(err, ErrUnsupportedCompression) {
+		t.Errorf("Decompress with codec 5: want ErrUnsupportedCompression, got %v", err)
+	}
+}
+
+func TestCompression_XerialSnappy(t *testing.T) {
+	// Java clients frame snappy blocks: header, then [length][block] per chunk
+	framed := append([]byte(nil), xerialHeader...)
+	framed = binary.BigEndian.AppendUint32(framed, 1) // Version
+	framed = binary.BigEndian.AppendUint32(framed, 1) // Compatible version
+	var want []byte
+	for _, chunk := range []string{"first chunk ", "second chunk"} {
+		block := snappy.Encode(nil, []byte(chunk))
+		framed = binary.BigEndian.AppendUint32(framed, uint32(len(block)))
+		framed = append(framed, block...)
+		want = append(want, chunk...)
+	}
+
+	got, err := Decompress(CompressionSnappy, framed)
+	if err != nil {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Want %q, got %q", want, got)
+	}
+}
+
+func TestCompression_LZ4ReferenceFrames(t *testing.T) {
+	// Frames written by the reference lz4 CLI (v1.9.4) from these inputs, e.g.
+	// lz4 -BX -B4 text block-checksum.lz4
+	var text bytes.Buffer
+	for i := range 5000 {
+		fmt.Fprintf(&text, "key-%03d: value %d\n", i%500, i%500%7)
+	}
+	random := make([]byte, 1000) // Incompressible: stored as an uncompressed block
+	for i, x := 0, uint32(1); i < len(random); i++ {
+		x = (x*1103515245 + 12345) % (1 << 31)
+		random[i] = byte(x >> 16)
+	}
+
+	frames := map[string][]byte{}
+	for name, tc := range map[string]struct {
+		want  []byte
+		flags byte // FLG bits set by the CLI options
+	}{
+		"default":             {text.Bytes(), lz4FlagBlockIndep | lz4FlagContentSum},
+		"block-checksum":      {text.Bytes(), lz4FlagBlockIndep | lz4FlagBlockSum | lz4FlagContentSum}, // -BX -B4: two checksummed 64KB blocks
+		"content-size":        {text.Bytes(), lz4FlagBlockIndep | lz4FlagSize | lz4FlagContentSum},     // --content-size
+		"linked-blocks":       {text.Bytes(), lz4FlagContentSum},                                       // -BD -B4: matches across blocks
+		"no-content-checksum": {text.Bytes(), lz4FlagBlockIndep},                                       // --no-frame-crc -B4
+		"uncompressed-block":  {random, lz4FlagBlockIndep | lz4FlagContentSum},
+	} {
+		frame, err := os.ReadFile(filepath.Join("testdata", name+".lz4"))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if frame[4] != lz4Version|tc.flags {
+			t.Fatalf("%s: frame flags mismatch. Want %#x, Got %#x", name, lz4Version|tc.flags, frame[4])
+		}
+		frames[name] = frame
+
+		got, err := Decompress(CompressionLZ4, frame)
+		if err != nil {
+			t.Fatalf("%s: Decompress failed: %v", name, err)
+		}
+		if !bytes.Equal(got, tc.want) {
+			t.Errorf("%s: content mismatch (%d bytes, want %d)", name, len(got), len(tc.want))
+		}
+	}
+
+	// Concatenated frames decode back to back
+	got, err := Decompress(CompressionLZ4, append(slices.Clone(frames["default"]), frames["uncompressed-block"]...))
+	if err != nil || !bytes.Equal(got, append(slices.Clone(text.Bytes()), random...)) {
+		t.Errorf("Concatenated frames mismatch (err: %v)", err)
+	}
+
+	// Every checksum the frames carry is verified
+	for name, corrupt := range map[string]func() []byte{
+		"block checksum": func() []byte {
+			frame := slices.Clone(frames["block-checksum"])
+			frame[len(frame)-12]++ // Checksum of the last block: then EndMark and content checksum
+			return frame
+		},
+		"content checksum": func() []byte {
+			frame := slices.Clone(frames["default"])
+			frame[len(frame)-1]++
+			return frame
+		},
+		"content size": func() []byte {
+			frame := slices.Clone(frames["content-size"])
+			frame[6]++ // Low byte of the size, then fix the header checksum
+			frame[14] = byte(xxh32(frame[4:14]) >> 8)
+			return frame
+		},
+		"block data": func() []byte {
+			frame := slices.Clone(frames["uncompressed-block"])
+			frame[20]++
+			return frame
+		},
+	} {
+		if _, err := Decompress(CompressionLZ4, corrupt()); !errors.Is(err, ErrCorruptCompressed) {
+			t.Errorf("%s: want ErrCorruptCompressed, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package message
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+
+	"lightkafka/pkg"
+)
+
+// AppendRecord encodes r in Kafka v2 record format and appends it to dst.
+// OffsetDelta and TimestampDelta are kept as-is, so a record can be copied
+// into a rewritten batch with the same BaseOffset/BaseTimestamp.
+func AppendRecord(dst []byte, r *Record) []byte {
+	var body []byte
+	var buf [binary.MaxVarintLen64]byte
+
+	// 1. Attributes
+	body = append(body, byte(r.Attributes))
+
+	// 2. TimestampDelta & OffsetDelta
+	body = append(body, buf[:binary.PutVarint(buf[:], r.TimestampDelta)]...)
+	body = append(body, buf[:binary.PutVarint(buf[:], int64(r.OffsetDelta))]...)
+
+	// 3. Key & Value (null is encoded as length -1)
+	body = appendBytesField(body, r.Key)
+	body = appendBytesField(body, r.Value)
+
+	// 4. Headers (raw bytes are copied through untouched)
+	body = append(body, buf[:binary.PutVarint(buf[:], int64(r.HeadersCount))]...)
+	body = append(body, r.headersRaw...)
+
+	// 5. Length prefix + Body
+	dst = append(dst, buf[:binary.PutVarint(buf[:], int64(len(body)))]...)
+	return append(dst, body...)
+}
+
+func appendBytesField(dst []byte, b []byte) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	if b == nil {
+		return append(dst, buf[:binary.PutVarint(buf[:], -1)]...)
+	}
+	dst = append(dst, buf[:binary.PutVarint(buf[:], int64(len(b)))]...)
+	return append(dst, b...)
+}
+
+// EncodeBatch assembles a batch from h and an encoded records payload.
+// BatchLength, Magic and CRC are computed; every other header field is taken from h.
+func EncodeBatch(h BatchHeader, payload []byte) []byte {
+	data := make([]byte, BATCH_HEADER_SIZE+len(payload))
+
+	pkg.Encod.PutUint64(data[0:8], uint64(h.BaseOffset))
+	pkg.Encod.PutUint32(data[8:12], uint32(len(data)-BATCH_LENTH_METADATA_SIZE))
+	pkg.Encod.PutUint32(data[12:16], uint32(h.PartitionLeaderEpoch))
+	data[16] = 2
+	pkg.Encod.PutUint16(data[21:23], uint16(h.Attributes))
+	pkg.Encod.PutUint32(data[23:27], uint32(h.LastOffsetDelta))
+	pkg.Encod.PutUint64(data[27:35], uint64(h.BaseTimestamp))
+	pkg.Encod.PutUint64(data[35:43], uint64(h.MaxTimestamp))
+	pkg.Encod.PutUint64(data[43:51], uint64(h.ProducerId))
+	pkg.Encod.PutUint16(data[51:53], uint16(h.ProducerEpoch))
+	pkg.Encod.PutUint32(data[53:57], uint32(h.BaseSequence))
+	pkg.Encod.PutUint32(data[57:61], uint32(h.RecordsCount))
+	copy(data[BATCH_HEADER_SIZE:], payload)
+
+	// CRC covers everything from Attributes to the end
+	pkg.Encod.PutUint32(data[17:21], crc32.Checksum(data[21:], crcTable))
+	return data
+}
@@ -0,0 +1,305 @@
+package message
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// Kafka's lz4 is the LZ4 frame format (https://github.com/lz4/lz4/blob/dev/doc/lz4_Frame_format.md).
+// We write independent 64KB blocks without checksums, the same frames the Java client
+// writes, and read any frame without a dictionary.
+const (
+	lz4FrameMagic     = 0x184D2204
+	lz4Version        = 0x40 // FLG bits 7~6 = 01
+	lz4FlagBlockIndep = 0x20
+	lz4FlagBlockSum   = 0x10
+	lz4FlagSize       = 0x08
+	lz4FlagContentSum = 0x04
+	lz4FlagDictID     = 0x01
+	lz4Block64KB      = 4 << 4 // BD bits 6~4
+
+	lz4BlockSize    = 64 * 1024
+	lz4Uncompressed = 1 << 31 // Block size bit: the block is stored as-is
+
+	lz4MinMatch    = 4
+	lz4LastLiteral = 5  // The last 5 bytes are always literals
+	lz4MatchLimit  = 12 // and no match starts in the last 12
+	lz4HashLog     = 16
+)
+
+var errLZ4Corrupt = errors.New("corrupt lz4 data")
+
+// compressLZ4 encodes src as one LZ4 frame.
+func compressLZ4(src []byte) []byte {
+	dst := binary.LittleEndian.AppendUint32(nil, lz4FrameMagic)
+	descriptor := []byte{lz4Version | lz4FlagBlockIndep, lz4Block64KB}
+	dst = append(dst, descriptor...)
+	dst = append(dst, byte(xxh32(descriptor)>>8))
+
+	table := make([]int32, 1<<lz4HashLog)
+	for len(src) > 0 {
+		n := min(len(src), lz4BlockSize)
+		block := src[:n]
+		src = src[n:]
+
+		clear(table)
+		sizeAt := len(dst)
+		dst = append(dst, 0, 0, 0, 0)
+		dst = compressLZ4Block(dst, block, table)
+
+		size := uint32(len(dst) - sizeAt - 4)
+		if int(size) >= n {
+			// Incompressible: store it as-is
+			dst = append(dst[:sizeAt+4], block...)
+			size = uint32(n) | lz4Uncompressed
+		}
+		binary.LittleEndian.PutUint32(dst[sizeAt:], size)
+	}
+	return binary.LittleEndian.AppendUint32(dst, 0) // EndMark
+}
+
+// compressLZ4Block appends src as an LZ4 block, found greedily through a hash table of
+// the last position of every 4-byte sequence.
+func compressLZ4Block(dst, src []byte, table []int32) []byte {
+	anchor := 0
+	for i := 0; i < len(src)-lz4MatchLimit; {
+		seq := binary.LittleEndian.Uint32(src[i:])
+		h := (seq * 2654435761) >> (32 - lz4HashLog)
+		ref := int(table[h]) - 1
+		table[h] = int32(i + 1)
+
+		if ref < 0 || i-ref > 0xFFFF || binary.LittleEndian.Uint32(src[ref:]) != seq {
+			i++
+			continue
+		}
+
+		end := i + lz4MinMatch
+		for end < len(src)-lz4LastLiteral && src[end] == src[ref+end-i] {
+			end++
+		}
+		dst = appendLZ4Sequence(dst, src[anchor:i], i-ref, end-i)
+		i, anchor = end, end
+	}
+	return appendLZ4Sequence(dst, src[anchor:], 0, 0)
+}
+
+// appendLZ4Sequence appends literals followed by a match. A match length of 0 marks the
+// last sequence, which has literals only.
+func appendLZ4Sequence(dst, literals []byte, offset, matchLen int) []byte {
+	token := byte(min(len(literals), 15)) << 4
+	if matchLen > 0 {
+		token |= byte(min(matchLen-lz4MinMatch, 15))
+	}
+	dst = append(dst, token)
+	dst = appendLZ4Length(dst, len(literals))
+	dst = append(dst, literals...)
+	if matchLen == 0 {
+		return dst
+	}
+	dst = binary.LittleEndian.AppendUint16(dst, uint16(offset))
+	return appendLZ4Length(dst, matchLen-lz4MinMatch)
+}
+
+// appendLZ4Length appends the bytes of n that did not fit in its 4-bit token field.
+func appendLZ4Length(dst []byte, n int) []byte {
+	if n < 15 {
+		return dst
+	}
+	for n -= 15; n >= 255; n -= 255 {
+		dst = append(dst, 255)
+	}
+	return append(dst, byte(n))
+}
+
+// decompressLZ4 decodes LZ4 frames, up to MaxDecompressedBytes.
+func decompressLZ4(src []byte) ([]byte, error) {
+	var out []byte
+	for len(src) > 0 {
+		var err error
+		if out, src, err = decompressLZ4Frame(out, src); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// decompressLZ4Frame appends the content of the frame at the start of src to dst and
+// returns the rest of src.
+func decompressLZ4Frame(dst, src []byte) ([]byte, []byte, error) {
+	if len(src) < 7 || binary.LittleEndian.Uint32(src) != lz4FrameMagic {
+		return nil, nil, fmt.Errorf("%w: bad frame magic", errLZ4Corrupt)
+	}
+	flags := src[4]
+	if flags&0xC0 != lz4Version {
+		return nil, nil, fmt.Errorf("%w: frame version %d", errLZ4Corrupt, flags>>6)
+	}
+	if flags&lz4FlagDictID != 0 {
+		return nil, nil, fmt.Errorf("%w: dictionaries are not supported", errLZ4Corrupt)
+	}
+
+	descLen := 2
+	if flags&lz4FlagSize != 0 {
+		descLen += 8
+	}
+	if len(src) < 4+descLen+1 {
+		return nil, nil, fmt.Errorf("%w: truncated frame descriptor", errLZ4Corrupt)
+	}
+	descriptor := src[4 : 4+descLen]
+	if src[4+descLen] != byte(xxh32(descriptor)>>8) {
+		return nil, nil, fmt.Errorf("%w: frame descriptor checksum", errLZ4Corrupt)
+	}
+	maxBlock := 1 << (8 + 2*((descriptor[1]>>4)&0x07))
+	src = src[4+descLen+1:]
+
+	start := len(dst)
+	for {
+		if len(src) < 4 {
+			return nil, nil, fmt.Errorf("%w: truncated block size", errLZ4Corrupt)
+		}
+		size := binary.LittleEndian.Uint32(src)
+		src = src[4:]
+		if size == 0 {
+			break // EndMark
+		}
+
+		n := int(size &^ lz4Uncompressed)
+		if n > maxBlock || n > len(src) {
+			return nil, nil, fmt.Errorf("%w: block of %d bytes", errLZ4Corrupt, n)
+		}
+		block := src[:n]
+		src = src[n:]
+		if flags&lz4FlagBlockSum != 0 {
+			if len(src) < 4 || binary.LittleEndian.Uint32(src) != xxh32(block) {
+				return nil, nil, fmt.Errorf("%w: block checksum", errLZ4Corrupt)
+			}
+			src = src[4:]
+		}
+
+		if len(dst)+maxBlock > MaxDecompressedBytes {
+			return nil, nil, fmt.Errorf("more than %d bytes", MaxDecompressedBytes)
+		}
+		if size&lz4Uncompressed != 0 {
+			dst = append(dst, block...)
+			continue
+		}
+		// Independent or not, a block only refers back to the content decoded before it
+		var err error
+		if dst, err = decompressLZ4Block(dst, block, start, maxBlock); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if flags&lz4FlagSize != 0 && binary.LittleEndian.Uint64(descriptor[2:]) != uint64(len(dst)-start) {
+		return nil, nil, fmt.Errorf("%w: content size", errLZ4Corrupt)
+	}
+	if flags&lz4FlagContentSum != 0 {
+		if len(src) < 4 || binary.LittleEndian.Uint32(src) != xxh32(dst[start:]) {
+			return nil, nil, fmt.Errorf("%w: content checksum", errLZ4Corrupt)
+		}
+		src = src[4:]
+	}
+	return dst, src, nil
+}
+
+// decompressLZ4Block appends one decoded block of at most maxSize bytes to dst. Matches
+// may reach back to dst[start:].
+func decompressLZ4Block(dst, src []byte, start, maxSize int) ([]byte, error) {
+	limit := len(dst) + maxSize
+	for i := 0; ; {
+		if i >= len(src) {
+			return nil, fmt.Errorf("%w: truncated block", errLZ4Corrupt)
+		}
+		token := src[i]
+		i++
+
+		litLen, ok := readLZ4Length(src, &i, int(token>>4))
+		if !ok || litLen > len(src)-i || len(dst)+litLen > limit {
+			return nil, fmt.Errorf("%w: literals run past the block", errLZ4Corrupt)
+		}
+		dst = append(dst, src[i:i+litLen]...)
+		i += litLen
+		if i == len(src) {
+			return dst, nil // The last sequence has no match
+		}
+
+		if len(src)-i < 2 {
+			return nil, fmt.Errorf("%w: truncated match offset", errLZ4Corrupt)
+		}
+		offset := int(binary.LittleEndian.Uint16(src[i:]))
+		i += 2
+		matchLen, ok := readLZ4Length(src, &i, int(token&0x0F))
+		matchLen += lz4MinMatch
+		if !ok || offset == 0 || offset > len(dst)-start || len(dst)+matchLen > limit {
+			return nil, fmt.Errorf("%w: invalid match", errLZ4Corrupt)
+		}
+		// Byte by byte: the match may overlap what it produces
+		for from := len(dst) - offset; matchLen > 0; matchLen-- {
+			dst = append(dst, dst[from])
+			from++
+		}
+	}
+}
+
+// readLZ4Length completes a length whose token field is n, advancing *i past its extra bytes.
+func readLZ4Length(src []byte, i *int, n int) (int, bool) {
+	if n < 15 {
+		return n, true
+	}
+	for {
+		if *i >= len(src) || n > MaxDecompressedBytes {
+			return 0, false
+		}
+		b := src[*i]
+		*i++
+		n += int(b)
+		if b != 255 {
+			return n, true
+		}
+	}
+}
+
+// xxh32 is the xxHash32 (seed 0) used by LZ4 frame checksums.
+func xxh32(b []byte) uint32 {
+	const (
+		prime1 uint32 = 2654435761
+		prime2 uint32 = 2246822519
+		prime3 uint32 = 3266489917
+		prime4 uint32 = 668265263
+		prime5 uint32 = 374761393
+	)
+	round := func(acc, in uint32) uint32 {
+		return bits.RotateLeft32(acc+in*prime2, 13) * prime1
+	}
+
+	n := len(b)
+	h := prime5
+	if n >= 16 {
+		v1, v2, v3, v4 := prime1, prime2, uint32(0), uint32(0)
+		v1 += prime2
+		v4 -= prime1
+		for ; len(b) >= 16; b = b[16:] {
+			v1 = round(v1, binary.LittleEndian.Uint32(b[0:]))
+			v2 = round(v2, binary.LittleEndian.Uint32(b[4:]))
+			v3 = round(v3, binary.LittleEndian.Uint32(b[8:]))
+			v4 = round(v4, binary.LittleEndian.Uint32(b[12:]))
+		}
+		h = bits.RotateLeft32(v1, 1) + bits.RotateLeft32(v2, 7) + bits.RotateLeft32(v3, 12) + bits.RotateLeft32(v4, 18)
+	}
+
+	h += uint32(n)
+	for ; len(b) >= 4; b = b[4:] {
+		h = bits.RotateLeft32(h+binary.LittleEndian.Uint32(b)*prime3, 17) * prime4
+	}
+	for _, c := range b {
+		h = bits.RotateLeft32(h+uint32(c)*prime5, 11) * prime1
+	}
+
+	h ^= h >> 15
+	h *= prime2
+	h ^= h >> 13
+	h *= prime3
+	h ^= h >> 16
+	return h
+}
@@ -2,6 +2,8 @@ package message
 
 import (
 	"encoding/binary"
+	"fmt"
+	"math"
 )
 
 // Record represents a view into a single Kafka record.
@@ -26,90 +28,147 @@ type Record struct {
 }
 
 // BatchIterator iterates over records without allocation.
+// Records of a compressed batch point into its decompressed copy instead.
 type BatchIterator struct {
 	data          []byte
 	offset        int
 	recordsLeft   int32
+	index         int // Of the next record
 	baseOffset    int64
 	baseTimestamp int64
+	logAppendTime int64 // Timestamp of every record of a LogAppendTime batch, -1 otherwise
+	err           error
 }
 
+// NewIterator returns an iterator over the batch's records, decompressing them first
+// if the batch is compressed. A payload that cannot be decompressed yields no records
+// and is reported by Err. Every record of a LogAppendTime batch has its MaxTimestamp.
 func (b *RecordBatch) NewIterator() *BatchIterator {
-	return &BatchIterator{
-		data:          b.Payload,
+	data, err := Decompress(b.Header.Compression(), b.Payload)
+	it := &BatchIterator{
+		data:          data,
 		offset:        0,
 		recordsLeft:   b.Header.RecordsCount,
 		baseOffset:    b.Header.BaseOffset,
 		baseTimestamp: b.Header.BaseTimestamp,
+		logAppendTime: -1,
+		err:           err,
 	}
+	if b.Header.TimestampType() == TimestampLogAppendTime {
+		it.logAppendTime = b.Header.MaxTimestamp
+	}
+	return it
+}
+
+// Err returns the error that stopped the iteration early, such as a corrupt
+// compressed payload or a malformed record. It is nil when every record was returned.
+func (it *BatchIterator) Err() error {
+	return it.err
 }
 
+// Next decodes the next record into out. It returns false at the end of the batch or
+// at a malformed record, which Err then reports as a *RecordError.
 func (it *BatchIterator) Next(out *Record) bool {
-	if it.recordsLeft <= 0 || it.offset >= len(it.data) {
+	if it.err != nil || it.recordsLeft <= 0 || it.offset >= len(it.data) {
 		return false
 	}
 
+	if reason := it.decode(out); reason != "" {
+		it.err = &RecordError{Index: it.index, Reason: reason}
+		return false
+	}
+	it.index++
+	it.recordsLeft--
+	return true
+}
+
+// decode reads the record at it.offset into out. Every length is checked against the
+// record, so a malformed one returns the reason instead of reading past it.
+func (it *BatchIterator) decode(out *Record) string {
 	// 1. Length
 	recLen, n := binary.Varint(it.data[it.offset:])
 	if n <= 0 {
-		return false
+		return "truncated record length"
+	}
+	if recLen <= 0 || recLen > int64(len(it.data)-it.offset-n) {
+		return fmt.Sprintf("record length %d runs past the batch", recLen)
 	}
 	it.offset += n
 	out.Length = recLen
 
-	recordEnd := it.offset + int(recLen)
-	if recordEnd > len(it.data) {
-		return false
-	}
+	rec := recordReader{data: it.data[it.offset : it.offset+int(recLen)]}
 
 	// 2. Attributes
-	out.Attributes = int8(it.data[it.offset])
-	it.offset++
+	out.Attributes = int8(rec.data[0])
+	rec.pos++
 
 	// 3. TimestampDelta
-	tsDelta, n := binary.Varint(it.data[it.offset:])
-	it.offset += n
+	tsDelta, ok := rec.varint()
+	if !ok {
+		return "truncated timestamp delta"
+	}
 	out.TimestampDelta = tsDelta
 	out.Timestamp = it.baseTimestamp + tsDelta
+	if it.logAppendTime >= 0 {
+		out.Timestamp = it.logAppendTime
+	}
 
 	// 4. OffsetDelta
-	offDelta, n := binary.Varint(it.data[it.offset:])
-	it.offset += n
+	offDelta, ok := rec.varint()
+	if !ok || offDelta < 0 || offDelta > math.MaxInt32 {
+		return "invalid offset delta"
+	}
 	out.OffsetDelta = int32(offDelta)
-	out.Offset = it.baseOffset + int64(offDelta)
+	out.Offset = it.baseOffset + offDelta
 
-	// 5. Key
-	keyLen, n := binary.Varint(it.data[it.offset:])
-	it.offset += n
-	if keyLen >= 0 {
-		out.Key = it.data[it.offset : it.offset+int(keyLen)]
-		it.offset += int(keyLen)
-	} else {
-		out.Key = nil
+	// 5. Key & 6. Value (null is length -1)
+	if out.Key, ok = rec.bytesField(); !ok {
+		return "key runs past the record"
 	}
-
-	// 6. Value
-	valLen, n := binary.Varint(it.data[it.offset:])
-	it.offset += n
-	if valLen >= 0 {
-		out.Value = it.data[it.offset : it.offset+int(valLen)]
-		it.offset += int(valLen)
-	} else {
-		out.Value = nil
+	if out.Value, ok = rec.bytesField(); !ok {
+		return "value runs past the record"
 	}
 
 	// 7. Headers
-	hCount, n := binary.Varint(it.data[it.offset:])
-	it.offset += n
+	hCount, ok := rec.varint()
+	if !ok || hCount < 0 || hCount > int64(len(rec.data)) {
+		return "invalid header count"
+	}
 	out.HeadersCount = int(hCount)
+	out.headersRaw = nil
+	if rec.pos < len(rec.data) {
+		out.headersRaw = rec.data[rec.pos:]
+	}
+
+	it.offset += int(recLen)
+	return ""
+}
 
-	if it.offset < recordEnd {
-		out.headersRaw = it.data[it.offset:recordEnd]
-	} else {
-		out.headersRaw = nil
+// recordReader reads the fields of one record without going past its end.
+type recordReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *recordReader) varint() (int64, bool) {
+	v, n := binary.Varint(r.data[r.pos:])
+	if n <= 0 {
+		return 0, false
 	}
+	r.pos += n
+	return v, true
+}
 
-	it.offset = recordEnd
-	it.recordsLeft--
-	return true
+// bytesField reads a [Length(varint)][Bytes] field; length -1 is null (nil).
+func (r *recordReader) bytesField() ([]byte, bool) {
+	length, ok := r.varint()
+	if !ok || length < -1 || length > int64(len(r.data)-r.pos) {
+		return nil, false
+	}
+	if length < 0 {
+		return nil, true
+	}
+	b := r.data[r.pos : r.pos+int(length)]
+	r.pos += int(length)
+	return b, true
 }
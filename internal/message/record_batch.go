@@ -47,25 +47,48 @@ type RecordBatch struct {
 	Payload []byte // Raw bytes of records (Zero-Copy slice)
 }
 
-// DecodeBatch parses the batch header strictly.
+// DecodeBatch parses the batch header strictly. data may continue past the batch
+// (e.g. a read of several batches); the CRC covers only the batch's own bytes.
 func DecodeBatch(data []byte) (*RecordBatch, error) {
-	if len(data) < 61 {
-		return nil, ErrInsufficientData
+	h, err := DecodeHeader(data)
+	if err != nil {
+		return nil, err
 	}
 
-	h := BatchHeader{}
-	h.BaseOffset = int64(pkg.Encod.Uint64(data[0:8]))
-	h.BatchLength = int32(pkg.Encod.Uint32(data[8:12]))
-
 	// Validation: Check if we have the full batch data
 	if int64(len(data)) < int64(h.BatchLength)+12 {
 		return nil, ErrInsufficientData
 	}
 
+	// Payload starts after the header (61 bytes)
+	// If compressed, this is the compressed data.
+	payloadEnd := 12 + int(h.BatchLength)
+
+	calcCRC := crc32.Checksum(data[21:payloadEnd], crcTable)
+	if calcCRC != h.CRC {
+		return nil, fmt.Errorf("%w: expected %d, got %d", ErrCRCMismatch, h.CRC, calcCRC)
+	}
+
+	return &RecordBatch{
+		Header:  h,
+		Payload: data[61:payloadEnd], // Zero-Copy slicing
+	}, nil
+}
+
+// DecodeHeader parses only the fixed 61-byte header. The CRC is not verified and
+// the payload does not need to be present; used to walk batches that are already trusted.
+func DecodeHeader(data []byte) (BatchHeader, error) {
+	if len(data) < 61 {
+		return BatchHeader{}, ErrInsufficientData
+	}
+
+	h := BatchHeader{}
+	h.BaseOffset = int64(pkg.Encod.Uint64(data[0:8]))
+	h.BatchLength = int32(pkg.Encod.Uint32(data[8:12]))
 	h.PartitionLeaderEpoch = int32(pkg.Encod.Uint32(data[12:16]))
 	h.Magic = int8(data[16])
 	if h.Magic != 2 {
-		return nil, fmt.Errorf("%w: got %d", ErrInvalidMagic, h.Magic)
+		return BatchHeader{}, fmt.Errorf("%w: got %d", ErrInvalidMagic, h.Magic)
 	}
 
 	h.CRC = pkg.Encod.Uint32(data[17:21])
@@ -78,19 +101,7 @@ func DecodeBatch(data []byte) (*RecordBatch, error) {
 	h.BaseSequence = int32(pkg.Encod.Uint32(data[53:57]))
 	h.RecordsCount = int32(pkg.Encod.Uint32(data[57:61]))
 
-	// Payload starts after the header (61 bytes)
-	// If compressed, this is the compressed data.
-	payloadEnd := 12 + int(h.BatchLength)
-
-	calcCRC := crc32.Checksum(data[21:], crcTable)
-	if calcCRC != h.CRC {
-		return nil, fmt.Errorf("%w: expected %d, got %d", ErrCRCMismatch, h.CRC, calcCRC)
-	}
-
-	return &RecordBatch{
-		Header:  h,
-		Payload: data[61:payloadEnd], // Zero-Copy slicing
-	}, nil
+	return h, nil
 }
 
 // Encode is a placeholder. For a broker, we usually just append raw bytes.
@@ -0,0 +1,25 @@
+package message
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecodeBatch_FollowingBytes(t *testing.T) {
+	first := EncodeBatch(BatchHeader{RecordsCount: 1}, AppendRecord(nil, &Record{Value: []byte("first")}))
+	second := EncodeBatch(BatchHeader{BaseOffset: 1, RecordsCount: 1}, AppendRecord(nil, &Record{Value: []byte("second")}))
+
+	// A read returns batches back to back: each one decodes on its own
+	batch, err := DecodeBatch(append(first, second...))
+	if err != nil {
+		t.Fatalf("DecodeBatch failed: %v", err)
+	}
+	if batch.Size() != len(first) {
+		t.Errorf("Size mismatch. Want %d, Got %d", len(first), batch.Size())
+	}
+
+	first[len(first)-1] ^= 0xFF
+	if _, err := DecodeBatch(append(first, second...)); !errors.Is(err, ErrCRCMismatch) {
+		t.Errorf("Corrupt batch: want ErrCRCMismatch, got %v", err)
+	}
+}
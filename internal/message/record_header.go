@@ -2,17 +2,26 @@ package message
 
 import "encoding/binary"
 
+// Header is a key-value pair attached to a record, e.g. a trace id.
+// Keys are never null; a null Value is nil, an empty one is non-nil.
 type Header struct {
 	Key   []byte
 	Value []byte
 }
 
+// HeaderIterator iterates over the headers of a record without allocation.
+// Key and Value point into the record.
 type HeaderIterator struct {
 	data   []byte
 	offset int
 	count  int
 }
 
+// Headers returns an iterator over the record's headers.
+func (r *Record) Headers() *HeaderIterator {
+	return &HeaderIterator{data: r.headersRaw, count: r.HeadersCount}
+}
+
 func (hi *HeaderIterator) Next() (Header, bool) {
 	if hi == nil || hi.count <= 0 || hi.offset >= len(hi.data) {
 		return Header{}, false
@@ -20,7 +29,7 @@ func (hi *HeaderIterator) Next() (Header, bool) {
 
 	// 1. Header Key Length (varint)
 	keyLen, n := binary.Varint(hi.data[hi.offset:])
-	if n <= 0 {
+	if n <= 0 || keyLen > int64(len(hi.data)-hi.offset-n) {
 		return Header{}, false
 	}
 	hi.offset += n
@@ -34,14 +43,14 @@ func (hi *HeaderIterator) Next() (Header, bool) {
 
 	// 3. Header Value Length (varint)
 	valLen, n := binary.Varint(hi.data[hi.offset:])
-	if n <= 0 {
+	if n <= 0 || valLen > int64(len(hi.data)-hi.offset-n) {
 		return Header{}, false
 	}
 	hi.offset += n
 
 	// 4. Header Value
 	var val []byte
-	if valLen > 0 {
+	if valLen >= 0 {
 		val = hi.data[hi.offset : hi.offset+int(valLen)]
 		hi.offset += int(valLen)
 	}
@@ -49,3 +58,11 @@ func (hi *HeaderIterator) Next() (Header, bool) {
 	hi.count--
 	return Header{Key: key, Value: val}, true
 }
+
+// AppendHeader encodes h in Kafka v2 record header format and appends it to dst.
+func AppendHeader(dst []byte, h Header) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	dst = append(dst, buf[:binary.PutVarint(buf[:], int64(len(h.Key)))]...)
+	dst = append(dst, h.Key...)
+	return appendBytesField(dst, h.Value)
+}
@@ -0,0 +1,52 @@
+package message
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRecord_Headers(t *testing.T) {
+	want := []Header{
+		{Key: []byte("trace-id"), Value: []byte("3f2a9c")},
+		{Key: []byte("tenant"), Value: []byte{}},
+		{Key: []byte("null"), Value: nil},
+	}
+	var raw []byte
+	for _, h := range want {
+		raw = AppendHeader(raw, h)
+	}
+
+	var payload []byte
+	payload = AppendRecord(payload, &Record{Key: []byte("k"), Value: []byte("v"), HeadersCount: len(want), headersRaw: raw})
+	payload = AppendRecord(payload, &Record{OffsetDelta: 1, Value: []byte("no headers")})
+	batch, err := DecodeBatch(EncodeBatch(BatchHeader{LastOffsetDelta: 1, RecordsCount: 2}, payload))
+	if err != nil {
+		t.Fatalf("DecodeBatch failed: %v", err)
+	}
+
+	var rec Record
+	it := batch.NewIterator()
+	if !it.Next(&rec) {
+		t.Fatalf("First record missing")
+	}
+	headers := rec.Headers()
+	for i, w := range want {
+		h, ok := headers.Next()
+		if !ok {
+			t.Fatalf("Header %d missing", i)
+		}
+		if !bytes.Equal(h.Key, w.Key) || !bytes.Equal(h.Value, w.Value) || (h.Value == nil) != (w.Value == nil) {
+			t.Errorf("Header %d: want %q=%q, got %q=%q", i, w.Key, w.Value, h.Key, h.Value)
+		}
+	}
+	if _, ok := headers.Next(); ok {
+		t.Errorf("More headers than encoded")
+	}
+
+	if !it.Next(&rec) {
+		t.Fatalf("Second record missing")
+	}
+	if _, ok := rec.Headers().Next(); ok {
+		t.Errorf("Record without headers returned one")
+	}
+}
@@ -0,0 +1,46 @@
+package message
+
+import (
+	"errors"
+	"hash/crc32"
+
+	"lightkafka/pkg"
+)
+
+var ErrInvalidTimestamp = errors.New("timestamp out of range")
+
+// TimestampType tells who set the timestamps of a batch, stored in Attributes bit 3.
+type TimestampType int8
+
+const (
+	TimestampCreateTime    TimestampType = 0 // Set by the producer
+	TimestampLogAppendTime TimestampType = 1 // Set by the broker when appending
+
+	timestampTypeBit = 0x08
+)
+
+func (t TimestampType) String() string {
+	if t == TimestampLogAppendTime {
+		return "LogAppendTime"
+	}
+	return "CreateTime"
+}
+
+// TimestampType returns who set the batch's timestamps.
+func (h BatchHeader) TimestampType() TimestampType {
+	if h.Attributes&timestampTypeBit != 0 {
+		return TimestampLogAppendTime
+	}
+	return TimestampCreateTime
+}
+
+// SetLogAppendTime stamps the encoded batch in data with the broker time ts: it sets the
+// LogAppendTime attribute, overwrites BaseTimestamp and MaxTimestamp and recomputes the CRC.
+// Records keep their TimestampDelta, but every record of such a batch has timestamp ts.
+func SetLogAppendTime(data []byte, ts int64) {
+	attributes := pkg.Encod.Uint16(data[21:23])
+	pkg.Encod.PutUint16(data[21:23], attributes|timestampTypeBit)
+	pkg.Encod.PutUint64(data[27:35], uint64(ts))
+	pkg.Encod.PutUint64(data[35:43], uint64(ts))
+	pkg.Encod.PutUint32(data[17:21], crc32.Checksum(data[21:], crcTable))
+}
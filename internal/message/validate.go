@@ -0,0 +1,88 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidRecord  = errors.New("invalid record")
+	ErrRecordTooLarge = errors.New("record batch too large")
+)
+
+// RecordError locates a malformed record: Index is its position in the batch, -1 if
+// the batch as a whole is inconsistent (e.g. RecordsCount does not match its records).
+type RecordError struct {
+	Index  int
+	Reason string
+}
+
+func (e *RecordError) Error() string {
+	if e.Index < 0 {
+		return fmt.Sprintf("%v: batch: %s", ErrInvalidRecord, e.Reason)
+	}
+	return fmt.Sprintf("%v %d: %s", ErrInvalidRecord, e.Index, e.Reason)
+}
+
+func (e *RecordError) Unwrap() error {
+	return ErrInvalidRecord
+}
+
+// Validate checks a batch from a producer record by record, where DecodeBatch checks
+// only the header and CRC. The codec must be supported and a compressed payload must
+// decompress. Every record must decode within its length, with OffsetDeltas counting
+// up from 0, and the records must match RecordsCount and LastOffsetDelta exactly.
+// With maxTimestampDiffMs > 0, every timestamp, MaxTimestamp included, must also be
+// within maxTimestampDiffMs of now. The payload is decompressed once for all checks.
+func (b *RecordBatch) Validate(now, maxTimestampDiffMs int64) error {
+	h := b.Header
+	checkTimestamp := func(ts int64) error {
+		if maxTimestampDiffMs > 0 && (ts < now-maxTimestampDiffMs || ts > now+maxTimestampDiffMs) {
+			return fmt.Errorf("%w: %d is more than %d ms from broker time %d", ErrInvalidTimestamp, ts, maxTimestampDiffMs, now)
+		}
+		return nil
+	}
+	codec := h.Compression()
+	if _, ok := codecNames[codec]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnsupportedCompression, codec)
+	}
+	if h.RecordsCount <= 0 {
+		return &RecordError{Index: -1, Reason: fmt.Sprintf("RecordsCount %d", h.RecordsCount)}
+	}
+	if h.LastOffsetDelta != h.RecordsCount-1 {
+		return &RecordError{Index: -1, Reason: fmt.Sprintf("LastOffsetDelta %d with %d records", h.LastOffsetDelta, h.RecordsCount)}
+	}
+	if err := checkTimestamp(h.MaxTimestamp); err != nil {
+		return err
+	}
+
+	var rec Record
+	it := b.NewIterator()
+	for it.Next(&rec) {
+		i := it.index - 1
+		if rec.OffsetDelta != int32(i) {
+			return &RecordError{Index: i, Reason: fmt.Sprintf("OffsetDelta %d, want %d", rec.OffsetDelta, i)}
+		}
+		if err := checkTimestamp(rec.Timestamp); err != nil {
+			return fmt.Errorf("offset delta %d: %w", rec.OffsetDelta, err)
+		}
+
+		headers := rec.Headers()
+		for _, ok := headers.Next(); ok; _, ok = headers.Next() {
+		}
+		if headers.count != 0 || headers.offset != len(headers.data) {
+			return &RecordError{Index: i, Reason: fmt.Sprintf("malformed headers (%d declared)", rec.HeadersCount)}
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	if it.index != int(h.RecordsCount) {
+		return &RecordError{Index: -1, Reason: fmt.Sprintf("RecordsCount %d, found %d records", h.RecordsCount, it.index)}
+	}
+	if extra := len(it.data) - it.offset; extra > 0 {
+		return &RecordError{Index: -1, Reason: fmt.Sprintf("%d bytes after the last record", extra)}
+	}
+	return nil
+}
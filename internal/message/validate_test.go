@@ -0,0 +1,71 @@
+package message
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRecordBatch_Validate(t *testing.T) {
+	records := func(n int) []byte {
+		var payload []byte
+		for i := range n {
+			payload = AppendRecord(payload, &Record{OffsetDelta: int32(i), Key: []byte("k"), Value: []byte("value")})
+		}
+		return payload
+	}
+	header := BatchHeader{LastOffsetDelta: 2, RecordsCount: 3}
+
+	for name, tc := range map[string]struct {
+		header  BatchHeader
+		payload []byte
+		index   int // Of the RecordError, -2 if the batch is valid
+	}{
+		"valid":                 {header, records(3), -2},
+		"too few records":       {BatchHeader{LastOffsetDelta: 3, RecordsCount: 4}, records(3), -1},
+		"too many records":      {BatchHeader{LastOffsetDelta: 1, RecordsCount: 2}, records(3), -1},
+		"wrong lastOffsetDelta": {BatchHeader{LastOffsetDelta: 5, RecordsCount: 3}, records(3), -1},
+		"no records":            {BatchHeader{LastOffsetDelta: -1}, nil, -1},
+		"truncated varint":      {header, append(records(2), 0x80), 2},
+		"record past batch":     {header, records(3)[:len(records(3))-1], 2},
+		"offset delta gap":      {header, AppendRecord(records(2), &Record{OffsetDelta: 5}), 2},
+		"key past record":       {header, append(records(2), 12, 0, 0, 4, 40, 'k', 'e'), 2}, // Length 6: attributes, deltas, key length 20 with 2 bytes left
+		"malformed headers":     {header, AppendRecord(records(2), &Record{OffsetDelta: 2, HeadersCount: 1, headersRaw: []byte{2}}), 2},
+	} {
+		err := (&RecordBatch{Header: tc.header, Payload: tc.payload}).Validate(0, 0)
+		if tc.index == -2 {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", name, err)
+			}
+			continue
+		}
+
+		var recErr *RecordError
+		if !errors.As(err, &recErr) || !errors.Is(err, ErrInvalidRecord) {
+			t.Errorf("%s: want a RecordError, got %v", name, err)
+			continue
+		}
+		if recErr.Index != tc.index {
+			t.Errorf("%s: want index %d, got %d (%v)", name, tc.index, recErr.Index, err)
+		}
+	}
+}
+
+func TestRecordBatch_ValidateTimestamps(t *testing.T) {
+	const now, maxDiff = 1_000_000, 1000
+	var payload []byte
+	for i, delta := range []int64{0, 500, 2500} {
+		payload = AppendRecord(payload, &Record{OffsetDelta: int32(i), TimestampDelta: delta, Value: []byte("value")})
+	}
+	batch := &RecordBatch{
+		Header:  BatchHeader{LastOffsetDelta: 2, RecordsCount: 3, BaseTimestamp: now - 500, MaxTimestamp: now},
+		Payload: payload,
+	}
+
+	// The last record is 2000 ms ahead of MaxTimestamp: only a record by record check catches it
+	if err := batch.Validate(now, maxDiff); !errors.Is(err, ErrInvalidTimestamp) {
+		t.Errorf("want ErrInvalidTimestamp, got %v", err)
+	}
+	if err := batch.Validate(now, 0); err != nil {
+		t.Errorf("Timestamps checked with maxTimestampDiffMs 0: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package partition
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// recoveryPointCheckpointFile stores the offset below which all data is durable.
+	recoveryPointCheckpointFile = "recovery-point-offset-checkpoint"
+	// logStartOffsetCheckpointFile stores the log start offset moved by DeleteRecordsBefore.
+	logStartOffsetCheckpointFile = "log-start-offset-checkpoint"
+	// cleanerOffsetCheckpointFile stores the offset up to which the log is compacted.
+	cleanerOffsetCheckpointFile = "cleaner-offset-checkpoint"
+	// cleanShutdownFile exists only while the partition is closed cleanly.
+	cleanShutdownFile = ".clean-shutdown"
+
+	checkpointVersion = 0
+)
+
+// writeCheckpoint atomically replaces path with "{version}\n{offset}\n". The directory
+// is synced after the rename, so a crash cannot bring the old checkpoint back.
+func writeCheckpoint(path string, offset int64) error {
+	tmpPath := path + ".tmp"
+
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, "%d\n%d\n", checkpointVersion, offset); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return renameSynced(tmpPath, path)
+}
+
+// readCheckpoint returns the offset stored in path. ok is false if the file does not exist.
+func readCheckpoint(path string) (offset int64, ok bool, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 || fields[0] != strconv.Itoa(checkpointVersion) {
+		return 0, false, fmt.Errorf("malformed checkpoint file %s", path)
+	}
+
+	offset, err = strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("malformed checkpoint file %s: %w", path, err)
+	}
+	return offset, true, nil
+}
@@ -0,0 +1,270 @@
+package partition
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"lightkafka/internal/message"
+	"lightkafka/internal/segment"
+)
+
+// cleanerDirName is the scratch directory (inside the partition directory)
+// where cleaned segments are written before they are swapped in.
+const cleanerDirName = ".cleaner"
+
+// startCompaction launches the log cleaner if cleanup.policy includes "compact".
+func (p *Partition) startCompaction() {
+	if !p.Config.compactEnabled() {
+		return
+	}
+
+	intervalMs := p.Config.CompactionIntervalMs
+	if intervalMs <= 0 {
+		intervalMs = defaultCompactionIntervalMs
+	}
+
+	p.schedule("compaction", time.Duration(intervalMs)*time.Millisecond, func() error {
+		_, err := p.Compact()
+		return err
+	})
+}
+
+// Compact rewrites the closed segments so that only the latest record per key
+// survives. Tombstones (null value) are dropped once they are older than
+// delete.retention.ms. Records without a key are always kept.
+// The active segment is never touched. It returns the number of cleaned segments.
+//
+// Only the segments written since the last pass (past cleanedUpTo) are scanned for
+// keys: older ones were compacted already and hold each key at most once. A pass
+// with no new segments and no expired tombstone does nothing.
+func (p *Partition) Compact() (int, error) {
+	p.cleanerMu.Lock()
+	defer p.cleanerMu.Unlock()
+
+	p.mu.RLock()
+	closed := p.closedSegments()
+	end := p.activeSegment.BaseOffset()
+	p.mu.RUnlock()
+
+	if len(closed) == 0 {
+		return 0, nil
+	}
+
+	// Dirty segments end past cleanedUpTo
+	dirty := closed[sort.Search(len(closed), func(i int) bool {
+		segmentEnd := end
+		if i+1 < len(closed) {
+			segmentEnd = closed[i+1]
+		}
+		return segmentEnd > p.cleanedUpTo
+	}):]
+	now := time.Now().UnixMilli()
+	if len(dirty) == 0 && now < p.nextTombstoneExpiry {
+		return 0, nil
+	}
+
+	// 1. Build the offset map: key -> offset of its latest record
+	offsetMap := make(map[string]int64)
+	for _, baseOffset := range dirty {
+		err := p.forEachRecord(baseOffset, func(rec *message.Record) {
+			if rec.Key != nil {
+				offsetMap[string(rec.Key)] = rec.Offset
+			}
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// 2. Rewrite each segment and swap it in
+	deleteRetentionMs := p.Config.DeleteRetentionMs
+	if deleteRetentionMs <= 0 {
+		deleteRetentionMs = defaultDeleteRetentionMs
+	}
+	tombstoneCutoff := now - deleteRetentionMs
+	nextTombstoneExpiry := int64(math.MaxInt64)
+
+	retain := func(rec *message.Record) bool {
+		if rec.Key == nil {
+			return true
+		}
+		if latest, ok := offsetMap[string(rec.Key)]; ok && latest != rec.Offset {
+			return false // Superseded by a newer record with the same key
+		}
+		if rec.Value == nil {
+			if rec.Timestamp < tombstoneCutoff {
+				return false
+			}
+			nextTombstoneExpiry = min(nextTombstoneExpiry, rec.Timestamp+deleteRetentionMs)
+		}
+		return true
+	}
+
+	cleaned := 0
+	for _, baseOffset := range closed {
+		ok, err := p.cleanSegment(baseOffset, retain)
+		if err != nil {
+			return cleaned, err
+		}
+		if ok {
+			cleaned++
+		}
+	}
+
+	p.nextTombstoneExpiry = nextTombstoneExpiry
+	if end > p.cleanedUpTo {
+		if err := p.storage.WriteCheckpoint(cleanerOffsetCheckpointFile, end); err != nil {
+			return cleaned, err
+		}
+		p.cleanedUpTo = end
+	}
+	return cleaned, nil
+}
+
+// openClosedSegment opens a private handle on a closed segment, or returns nil if
+// the segment has been deleted in the meantime. The cleaner does not go through the
+// shared cache so that eviction cannot unmap a segment while it is being scanned.
+// The caller must Release it.
+func (p *Partition) openClosedSegment(baseOffset int64) (segment.LogStore, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if !slices.Contains(p.closedSegments(), baseOffset) {
+		return nil, nil
+	}
+	return p.openSegment(baseOffset)
+}
+
+func (p *Partition) forEachRecord(baseOffset int64, fn func(rec *message.Record)) error {
+	seg, err := p.openClosedSegment(baseOffset)
+	if err != nil || seg == nil {
+		return err
+	}
+	defer seg.Release()
+
+	return seg.ForEachBatch(func(batch *message.RecordBatch) error {
+		var rec message.Record
+		it := batch.NewIterator()
+		for it.Next(&rec) {
+			fn(&rec)
+		}
+		return it.Err()
+	})
+}
+
+// cleanSegment copies the retained records of a segment into a new segment and
+// atomically replaces the original. Batches keep their BaseOffset and
+// LastOffsetDelta, so offsets of surviving records never change. Segments with
+// nothing to drop are left alone without writing anything.
+func (p *Partition) cleanSegment(baseOffset int64, retain func(rec *message.Record) bool) (bool, error) {
+	src, err := p.openClosedSegment(baseOffset)
+	if err != nil || src == nil {
+		return false, err
+	}
+	defer src.Release()
+
+	// 1. Look for superseded records and expired tombstones: a copy preallocates a
+	// whole segment, most segments of a compacted log have nothing to drop
+	dirty := false
+	err = src.ForEachBatch(func(batch *message.RecordBatch) error {
+		var rec message.Record
+		it := batch.NewIterator()
+		for it.Next(&rec) {
+			if !retain(&rec) {
+				dirty = true
+			}
+		}
+		return it.Err()
+	})
+	if err != nil || !dirty {
+		return false, err
+	}
+
+	// 2. Write the cleaned copy into the scratch directory
+	cleanDir := filepath.Join(p.Dir, cleanerDirName)
+	if err := os.RemoveAll(cleanDir); err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(cleanDir, 0755); err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(cleanDir)
+
+	dst, err := segment.NewSegment(cleanDir, baseOffset, p.Config.SegmentConfig)
+	if err != nil {
+		return false, err
+	}
+
+	removed := int64(0)
+	err = src.ForEachBatch(func(batch *message.RecordBatch) error {
+		var payload []byte
+		var kept int32
+
+		var rec message.Record
+		it := batch.NewIterator()
+		for it.Next(&rec) {
+			if retain(&rec) {
+				payload = message.AppendRecord(payload, &rec)
+				kept++
+			}
+		}
+		if err := it.Err(); err != nil {
+			return err
+		}
+
+		removed += int64(batch.Header.RecordsCount - kept)
+		if kept == 0 {
+			return nil
+		}
+
+		// The cleaned batch keeps the codec of the original
+		h := batch.Header
+		h.RecordsCount = kept
+		payload, err := message.Compress(h.Compression(), payload)
+		if err != nil {
+			return err
+		}
+		_, err = dst.Append(message.EncodeBatch(h, payload))
+		return err
+	})
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || removed == 0 {
+		return false, err // Nothing to drop: keep the original
+	}
+
+	// 3. Swap the cleaned files in
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !slices.Contains(p.closedSegments(), baseOffset) {
+		return false, nil // Deleted by retention while we were cleaning
+	}
+
+	p.cache.Remove(p.cacheKey(baseOffset))
+
+	// Drop the old indexes first: a crash between renames then leaves a log
+	// without indexes (rebuilt on open) instead of a log with stale indexes.
+	for _, suffix := range []string{segment.IndexFileSuffix, segment.TimeIndexFileSuffix} {
+		if err := os.Remove(segment.FilePath(p.Dir, baseOffset, suffix)); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+	for _, suffix := range []string{segment.LogFileSuffix, segment.IndexFileSuffix, segment.TimeIndexFileSuffix} {
+		if err := os.Rename(segment.FilePath(cleanDir, baseOffset, suffix), segment.FilePath(p.Dir, baseOffset, suffix)); err != nil {
+			return false, err
+		}
+	}
+	if err := syncPath(p.Dir); err != nil {
+		return false, p.checkStorage(fmt.Errorf("%w: sync %s: %w", segment.ErrStorage, p.Dir, err))
+	}
+
+	fmt.Printf("[Partition %d] Compacted segment %d: removed %d records\n", p.ID, baseOffset, removed)
+	return true, nil
+}
@@ -0,0 +1,123 @@
+package partition
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"lightkafka/internal/client"
+	"lightkafka/internal/segment"
+)
+
+func buildBatch(kvs ...[]byte) []byte {
+	builder := client.NewRecordBatchBuilder()
+	for i := 0; i+1 < len(kvs); i += 2 {
+		builder.Add(kvs[i], kvs[i+1])
+	}
+	return builder.Build()
+}
+
+// readAll fetches every record from offset 0 to the log end as "offset:key=value" pairs.
+func readAll(t *testing.T, p *Partition) map[int64]string {
+	t.Helper()
+
+	records := make(map[int64]string)
+	offset := p.LogStartOffset()
+	for offset < p.LogEndOffset() {
+		data, err := readBytes(p, offset, 1024*1024)
+		if err != nil {
+			t.Fatalf("Read(%d) failed: %v", offset, err)
+		}
+		if len(data) == 0 {
+			break
+		}
+
+		for len(data) > 0 {
+			parsed, err := client.DecodeBatch(data)
+			if err != nil {
+				t.Fatalf("DecodeBatch failed: %v", err)
+			}
+			for _, r := range parsed {
+				records[r.Offset] = r.Key + "=" + r.Value
+			}
+			// Continue after the batch's offset range (LastOffsetDelta survives compaction)
+			baseOffset := int64(binary.BigEndian.Uint64(data[0:8]))
+			batchLen := binary.BigEndian.Uint32(data[8:12])
+			lastOffsetDelta := int32(binary.BigEndian.Uint32(data[23:27]))
+			offset = baseOffset + int64(lastOffsetDelta) + 1
+			data = data[12+batchLen:]
+		}
+	}
+	return records
+}
+
+func TestPartition_Compact(t *testing.T) {
+	p := newTestPartition(t, PartitionConfig{
+		SegmentConfig:     segment.Config{SegmentMaxBytes: 100},
+		CleanupPolicy:     CleanupPolicyCompact,
+		DeleteRetentionMs: 1,
+	})
+
+	// Each batch fills its own segment; the last one stays active.
+	batches := [][]byte{
+		buildBatch([]byte("k1"), []byte("a"), []byte("k2"), []byte("b")), // 0, 1
+		buildBatch([]byte("k1"), []byte("c")),                            // 2
+		buildBatch([]byte("k2"), nil),                                    // 3 (tombstone)
+		buildBatch(nil, []byte("no-key")),                                // 4
+		buildBatch([]byte("k1"), []byte("d")),                            // 5 (active)
+	}
+	for _, b := range batches {
+		if _, err := p.Append(b); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	if len(p.Segments) != len(batches) {
+		t.Fatalf("Expected %d segments, got %v", len(batches), p.Segments)
+	}
+
+	time.Sleep(5 * time.Millisecond) // Let the tombstone expire
+
+	if cleaned, err := p.Compact(); err != nil || cleaned != 2 {
+		t.Fatalf("Compact: want segments 0 and 3 cleaned, got %d (err: %v)", cleaned, err)
+	}
+
+	want := map[int64]string{
+		2: "k1=c",    // latest k1 among closed segments
+		4: "=no-key", // records without a key are kept
+		5: "k1=d",    // active segment is untouched
+	}
+	got := readAll(t, p)
+	if len(got) != len(want) {
+		t.Fatalf("Records mismatch after compaction. Want %v, Got %v", want, got)
+	}
+	for offset, kv := range want {
+		if got[offset] != kv {
+			t.Errorf("Offset %d: want %q, got %q", offset, kv, got[offset])
+		}
+	}
+
+	if p.LogEndOffset() != 6 {
+		t.Errorf("LogEndOffset changed by compaction: %d", p.LogEndOffset())
+	}
+
+	// Nothing new: the compacted segments are neither rescanned nor rewritten
+	if cleaned, err := p.Compact(); err != nil || cleaned != 0 {
+		t.Errorf("Compact without new segments: want 0 cleaned, got %d (err: %v)", cleaned, err)
+	}
+
+	// Rolling k1=d out of the active segment supersedes k1=c in the clean part
+	if _, err := p.Append(buildBatch([]byte("k1"), []byte("e"))); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if cleaned, err := p.Compact(); err != nil || cleaned != 1 {
+		t.Errorf("Compact of a new segment: want 1 cleaned, got %d (err: %v)", cleaned, err)
+	}
+	got = readAll(t, p)
+	if _, ok := got[2]; ok || got[5] != "k1=d" || got[6] != "k1=e" {
+		t.Errorf("Records mismatch after second compaction: %v", got)
+	}
+	if offset, _, _ := readCheckpoint(filepath.Join(p.Dir, cleanerOffsetCheckpointFile)); offset != 6 {
+		t.Errorf("Cleaner checkpoint mismatch. Want 6, Got %d", offset)
+	}
+}
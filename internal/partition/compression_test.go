@@ -0,0 +1,61 @@
+package partition
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"lightkafka/internal/client"
+	"lightkafka/internal/message"
+	"lightkafka/internal/segment"
+)
+
+func TestPartition_CompressedBatches(t *testing.T) {
+	p := newTestPartition(t, PartitionConfig{SegmentConfig: segment.Config{SegmentMaxBytes: 4096}})
+
+	codecs := []string{"none", "gzip", "snappy", "lz4", "zstd"}
+	for i, codec := range codecs {
+		builder := client.NewRecordBatchBuilder()
+		if err := builder.SetCompression(codec); err != nil {
+			t.Fatalf("SetCompression(%s) failed: %v", codec, err)
+		}
+		builder.Add([]byte(codec), []byte(fmt.Sprintf("value-%d", i)))
+		builder.Add([]byte(codec), []byte(fmt.Sprintf("value-%d", i)))
+		if _, err := p.Append(builder.Build()); err != nil {
+			t.Fatalf("Append(%s) failed: %v", codec, err)
+		}
+	}
+
+	got := readAll(t, p)
+	for i, codec := range codecs {
+		for _, offset := range []int64{int64(2 * i), int64(2*i + 1)} {
+			if want := fmt.Sprintf("%s=value-%d", codec, i); got[offset] != want {
+				t.Errorf("Offset %d: want %q, got %q", offset, want, got[offset])
+			}
+		}
+	}
+
+	// Batches consumers could not read are rejected
+	builder := client.NewRecordBatchBuilder()
+	builder.SetCompression("zstd")
+	builder.Add([]byte("k"), []byte("v"))
+	batch, err := message.DecodeBatch(builder.Build())
+	if err != nil {
+		t.Fatalf("DecodeBatch failed: %v", err)
+	}
+
+	corrupt := append([]byte(nil), batch.Payload...)
+	corrupt[len(corrupt)/2] ^= 0xFF
+	if _, err := p.Append(message.EncodeBatch(batch.Header, corrupt)); !errors.Is(err, message.ErrCorruptCompressed) {
+		t.Errorf("Append of corrupt zstd batch: want ErrCorruptCompressed, got %v", err)
+	}
+
+	h := batch.Header
+	h.Attributes = 5
+	if _, err := p.Append(message.EncodeBatch(h, batch.Payload)); !errors.Is(err, message.ErrUnsupportedCompression) {
+		t.Errorf("Append with codec 5: want ErrUnsupportedCompression, got %v", err)
+	}
+	if p.LogEndOffset() != int64(2*len(codecs)) {
+		t.Errorf("LogEndOffset after rejected batches: %d", p.LogEndOffset())
+	}
+}
@@ -1,7 +1,142 @@
 package partition
 
-import "lightkafka/internal/segment"
+import (
+	"fmt"
+	"strings"
+
+	"lightkafka/internal/remote"
+	"lightkafka/internal/resource"
+	"lightkafka/internal/segment"
+)
+
+// Cleanup policies (cleanup.policy). They can be combined, e.g. "compact,delete".
+const (
+	CleanupPolicyDelete  = "delete"
+	CleanupPolicyCompact = "compact"
+)
+
+// Timestamp types (message.timestamp.type).
+const (
+	TimestampTypeCreateTime    = "CreateTime"
+	TimestampTypeLogAppendTime = "LogAppendTime"
+)
 
 type PartitionConfig struct {
 	SegmentConfig segment.Config
+
+	// LogStorage selects the storage engine: "mmap" (default) keeps segments in mmap'ed
+	// files, "memory" keeps them on the heap and never touches disk (e.g. tests).
+	LogStorage string
+
+	// SegmentMaxAgeMs rolls the active segment once its first batch is older than this (segment.ms).
+	// <= 0 rolls only when the segment is full.
+	SegmentMaxAgeMs int64
+
+	// Retention (whole closed segments are deleted; <= 0 disables the limit)
+	RetentionMs              int64 // retention.ms, e.g., 7 days
+	RetentionBytes           int64 // retention.bytes, e.g., 1GB
+	RetentionCheckIntervalMs int64 // e.g., 5 minutes
+
+	// Compaction
+	CleanupPolicy        string // cleanup.policy, "delete" (default), "compact" or "compact,delete"
+	DeleteRetentionMs    int64  // delete.retention.ms, how long tombstones survive compaction, e.g., 1 day
+	CompactionIntervalMs int64  // e.g., 30 seconds
+
+	// MaxMessageBytes is the largest batch accepted from producers, compressed (max.message.bytes).
+	// <= 0 accepts any batch that fits in a segment.
+	MaxMessageBytes int64
+
+	// Timestamps
+	TimestampType      string // message.timestamp.type, "CreateTime" (default) keeps the producer's, "LogAppendTime" stamps broker time
+	MaxTimestampDiffMs int64  // message.timestamp.difference.max.ms, how far CreateTime may be from broker time; <= 0 disables the check
+
+	// Durability (flush.messages lives in SegmentConfig.FlushIntervalMessages)
+	FlushIntervalMs int64 // flush.ms, background flush period; <= 0 disables the flusher
+
+	// Tiered Storage (a nil RemoteStorage disables tiering)
+	RemoteStorage     remote.RemoteStorage       // Where sealed segments are copied
+	RemoteFetchCache  *resource.RemoteFetchCache // Local copies of segments read back from RemoteStorage
+	LocalRetentionMs  int64                      // local.retention.ms, how long uploaded segments stay on local disk, e.g., 1 hour
+	TieringIntervalMs int64                      // e.g., 30 seconds
+
+	// LogDir tracks the health of baseDir and is shared by the partitions stored there.
+	// nil creates one for this partition; memory storage never uses one.
+	LogDir *resource.LogDir
+}
+
+const (
+	defaultRetentionCheckIntervalMs = 5 * 60 * 1000
+	defaultDeleteRetentionMs        = 24 * 60 * 60 * 1000
+	defaultCompactionIntervalMs     = 30 * 1000
+	defaultRollCheckIntervalMs      = 60 * 1000
+	defaultTieringIntervalMs        = 30 * 1000
+)
+
+func (c PartitionConfig) validate() error {
+	if err := c.SegmentConfig.Validate(); err != nil {
+		return err
+	}
+	switch c.LogStorage {
+	case "", LogStorageMmap:
+	case LogStorageMemory:
+		// Both work on segment files: the cleaner swaps them, tiering uploads them
+		if c.compactEnabled() || c.RemoteStorage != nil {
+			return fmt.Errorf("%w: memory storage cannot be used with compaction or tiered storage", ErrInvalidConfig)
+		}
+	default:
+		return fmt.Errorf("%w: unknown log storage %q", ErrInvalidConfig, c.LogStorage)
+	}
+	for _, policy := range strings.Split(c.CleanupPolicy, ",") {
+		switch strings.TrimSpace(policy) {
+		case "", CleanupPolicyDelete, CleanupPolicyCompact:
+		default:
+			return fmt.Errorf("%w: unknown cleanup.policy %q", ErrInvalidConfig, policy)
+		}
+	}
+	switch c.TimestampType {
+	case "", TimestampTypeCreateTime, TimestampTypeLogAppendTime:
+	default:
+		return fmt.Errorf("%w: unknown message.timestamp.type %q", ErrInvalidConfig, c.TimestampType)
+	}
+	if c.RemoteStorage != nil {
+		if c.RemoteFetchCache == nil {
+			return fmt.Errorf("%w: tiered storage requires a RemoteFetchCache", ErrInvalidConfig)
+		}
+		// Compaction rewrites closed segments in place, which would leave stale remote copies
+		if c.compactEnabled() {
+			return fmt.Errorf("%w: tiered storage cannot be used with cleanup.policy=compact", ErrInvalidConfig)
+		}
+	}
+	return nil
+}
+
+func (c PartitionConfig) hasCleanupPolicy(policy string) bool {
+	for _, p := range strings.Split(c.CleanupPolicy, ",") {
+		if strings.TrimSpace(p) == policy {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteEnabled reports whether retention applies. It is the default policy.
+func (c PartitionConfig) deleteEnabled() bool {
+	return strings.TrimSpace(c.CleanupPolicy) == "" || c.hasCleanupPolicy(CleanupPolicyDelete)
+}
+
+func (c PartitionConfig) compactEnabled() bool {
+	return c.hasCleanupPolicy(CleanupPolicyCompact)
+}
+
+func (c PartitionConfig) logAppendTime() bool {
+	return c.TimestampType == TimestampTypeLogAppendTime
+}
+
+// maxBatchBytes returns the size limit of produced batches. A batch never spans segments,
+// so SegmentMaxBytes bounds it in any case.
+func (c PartitionConfig) maxBatchBytes() int64 {
+	if c.MaxMessageBytes > 0 && c.MaxMessageBytes < c.SegmentConfig.SegmentMaxBytes {
+		return c.MaxMessageBytes
+	}
+	return c.SegmentConfig.SegmentMaxBytes
 }
@@ -0,0 +1,69 @@
+package partition
+
+import (
+	"fmt"
+
+	"lightkafka/internal/segment"
+)
+
+// DeleteRecordsBefore makes every offset below offset unreadable and deletes the
+// segments that lie entirely below it. The new log start offset is checkpointed
+// before any file is removed, so a crash cannot bring the records back.
+// It returns the resulting log start offset (the low watermark).
+func (p *Partition) DeleteRecordsBefore(offset int64) (_ int64, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.logDir.Load().Err(); err != nil {
+		return 0, err
+	}
+	defer func() { p.checkStorage(err) }()
+
+	if offset < 0 || offset > p.activeSegment.NextOffset() {
+		return 0, segment.ErrOffsetOutOfRange
+	}
+	if offset <= p.logStartOffset {
+		return p.logStartOffset, nil
+	}
+
+	if err := p.storage.WriteCheckpoint(logStartOffsetCheckpointFile, offset); err != nil {
+		return 0, err
+	}
+
+	if err := p.deleteSegmentsBefore(offset); err != nil {
+		return 0, err
+	}
+
+	fmt.Printf("[Partition %d] Deleted records before %d\n", p.ID, offset)
+	return p.logStartOffset, nil
+}
+
+// deleteSegmentsBefore moves the log start offset to offset and deletes every closed
+// segment whose records are all below it. Callers must hold p.mu.
+func (p *Partition) deleteSegmentsBefore(offset int64) error {
+	for {
+		end, ok := p.oldestSegmentEnd()
+		if !ok || end > offset {
+			break
+		}
+		if err := p.deleteOldestSegment(); err != nil {
+			return err
+		}
+	}
+
+	p.logStartOffset = max(p.logStartOffset, offset)
+	return nil
+}
+
+// oldestSegmentEnd returns the first offset after the oldest deletable segment.
+// ok is false if only the active segment is left. Callers must hold p.mu.
+func (p *Partition) oldestSegmentEnd() (int64, bool) {
+	if remoteOnly := p.remoteOnlySegments(); len(remoteOnly) > 0 {
+		return remoteOnly[0].NextOffset, true
+	}
+	// A local segment ends where the next one begins; the active segment is never deleted.
+	if len(p.Segments) > 1 {
+		return p.Segments[1], true
+	}
+	return 0, false
+}
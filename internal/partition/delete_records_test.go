@@ -0,0 +1,82 @@
+package partition
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"lightkafka/internal/resource"
+	"lightkafka/internal/segment"
+)
+
+func TestPartition_DeleteRecordsBefore(t *testing.T) {
+	dir := t.TempDir()
+	cache := resource.NewSegmentCache(10)
+	defer cache.Close()
+
+	c := PartitionConfig{SegmentConfig: segment.Config{
+		SegmentMaxBytes:    200,
+		IndexMaxBytes:      1024,
+		IndexIntervalBytes: 4096,
+	}}
+
+	p, err := NewPartition(dir, "test", 0, c, cache)
+	if err != nil {
+		t.Fatalf("Failed to create partition: %v", err)
+	}
+
+	// 4 batches -> Segments [0, 5, 10, 15]
+	for i := 0; i < 4; i++ {
+		if _, err := p.Append(createBatchBytes(5, time.Now().UnixMilli(), make([]byte, 100))); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	if _, err := p.DeleteRecordsBefore(p.LogEndOffset() + 1); !errors.Is(err, segment.ErrOffsetOutOfRange) {
+		t.Errorf("Delete beyond log end should be out of range, got %v", err)
+	}
+
+	// 12 falls inside segment [10]: segments [0] and [5] go, [10] stays
+	lowWatermark, err := p.DeleteRecordsBefore(12)
+	if err != nil {
+		t.Fatalf("DeleteRecordsBefore failed: %v", err)
+	}
+	if lowWatermark != 12 || p.LogStartOffset() != 12 {
+		t.Errorf("Low watermark mismatch. Want 12, Got %d (LogStartOffset %d)", lowWatermark, p.LogStartOffset())
+	}
+	for _, base := range []int64{0, 5} {
+		if _, err := os.Stat(segment.FilePath(p.Dir, base, segment.LogFileSuffix)); !os.IsNotExist(err) {
+			t.Errorf("Segment %d should be deleted (err: %v)", base, err)
+		}
+	}
+	if _, err := readBytes(p, 11, 1024); !errors.Is(err, segment.ErrOffsetOutOfRange) {
+		t.Errorf("Read below log start should be out of range, got %v", err)
+	}
+	if data, err := readBytes(p, 12, 1024); err != nil || len(data) == 0 {
+		t.Errorf("Read at log start failed. Len: %d, Err: %v", len(data), err)
+	}
+
+	// Moving backwards is a no-op
+	if lowWatermark, err := p.DeleteRecordsBefore(3); err != nil || lowWatermark != 12 {
+		t.Errorf("Delete below log start should keep 12, got %d (err: %v)", lowWatermark, err)
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Reopen: the log start offset survives even though segment [10] still starts at 10
+	p, err = NewPartition(dir, "test", 0, c, cache)
+	if err != nil {
+		t.Fatalf("Failed to reopen partition: %v", err)
+	}
+	defer p.Close()
+
+	if p.LogStartOffset() != 12 {
+		t.Errorf("Reopened LogStartOffset mismatch. Want 12, Got %d", p.LogStartOffset())
+	}
+	if _, err := readBytes(p, 10, 1024); !errors.Is(err, segment.ErrOffsetOutOfRange) {
+		t.Errorf("Read below restored log start should be out of range, got %v", err)
+	}
+}
@@ -1 +1,10 @@
 package partition
+
+import "errors"
+
+var (
+	ErrInvalidConfig    = errors.New("invalid partition configuration")
+	ErrUnknownPartition = errors.New("unknown partition")
+	ErrUnknownLogDir    = errors.New("unknown log directory")
+	ErrNoOnlineLogDir   = errors.New("no online log directory")
+)
@@ -0,0 +1,27 @@
+package partition
+
+import (
+	"errors"
+
+	"lightkafka/internal/segment"
+)
+
+// Disk health: the first I/O error from the segment files (segment.ErrStorage) takes the
+// partition's log directory offline (see resource.LogDir). From then on reads and writes
+// fail with resource.ErrLogDirOffline, background tasks stop touching the files, and
+// Close does not mark a clean shutdown, so the next start re-validates the log.
+
+// checkStorage takes the log directory offline if err is an I/O error. It returns err.
+func (p *Partition) checkStorage(err error) error {
+	if errors.Is(err, segment.ErrStorage) {
+		p.logDir.Load().MarkOffline(err)
+	}
+	return err
+}
+
+// rollSpace is the disk space a new segment may take once full: the log and both indexes.
+// Rolling is refused unless that much is free, so a segment never fills the disk halfway.
+func (p *Partition) rollSpace() int64 {
+	c := p.Config.SegmentConfig
+	return c.SegmentMaxBytes + 2*c.IndexMaxBytes
+}
@@ -0,0 +1,362 @@
+package partition
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"lightkafka/internal/resource"
+	"lightkafka/internal/segment"
+)
+
+// Placement policies for new partitions (LogManagerConfig.Placement).
+const (
+	PlacementFewestPartitions = "partitions"
+	PlacementMostFreeSpace    = "free-space"
+)
+
+type LogManagerConfig struct {
+	// LogDirs are the directories partitions are spread over (log.dirs), usually one per disk.
+	LogDirs []string
+
+	// Placement picks the directory of a new partition: "partitions" (default) takes the one
+	// holding the fewest partitions, "free-space" the one with the most free space.
+	Placement string
+}
+
+func (c LogManagerConfig) validate() error {
+	if len(c.LogDirs) == 0 {
+		return fmt.Errorf("%w: no log directories", ErrInvalidConfig)
+	}
+	seen := make(map[string]bool)
+	for _, dir := range c.LogDirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("%w: log directory %q: %v", ErrInvalidConfig, dir, err)
+		}
+		if seen[abs] {
+			return fmt.Errorf("%w: log directory %q listed twice", ErrInvalidConfig, dir)
+		}
+		seen[abs] = true
+	}
+	switch c.Placement {
+	case "", PlacementFewestPartitions, PlacementMostFreeSpace:
+	default:
+		return fmt.Errorf("%w: unknown placement %q", ErrInvalidConfig, c.Placement)
+	}
+	return nil
+}
+
+// LogManager owns the partitions of a broker spread over several log directories (JBOD).
+// Every directory is locked while the manager is open and has its own health: an I/O
+// error takes only the partitions on that disk offline.
+type LogManager struct {
+	mu         sync.Mutex
+	config     LogManagerConfig
+	partConfig PartitionConfig
+	cache      *resource.SegmentCache
+
+	dirs       []*managedLogDir
+	partitions map[string]*Partition // By directory name, {topic}-{id}
+	// offline holds the partitions that could not be opened, by the directory they are
+	// stuck in. They are not created again elsewhere.
+	offline map[string]*managedLogDir
+}
+
+type managedLogDir struct {
+	*resource.LogDir
+	lock *resource.DirLock
+}
+
+// NewLogManager locks the log directories, completes moves interrupted by a crash and
+// opens every partition found in them. c.LogDir is set per partition and ignored here.
+func NewLogManager(c LogManagerConfig, pc PartitionConfig, resCache *resource.SegmentCache) (*LogManager, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	m := &LogManager{
+		config:     c,
+		partConfig: pc,
+		cache:      resCache,
+		partitions: make(map[string]*Partition),
+		offline:    make(map[string]*managedLogDir),
+	}
+	opened := false
+	defer func() {
+		if !opened {
+			m.Close()
+		}
+	}()
+
+	for _, path := range c.LogDirs {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return nil, err
+		}
+		// Exclusive Lock: a second broker on the same disk would corrupt the mmap'ed logs
+		lock, err := resource.LockDir(path)
+		if err != nil {
+			return nil, err
+		}
+		m.dirs = append(m.dirs, &managedLogDir{LogDir: resource.NewLogDir(path), lock: lock})
+	}
+
+	if err := m.recoverMoves(); err != nil {
+		return nil, err
+	}
+	if err := m.loadPartitions(); err != nil {
+		return nil, err
+	}
+
+	opened = true
+	return m, nil
+}
+
+// loadPartitions opens every partition directory found in the log directories. A
+// partition that fails to open takes its log directory offline, like an I/O error at
+// runtime, and the broker starts with the other directories.
+func (m *LogManager) loadPartitions() error {
+	found := make(map[string]string) // Partition name -> log directory
+	for _, d := range m.dirs {
+		entries, err := os.ReadDir(d.Path)
+		if err != nil {
+			d.MarkOffline(fmt.Errorf("%w: list %s: %w", segment.ErrStorage, d.Path, err))
+			fmt.Printf("[LogManager] %s is offline: %v\n", d.Path, err)
+			continue
+		}
+
+		for _, entry := range entries {
+			topic, id, ok := parsePartitionDirName(entry.Name())
+			if !entry.IsDir() || !ok {
+				continue
+			}
+			if other, dup := found[entry.Name()]; dup {
+				return fmt.Errorf("partition %s found in both %s and %s", entry.Name(), other, d.Path)
+			}
+			found[entry.Name()] = d.Path
+
+			if _, err := m.openPartition(d, topic, id); err != nil {
+				if d.Err() == nil {
+					d.MarkOffline(fmt.Errorf("open partition %s: %w", entry.Name(), err))
+					fmt.Printf("[LogManager] %s is offline: cannot open partition %s: %v\n", d.Path, entry.Name(), err)
+				}
+				m.offline[entry.Name()] = d
+			}
+		}
+	}
+
+	fmt.Printf("[LogManager] Loaded %d partitions from %d log directories (%d offline)\n", len(m.partitions), len(m.dirs), len(m.offline))
+	return nil
+}
+
+// recoverMoves finishes or rolls back moves interrupted by a crash (see moveTo). A complete
+// copy exists once the original was renamed to .delete, so the copy wins in that case.
+// Otherwise the copy is incomplete and dropped.
+func (m *LogManager) recoverMoves() error {
+	exists := make(map[string]bool) // Partition directories and leftovers by name
+	for _, d := range m.dirs {
+		entries, err := os.ReadDir(d.Path)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				exists[entry.Name()] = true
+			}
+		}
+	}
+
+	for _, d := range m.dirs {
+		entries, err := os.ReadDir(d.Path)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			path := filepath.Join(d.Path, entry.Name())
+
+			if name, ok := strings.CutSuffix(entry.Name(), futureDirSuffix); ok && entry.IsDir() {
+				if !exists[name] && exists[name+deleteDirSuffix] {
+					fmt.Printf("[LogManager] Completing move of %s to %s\n", name, d.Path)
+					if err := renameSynced(path, filepath.Join(d.Path, name)); err != nil {
+						return err
+					}
+					exists[name] = true
+					continue
+				}
+				if err := os.RemoveAll(path); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, d := range m.dirs {
+		entries, err := os.ReadDir(d.Path)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			path := filepath.Join(d.Path, entry.Name())
+
+			if name, ok := strings.CutSuffix(entry.Name(), deleteDirSuffix); ok && entry.IsDir() {
+				if !exists[name] {
+					// The copy is gone: keep the original rather than lose the partition
+					fmt.Printf("[LogManager] Restoring %s in %s\n", name, d.Path)
+					if err := renameSynced(path, filepath.Join(d.Path, name)); err != nil {
+						return err
+					}
+					exists[name] = true
+					continue
+				}
+				if err := os.RemoveAll(path); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Partition returns an open partition.
+func (m *LogManager) Partition(topic string, id int) (*Partition, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.partitions[partitionDirName(topic, id)]
+	return p, ok
+}
+
+// GetOrCreate returns the partition, creating it in the log directory picked by the
+// placement policy if it does not exist yet.
+func (m *LogManager) GetOrCreate(topic string, id int) (*Partition, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if p, ok := m.partitions[partitionDirName(topic, id)]; ok {
+		return p, nil
+	}
+	if d, ok := m.offline[partitionDirName(topic, id)]; ok {
+		return nil, d.Err()
+	}
+
+	d, err := m.place()
+	if err != nil {
+		return nil, err
+	}
+	return m.openPartition(d, topic, id)
+}
+
+// openPartition opens (or creates) a partition in d. Callers must hold m.mu.
+func (m *LogManager) openPartition(d *managedLogDir, topic string, id int) (*Partition, error) {
+	c := m.partConfig
+	c.LogDir = d.LogDir
+
+	p, err := NewPartition(d.Path, topic, id, c, m.cache)
+	if err != nil {
+		return nil, err
+	}
+	m.partitions[partitionDirName(topic, id)] = p
+	return p, nil
+}
+
+// place picks the online log directory for a new partition. Ties go to the directory
+// listed first. Callers must hold m.mu.
+func (m *LogManager) place() (*managedLogDir, error) {
+	counts := make(map[*resource.LogDir]int64)
+	for _, p := range m.partitions {
+		counts[p.LogDir()]++
+	}
+
+	var best *managedLogDir
+	var bestScore int64
+	for _, d := range m.dirs {
+		if d.Err() != nil {
+			continue
+		}
+
+		score := -counts[d.LogDir]
+		if m.config.Placement == PlacementMostFreeSpace {
+			free, err := d.FreeBytes()
+			if err != nil {
+				fmt.Printf("[LogManager] Skipping %s: %v\n", d.Path, err)
+				continue
+			}
+			score = free
+		}
+
+		if best == nil || score > bestScore {
+			best, bestScore = d, score
+		}
+	}
+
+	if best == nil {
+		return nil, ErrNoOnlineLogDir
+	}
+	return best, nil
+}
+
+// Move relocates a partition to another log directory while it keeps serving.
+// Appends to it pause only while the files changed during the copy are copied again.
+func (m *LogManager) Move(topic string, id int, logDir string) error {
+	m.mu.Lock()
+	p, ok := m.partitions[partitionDirName(topic, id)]
+	d := m.dir(logDir)
+	m.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownPartition, partitionDirName(topic, id))
+	}
+	if d == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownLogDir, logDir)
+	}
+	return p.moveTo(d.Path, d.LogDir)
+}
+
+// dir returns the managed log directory at path, nil if there is none.
+func (m *LogManager) dir(path string) *managedLogDir {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil
+	}
+	for _, d := range m.dirs {
+		if dAbs, err := filepath.Abs(d.Path); err == nil && dAbs == abs {
+			return d
+		}
+	}
+	return nil
+}
+
+// Close closes every partition and releases the log directories.
+func (m *LogManager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var errs []error
+	for name, p := range m.partitions {
+		errs = append(errs, p.Close())
+		delete(m.partitions, name)
+	}
+	for _, d := range m.dirs {
+		errs = append(errs, d.lock.Unlock())
+	}
+	m.dirs = nil
+	return errors.Join(errs...)
+}
+
+// parsePartitionDirName splits "{topic}-{id}". Topics may contain '-', ids may not.
+func parsePartitionDirName(name string) (string, int, bool) {
+	i := strings.LastIndexByte(name, '-')
+	if i <= 0 {
+		return "", 0, false
+	}
+	id, err := strconv.Atoi(name[i+1:])
+	if err != nil || id < 0 {
+		return "", 0, false
+	}
+	return name[:i], id, true
+}
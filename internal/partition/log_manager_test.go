@@ -0,0 +1,211 @@
+package partition
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"lightkafka/internal/resource"
+	"lightkafka/internal/segment"
+)
+
+func newTestLogManager(t *testing.T, dirs []string) *LogManager {
+	t.Helper()
+
+	cache := resource.NewSegmentCache(10)
+	t.Cleanup(func() { cache.Close() })
+
+	m, err := NewLogManager(LogManagerConfig{LogDirs: dirs}, PartitionConfig{
+		SegmentConfig: segment.Config{
+			SegmentMaxBytes:    300,
+			IndexMaxBytes:      1024,
+			IndexIntervalBytes: 4096,
+		},
+	}, cache)
+	if err != nil {
+		t.Fatalf("Failed to create log manager: %v", err)
+	}
+	return m
+}
+
+func TestLogManager_PlacementAndDiscovery(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	m := newTestLogManager(t, dirs)
+
+	placed := make(map[int]string)
+	for id := range 4 {
+		p, err := m.GetOrCreate("events", id)
+		if err != nil {
+			t.Fatalf("GetOrCreate(%d) failed: %v", id, err)
+		}
+		placed[id] = p.LogDir().Path
+	}
+	// Fewest partitions: the directories take turns
+	for id, dir := range placed {
+		if want := dirs[id%2]; dir != want {
+			t.Errorf("Partition %d placed in %s, want %s", id, dir, want)
+		}
+	}
+	m.Close()
+
+	// A new manager finds every partition where it was placed
+	m = newTestLogManager(t, dirs)
+	defer m.Close()
+	for id, dir := range placed {
+		p, ok := m.Partition("events", id)
+		if !ok {
+			t.Fatalf("Partition %d not discovered", id)
+		}
+		if p.LogDir().Path != dir {
+			t.Errorf("Partition %d discovered in %s, want %s", id, p.LogDir().Path, dir)
+		}
+	}
+}
+
+func TestLogManager_MoveOnline(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	m := newTestLogManager(t, []string{src, dst})
+
+	p, err := m.GetOrCreate("events", 0)
+	if err != nil {
+		t.Fatalf("GetOrCreate failed: %v", err)
+	}
+	for range 10 {
+		if _, err := p.Append(createBatchBytes(5, time.Now().UnixMilli(), make([]byte, 50))); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	// Appends keep going while the partition moves
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 20 {
+			if _, err := p.Append(createBatchBytes(5, time.Now().UnixMilli(), make([]byte, 50))); err != nil {
+				t.Errorf("Append during move failed: %v", err)
+				return
+			}
+		}
+	}()
+	if err := m.Move("events", 0, dst); err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	wg.Wait()
+
+	if p.LogDir().Path != dst {
+		t.Errorf("LogDir after move: %s, want %s", p.LogDir().Path, dst)
+	}
+	if _, err := os.Stat(filepath.Join(src, "events-0")); !os.IsNotExist(err) {
+		t.Errorf("Source directory still exists after move")
+	}
+	for offset := int64(0); offset < 150; offset += 5 {
+		if data, err := readBytes(p, offset, 1); err != nil || len(data) == 0 {
+			t.Fatalf("Read(%d) after move failed. Len: %d, Err: %v", offset, len(data), err)
+		}
+	}
+	m.Close()
+
+	m = newTestLogManager(t, []string{src, dst})
+	defer m.Close()
+	p, ok := m.Partition("events", 0)
+	if !ok || p.LogDir().Path != dst {
+		t.Fatalf("Moved partition not discovered in %s", dst)
+	}
+	if p.LogEndOffset() != 150 {
+		t.Errorf("LogEndOffset after reopen: %d, want 150", p.LogEndOffset())
+	}
+}
+
+func TestLogManager_RecoverInterruptedMove(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	m := newTestLogManager(t, []string{src, dst})
+	p, err := m.GetOrCreate("events", 0)
+	if err != nil {
+		t.Fatalf("GetOrCreate failed: %v", err)
+	}
+	for range 10 {
+		if _, err := p.Append(createBatchBytes(5, time.Now().UnixMilli(), make([]byte, 50))); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	m.Close()
+
+	// Crash between the two renames: the complete copy is still .future, the original .delete
+	srcDir := filepath.Join(src, "events-0")
+	future := filepath.Join(dst, "events-0"+futureDirSuffix)
+	if err := os.Mkdir(future, 0755); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+	if err := syncDir(srcDir, future, make(map[string]fileStamp)); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+	if err := os.Rename(srcDir, srcDir+deleteDirSuffix); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	// And an abandoned copy of another partition
+	if err := os.Mkdir(filepath.Join(src, "events-1"+futureDirSuffix), 0755); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+
+	m = newTestLogManager(t, []string{src, dst})
+	defer m.Close()
+
+	p, ok := m.Partition("events", 0)
+	if !ok || p.LogDir().Path != dst {
+		t.Fatalf("Interrupted move not completed to %s", dst)
+	}
+	if p.LogEndOffset() != 50 {
+		t.Errorf("LogEndOffset after recovery: %d, want 50", p.LogEndOffset())
+	}
+	for _, leftover := range []string{srcDir + deleteDirSuffix, filepath.Join(src, "events-1"+futureDirSuffix)} {
+		if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+			t.Errorf("%s not cleaned up", leftover)
+		}
+	}
+	if _, ok := m.Partition("events", 1); ok {
+		t.Errorf("Abandoned copy loaded as a partition")
+	}
+}
+
+func TestLogManager_PartitionFailsToOpen(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	m := newTestLogManager(t, dirs)
+	for id := range 2 {
+		if _, err := m.GetOrCreate("events", id); err != nil {
+			t.Fatalf("GetOrCreate(%d) failed: %v", id, err)
+		}
+	}
+	m.Close()
+
+	// events-0 (on the first directory) cannot be opened: its checkpoint is garbage
+	checkpoint := filepath.Join(dirs[0], "events-0", recoveryPointCheckpointFile)
+	if err := os.WriteFile(checkpoint, []byte("garbage"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	m = newTestLogManager(t, dirs)
+	defer m.Close()
+
+	if _, ok := m.Partition("events", 0); ok {
+		t.Errorf("Broken partition loaded")
+	}
+	if _, err := m.GetOrCreate("events", 0); !errors.Is(err, resource.ErrLogDirOffline) {
+		t.Errorf("GetOrCreate of the broken partition: want ErrLogDirOffline, got %v", err)
+	}
+
+	// The other directory keeps serving, and takes new partitions
+	p, ok := m.Partition("events", 1)
+	if !ok {
+		t.Fatalf("Partition on the healthy directory not loaded")
+	}
+	if _, err := p.Append(createBatchBytes(5, time.Now().UnixMilli(), make([]byte, 50))); err != nil {
+		t.Errorf("Append on the healthy directory failed: %v", err)
+	}
+	if p, err := m.GetOrCreate("events", 2); err != nil || p.LogDir().Path != dirs[1] {
+		t.Errorf("New partition: want it on %s, got %v", dirs[1], err)
+	}
+}
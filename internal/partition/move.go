@@ -0,0 +1,298 @@
+package partition
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"lightkafka/internal/resource"
+	"lightkafka/internal/segment"
+)
+
+// A partition moving to another log directory is copied into "{name}.future" next to
+// its destination. The copy takes over with two renames: the original becomes
+// "{name}.delete" and the copy becomes "{name}". LogManager finishes or rolls back a
+// move that was interrupted by a crash (see recoverMoves).
+const (
+	futureDirSuffix = ".future"
+	deleteDirSuffix = ".delete"
+)
+
+// fileStamp identifies the version of a file that was copied.
+type fileStamp struct {
+	size    int64
+	modTime int64 // Unix ns
+}
+
+// moveTo relocates the partition into baseDir (on logDir) while it keeps serving.
+// The files are copied in two passes: the bulk without blocking anyone, then whatever
+// changed meanwhile (at least the active segment) with appends paused.
+func (p *Partition) moveTo(baseDir string, logDir *resource.LogDir) error {
+	if p.Config.LogStorage == LogStorageMemory {
+		return fmt.Errorf("cannot move partition %s-%d: memory storage has no log directory", p.Topic, p.ID)
+	}
+
+	// No compaction or tiering swaps files under the copy
+	p.cleanerMu.Lock()
+	defer p.cleanerMu.Unlock()
+
+	p.mu.RLock()
+	src := p.Dir
+	p.mu.RUnlock()
+
+	dst := filepath.Join(baseDir, filepath.Base(src))
+	if dst == src {
+		return nil
+	}
+	if err := logDir.Err(); err != nil {
+		return err
+	}
+	size, err := dirSize(src)
+	if err != nil {
+		return err
+	}
+	if err := logDir.CheckFreeSpace(size + p.rollSpace()); err != nil {
+		return err
+	}
+
+	fmt.Printf("[Partition %d] Moving %s -> %s (%d bytes)\n", p.ID, src, dst, size)
+
+	future := dst + futureDirSuffix
+	if err := os.RemoveAll(future); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(future, 0755); err != nil {
+		return err
+	}
+	swapped := false
+	defer func() {
+		if !swapped {
+			os.RemoveAll(future)
+		}
+	}()
+
+	// 1. Bulk Copy: closed segments do not change, so most of it stays valid
+	copied := make(map[string]fileStamp)
+	if err := syncDir(src, future, copied); err != nil {
+		return err
+	}
+
+	// 2. Catch Up: appends wait from here until the copy takes over
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.logDir.Load().Err(); err != nil {
+		return err
+	}
+
+	// The active segment is synced before the copy (a fetch may keep it mapped past
+	// Release). Its files are copied again even if they look unchanged: writes through
+	// the mapping do not always update the mtime.
+	activeBase := p.activeSegment.BaseOffset()
+	if err := p.activeSegment.Flush(); err != nil {
+		return p.checkStorage(err)
+	}
+	p.advanceRecoveryPoint(p.activeSegment.NextOffset())
+
+	// reopen makes the active segment writable again after a failed move
+	reopen := func(cause error) error {
+		seg, err := p.storage.Create(activeBase, false)
+		if err != nil {
+			p.logDir.Load().MarkOffline(fmt.Errorf("%w: reopen active segment: %w", segment.ErrStorage, err))
+			return errors.Join(cause, err)
+		}
+		p.activeSegment = seg
+		return cause
+	}
+
+	if err := p.activeSegment.Close(); err != nil {
+		return reopen(p.checkStorage(err))
+	}
+	for _, suffix := range []string{segment.LogFileSuffix, segment.IndexFileSuffix, segment.TimeIndexFileSuffix} {
+		delete(copied, filepath.Base(segment.FilePath(src, activeBase, suffix)))
+	}
+
+	if err := p.writeRecoveryPoint(); err != nil {
+		return reopen(err)
+	}
+	if err := syncDir(src, future, copied); err != nil {
+		return reopen(err)
+	}
+
+	// 3. Swap: the copy is complete and durable, so from here on it is the partition.
+	// Each rename is synced before the next step: after a crash recoverMoves must find
+	// the original renamed to .delete before it lets the copy win.
+	if err := p.storage.Close(); err != nil {
+		return reopen(err)
+	}
+	if err := os.Rename(src, src+deleteDirSuffix); err != nil {
+		return p.reopenStorage(src, activeBase, err)
+	}
+	restore := func(cause error) error {
+		if err := renameSynced(src+deleteDirSuffix, src); err != nil {
+			return p.checkStorage(fmt.Errorf("%w: restore %s: %w", segment.ErrStorage, src, err))
+		}
+		return p.checkStorage(p.reopenStorage(src, activeBase, cause))
+	}
+	if err := syncPath(filepath.Dir(src)); err != nil {
+		return restore(fmt.Errorf("%w: sync %s: %w", segment.ErrStorage, filepath.Dir(src), err))
+	}
+	if err := os.Rename(future, dst); err != nil {
+		return restore(err)
+	}
+	swapped = true
+
+	// If the rename is lost, recoverMoves still completes the move from .future, but only
+	// while the original is kept as .delete
+	syncErr := syncPath(filepath.Dir(dst))
+
+	p.Dir = dst
+	p.logDir.Store(logDir)
+	if err := p.reopenStorage(dst, activeBase, nil); err != nil {
+		return err
+	}
+	if syncErr != nil {
+		return p.checkStorage(fmt.Errorf("%w: sync %s: %w", segment.ErrStorage, filepath.Dir(dst), syncErr))
+	}
+
+	// Cached read-only segments still map the old files
+	for _, baseOffset := range p.Segments {
+		p.cache.Remove(p.cacheKey(baseOffset))
+	}
+	if err := os.RemoveAll(src + deleteDirSuffix); err != nil {
+		fmt.Printf("[Partition %d] Failed to remove %s: %v\n", p.ID, src+deleteDirSuffix, err)
+	}
+
+	fmt.Printf("[Partition %d] Moved to %s\n", p.ID, dst)
+	return nil
+}
+
+// reopenStorage opens the storage in dir and its active segment at activeBase, after
+// moveTo closed them. cause is returned unless reopening fails too. Callers must hold p.mu.
+func (p *Partition) reopenStorage(dir string, activeBase int64, cause error) error {
+	storage, err := newDiskStorage(dir, p.Config.SegmentConfig)
+	if err == nil {
+		var seg segment.LogStore
+		if seg, err = storage.Create(activeBase, false); err == nil {
+			p.storage = storage
+			p.activeSegment = seg
+			return cause
+		}
+		storage.Close()
+	}
+
+	// Without storage the partition cannot serve anything
+	err = fmt.Errorf("%w: reopen %s: %w", segment.ErrStorage, dir, err)
+	p.logDir.Load().MarkOffline(err)
+	return errors.Join(cause, err)
+}
+
+// syncDir makes the files in dst match those in src. Only files that are new or changed
+// since they were recorded in copied are copied. Files that are gone from src are removed
+// from dst. The lock file, temporary files and subdirectories (the cleaner's) are skipped.
+func syncDir(src, dst string, copied map[string]fileStamp) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	present := make(map[string]bool)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || name == resource.LockFileName || filepath.Ext(name) == ".tmp" {
+			continue
+		}
+		fi, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // Deleted meanwhile (retention)
+		} else if err != nil {
+			return err
+		}
+
+		present[name] = true
+		stamp := fileStamp{size: fi.Size(), modTime: fi.ModTime().UnixNano()}
+		if old, ok := copied[name]; ok && old == stamp {
+			continue
+		}
+		if err := copyFile(filepath.Join(src, name), filepath.Join(dst, name)); errors.Is(err, fs.ErrNotExist) {
+			delete(present, name)
+			continue
+		} else if err != nil {
+			return err
+		}
+		copied[name] = stamp
+	}
+
+	for name := range copied {
+		if !present[name] {
+			if err := os.Remove(filepath.Join(dst, name)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			delete(copied, name)
+		}
+	}
+	return syncPath(dst)
+}
+
+// copyFile copies src over dst and syncs it.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// renameSynced renames oldPath to newPath in the same directory and syncs the directory.
+func renameSynced(oldPath, newPath string) error {
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+	return syncPath(filepath.Dir(newPath))
+}
+
+// syncPath fsyncs a file or directory, making renames and new entries in it durable.
+func syncPath(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// dirSize returns the total size of the regular files in dir.
+func dirSize(dir string) (int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if fi, err := entry.Info(); err == nil {
+			size += fi.Size()
+		}
+	}
+	return size, nil
+}
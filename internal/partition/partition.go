@@ -2,14 +2,17 @@ package partition
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
-	"os"
 	"path/filepath"
+	"slices"
 	"sort"
-	"strconv"
-	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"lightkafka/internal/message"
+	"lightkafka/internal/remote"
 	"lightkafka/internal/resource" // Import Resource
 	"lightkafka/internal/segment"
 )
@@ -28,11 +31,63 @@ type Partition struct {
 
 	// activeSegment is the current segment being written to.
 	// It is always kept open and NOT managed by the LRU cache.
-	activeSegment *segment.Segment
+	activeSegment segment.LogStore
 
-	// cache is the shared global resource manager for read-only segments.
+	// activeSince is the broker time (Unix ms) of the first append to the active
+	// segment, or when it was opened if it already held data; 0 while it is empty.
+	// segment.ms counts from it. Guarded by mu.
+	activeSince int64
+
+	// storage creates and opens the segments (mmap'ed files or memory, see storage.go).
+	storage Storage
+
+	// logDir is the health of the directory holding the partition (nil for memory storage).
+	// Once it goes offline every read and write fails (see health.go). It changes when
+	// the partition moves to another directory (see move.go).
+	logDir atomic.Pointer[resource.LogDir]
+
+	// cache is the shared global resource manager for read-only segments
+	// (opened with storage.Open).
 	cache *resource.SegmentCache
 
+	// logStartOffset is the first offset still readable. It only moves forward, either
+	// as old segments are deleted or through DeleteRecordsBefore (which checkpoints it).
+	logStartOffset int64
+
+	// remoteSegments lists the segments copied to remote storage, oldest first.
+	// Those below Segments[0] exist only remotely (see tiering.go).
+	remoteSegments []remote.SegmentMetadata
+
+	// indexFullRolls counts rolls caused by a full index instead of a full log.
+	// A high rate means IndexMaxBytes is too small for SegmentMaxBytes/IndexIntervalBytes.
+	indexFullRolls atomic.Int64
+
+	// recoveryPoint is the offset below which all data is synced to disk.
+	// Segments entirely below it are opened without CRC validation.
+	// It is persisted in the recovery-point-offset-checkpoint file.
+	recoveryPoint atomic.Int64
+	checkpointMu  sync.Mutex
+
+	// maxTimestamps is the largest timestamp of each closed segment known so far, by
+	// base offset (see timestamp.go). It has its own lock: lookups fill it under p.mu.RLock.
+	maxTimestamps   map[int64]int64
+	maxTimestampsMu sync.Mutex
+
+	// cleanerMu serializes compaction and tiering runs.
+	cleanerMu sync.Mutex
+
+	// cleanedUpTo is the end of the closed segments covered by the last compaction, so
+	// the next one builds its offset map from the newer (dirty) segments only.
+	// nextTombstoneExpiry is when the earliest tombstone it kept may be dropped
+	// (0: unknown). Both are guarded by cleanerMu; cleanedUpTo is persisted in the
+	// cleaner-offset-checkpoint file.
+	cleanedUpTo         int64
+	nextTombstoneExpiry int64
+
+	// quit stops background tasks (retention, compaction, flush, roll), wg waits for them.
+	quit chan struct{}
+	wg   sync.WaitGroup
+
 	Config PartitionConfig
 }
 
@@ -45,24 +100,60 @@ func NewPartition(
 	resCache *resource.SegmentCache, // [DI] Global Cache Injection
 ) (*Partition, error) {
 
-	// Directory: {baseDir}/{topic}-{id}
-	partDir := filepath.Join(baseDir, fmt.Sprintf("%s-%d", topic, id))
-	if err := os.MkdirAll(partDir, 0755); err != nil {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	logDir := c.LogDir
+	if c.LogStorage == LogStorageMemory {
+		logDir = nil
+	} else if logDir == nil {
+		logDir = resource.NewLogDir(baseDir)
+	}
+	if err := logDir.Err(); err != nil {
 		return nil, err
 	}
 
+	// Directory: {baseDir}/{topic}-{id}
+	partDir := filepath.Join(baseDir, partitionDirName(topic, id))
+	storage, err := newStorage(partDir, c)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open partition %s-%d: %w", topic, id, err)
+	}
+	opened := false
+	defer func() {
+		if !opened {
+			storage.Close()
+		}
+	}()
+
 	p := &Partition{
-		Dir:      partDir,
-		Topic:    topic,
-		ID:       id,
-		Config:   c,
-		Segments: make([]int64, 0),
-		cache:    resCache,
+		Dir:     partDir,
+		Topic:   topic,
+		ID:      id,
+		Config:  c,
+		storage: storage,
+		cache:   resCache,
+		quit:    make(chan struct{}),
+
+		maxTimestamps: make(map[int64]int64),
 	}
+	p.logDir.Store(logDir)
 
 	// Scan Segments (Metadata only)
 	// We don't open files here to ensure fast startup.
-	if err := p.scanSegments(); err != nil {
+	if p.Segments, err = storage.Segments(); err != nil {
+		return nil, err
+	}
+
+	// Load Recovery Checkpoint
+	// The clean shutdown marker is consumed now, so a crash from here on is detected at the next start.
+	recoveryPoint, _, err := storage.ReadCheckpoint(recoveryPointCheckpointFile)
+	if err != nil {
+		return nil, err
+	}
+	cleanShutdown, err := storage.ConsumeCleanShutdown()
+	if err != nil {
 		return nil, err
 	}
 
@@ -70,7 +161,7 @@ func NewPartition(
 	// The active segment must be loaded directly to ensure write availability.
 	if len(p.Segments) == 0 {
 		// Case A: New Partition -> Create 0 offset segment
-		seg, err := segment.NewSegment(p.Dir, 0, c.SegmentConfig)
+		seg, err := storage.Create(0, true)
 		if err != nil {
 			return nil, err
 		}
@@ -78,58 +169,129 @@ func NewPartition(
 		p.activeSegment = seg
 	} else {
 		// Case B: Recovering -> Load the last segment as Active
-		lastOffset := p.Segments[len(p.Segments)-1]
-		seg, err := segment.NewSegment(p.Dir, lastOffset, c.SegmentConfig)
+		// After a clean shutdown it is trusted; otherwise every segment past the recovery
+		// point is re-validated.
+		var seg segment.LogStore
+		if cleanShutdown {
+			seg, err = storage.Create(p.Segments[len(p.Segments)-1], false)
+		} else {
+			seg, err = p.recoverSegments(recoveryPoint)
+		}
 		if err != nil {
 			return nil, err
 		}
 		p.activeSegment = seg
 	}
+	if err := p.loadRemoteSegments(); err != nil {
+		return nil, err
+	}
+	if p.activeSegment.Size() > 0 {
+		p.activeSince = time.Now().UnixMilli()
+	}
+	p.logStartOffset = p.firstSegmentOffset()
 
-	return p, nil
-}
-
-/* scanSegments */
-func (p *Partition) scanSegments() error {
-	entries, err := os.ReadDir(p.Dir)
+	// Load Log Start Offset Checkpoint
+	// DeleteRecordsBefore may have moved it into (or past) the first segment. Segments it
+	// left behind (crash between checkpoint and delete) are removed now.
+	logStartOffset, ok, err := storage.ReadCheckpoint(logStartOffsetCheckpointFile)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
+		return nil, err
+	}
+	if ok {
+		if err := p.deleteSegmentsBefore(min(logStartOffset, p.activeSegment.NextOffset())); err != nil {
+			return nil, err
 		}
-		return err
 	}
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
+	if p.cleanedUpTo, _, err = storage.ReadCheckpoint(cleanerOffsetCheckpointFile); err != nil {
+		return nil, err
+	}
+	p.cleanedUpTo = min(p.cleanedUpTo, p.activeSegment.BaseOffset()) // Recovery may have cut the log
+
+	// The log is durable up to the checkpoint, or entirely after a clean shutdown.
+	// The checkpoint may lag several rolls behind: segments are only trusted below it.
+	if cleanShutdown {
+		recoveryPoint = p.activeSegment.NextOffset()
+	}
+	p.recoveryPoint.Store(min(recoveryPoint, p.activeSegment.NextOffset()))
+
+	// 3. Start Background Tasks
+	p.startRetention()
+	p.startCompaction()
+	p.startFlusher()
+	p.startRollChecker()
+	p.startTiering()
+
+	opened = true
+	return p, nil
+}
+
+// recoverSegments re-validates every segment that may hold data past the recovery
+// point after a crash, oldest first, and returns the last one as the active segment.
+// A segment whose log was cut short by invalid data ends the log: the segments after
+// it are deleted, since their offsets no longer follow on.
+func (p *Partition) recoverSegments(recoveryPoint int64) (segment.LogStore, error) {
+	// Start at the segment holding the recovery point
+	first := sort.Search(len(p.Segments), func(i int) bool {
+		return i+1 == len(p.Segments) || p.Segments[i+1] > recoveryPoint
+	})
+	for i := first; ; i++ {
+		seg, truncated, err := p.storage.Recover(p.Segments[i], recoveryPoint)
+		if err != nil {
+			return nil, err
 		}
-		name := entry.Name()
-		// Only look for .log files (.index is handled by segment)
-		if strings.HasSuffix(name, ".log") {
-			prefix := strings.TrimSuffix(name, ".log")
-			baseOffset, err := strconv.ParseInt(prefix, 10, 64)
-			if err != nil {
-				return fmt.Errorf("invalid log filename: %s", name)
+		if truncated && i+1 < len(p.Segments) {
+			fmt.Printf("[Partition %d] Segment %d is corrupt at offset %d, deleting the %d segments after it\n",
+				p.ID, p.Segments[i], seg.NextOffset(), len(p.Segments)-i-1)
+			for _, baseOffset := range p.Segments[i+1:] {
+				if err := p.storage.Remove(baseOffset); err != nil {
+					seg.Close()
+					return nil, err
+				}
 			}
-			p.Segments = append(p.Segments, baseOffset)
+			p.Segments = p.Segments[:i+1]
+		}
+		if i+1 == len(p.Segments) {
+			return seg, nil
+		}
+		p.rememberMaxTimestamp(p.Segments[i], seg.MaxTimestamp())
+		if err := seg.Close(); err != nil {
+			return nil, err
 		}
 	}
-
-	// Sort by BaseOffset ASC
-	sort.Slice(p.Segments, func(i, j int) bool {
-		return p.Segments[i] < p.Segments[j]
-	})
-
-	return nil
 }
 
 // Append writes a batch to the active segment.
 // It handles segment rolling if the current one is full.
-func (p *Partition) Append(batchBytes []byte) (int64, error) {
+func (p *Partition) Append(batchBytes []byte) (_ int64, err error) {
+	// Reject what consumers could not read: corrupt or unsupported compression and
+	// malformed records. Decompressing takes a while, so it happens before taking the lock.
+	if limit := p.Config.maxBatchBytes(); int64(len(batchBytes)) > limit {
+		return 0, fmt.Errorf("%w: %d bytes, max.message.bytes is %d", message.ErrRecordTooLarge, len(batchBytes), limit)
+	}
+	batch, err := message.DecodeBatch(batchBytes)
+	if err != nil {
+		return 0, err
+	}
+	if extra := len(batchBytes) - batch.Size(); extra > 0 {
+		return 0, &message.RecordError{Index: -1, Reason: fmt.Sprintf("%d bytes after the batch", extra)}
+	}
+	if err := checkTimestampType(batch); err != nil {
+		return 0, err
+	}
+	if err := batch.Validate(time.Now().UnixMilli(), p.maxTimestampDiffMs()); err != nil {
+		return 0, err
+	}
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	currentOffset := p.activeSegment.NextOffset
+	if err := p.logDir.Load().Err(); err != nil {
+		return 0, err
+	}
+	defer func() { p.checkStorage(err) }()
+
+	currentOffset := p.activeSegment.NextOffset()
 
 	// 배치 데이터의 맨 앞 8바이트(BaseOffset)를 실제 오프셋으로 덮어씀
 	if len(batchBytes) >= 8 {
@@ -138,54 +300,141 @@ func (p *Partition) Append(batchBytes []byte) (int64, error) {
 		return 0, fmt.Errorf("invalid batch data length: %d", len(batchBytes))
 	}
 
-	// 1. Try to append to the active segment
-	offset, err := p.activeSegment.Append(batchBytes)
-
-	// 2. Handle Segment Rolling
-	if err == segment.ErrSegmentFull {
-		// 롤링 할 때도 NextOffset은 보존됨
-		nextOffset := p.activeSegment.NextOffset
+	// LogAppendTime: 타임스탬프를 브로커 시간으로 덮어씀 (CRC 재계산)
+	if p.Config.logAppendTime() {
+		message.SetLogAppendTime(batchBytes, time.Now().UnixMilli())
+	}
 
-		if err := p.activeSegment.Close(); err != nil {
+	// 1. Time-based Rolling (segment.ms)
+	now := time.Now().UnixMilli()
+	if p.segmentExpired(now) {
+		if err := p.roll(); err != nil {
 			return 0, err
 		}
+	}
+	defer func() {
+		if err == nil && p.activeSince == 0 {
+			p.activeSince = now
+		}
+	}()
 
-		fmt.Printf("[Partition %d] Rolling segment: BaseOffset %d -> New %d\n", p.ID, p.activeSegment.BaseOffset, nextOffset)
+	// 2. Try to append to the active segment
+	offset, err := p.activeSegment.Append(batchBytes)
 
-		// 새 세그먼트 생성
-		newSeg, err := segment.NewSegment(p.Dir, nextOffset, p.Config.SegmentConfig)
-		if err != nil {
+	// 3. Handle Segment Rolling (log or offset/time index exhausted)
+	if (err == segment.ErrSegmentFull || err == segment.ErrIndexFull) && p.activeSegment.Size() > 0 {
+		if err == segment.ErrIndexFull {
+			p.indexFullRolls.Add(1)
+			fmt.Printf("[Partition %d] Index full at %d bytes of log, rolling early (total: %d)\n",
+				p.ID, p.activeSegment.Size(), p.indexFullRolls.Load())
+		}
+		if err := p.roll(); err != nil {
 			return 0, err
 		}
-
-		p.activeSegment = newSeg
-
 		return p.activeSegment.Append(batchBytes)
 	}
 
 	return offset, err
 }
 
-// Read routes the read request to the correct segment (Active or Cached).
-func (p *Partition) Read(offset int64, maxBytes int32) ([]byte, error) {
+// roll seals the active segment and opens a new one at the log end offset.
+// Callers must hold p.mu.
+func (p *Partition) roll() error {
+	// 롤링 할 때도 NextOffset은 보존됨
+	nextOffset := p.activeSegment.NextOffset()
+
+	// Disk Full: keep appending to nothing rather than start a segment that cannot fill
+	if err := p.logDir.Load().CheckFreeSpace(p.rollSpace()); err != nil {
+		return err
+	}
+
+	fmt.Printf("[Partition %d] Rolling segment: BaseOffset %d -> New %d\n", p.ID, p.activeSegment.BaseOffset(), nextOffset)
+
+	// Sync the old segment before the new one exists on disk, so that a crash never leaves
+	// a newer segment in front of unsynced data. A fetch may still pin the old segment,
+	// so Release alone does not sync it.
+	if err := p.activeSegment.Flush(); err != nil {
+		return err
+	}
+	p.advanceRecoveryPoint(nextOffset)
+
+	// 새 세그먼트 생성 (먼저 열어서 실패해도 기존 세그먼트는 계속 사용 가능)
+	newSeg, err := p.storage.Create(nextOffset, true)
+	if err != nil {
+		return err
+	}
+
+	// Swap first: the old segment is closed even if Close fails, and must not stay active
+	oldSeg := p.activeSegment
+	p.rememberMaxTimestamp(oldSeg.BaseOffset(), oldSeg.MaxTimestamp())
+	p.Segments = append(p.Segments, nextOffset)
+	p.activeSegment = newSeg
+	p.activeSince = 0
+	return oldSeg.Close()
+}
+
+// segmentExpired reports whether the first append to the active segment is older than
+// segment.ms. Broker time is used, not the producer's batch timestamps, which may be
+// arbitrarily old or in the future. Empty segments never expire. Callers must hold p.mu.
+func (p *Partition) segmentExpired(now int64) bool {
+	if p.Config.SegmentMaxAgeMs <= 0 || p.activeSince == 0 {
+		return false
+	}
+	return now-p.activeSince >= p.Config.SegmentMaxAgeMs
+}
+
+// startRollChecker launches a periodic check that rolls idle active segments
+// past segment.ms, so low-traffic partitions still produce closed segments.
+func (p *Partition) startRollChecker() {
+	if p.Config.SegmentMaxAgeMs <= 0 {
+		return
+	}
+
+	intervalMs := min(p.Config.SegmentMaxAgeMs, defaultRollCheckIntervalMs)
+	p.schedule("segment roll", time.Duration(intervalMs)*time.Millisecond, func() error {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		if !p.segmentExpired(time.Now().UnixMilli()) {
+			return nil
+		}
+		return p.roll()
+	})
+}
+
+// Read routes the read request to the correct segment (Active, Cached or Remote).
+// The returned view pins the segment's mapping; the caller must Release it once
+// the data has been written out. A nil view means there is no new data.
+func (p *Partition) Read(offset int64, maxBytes int32) (*segment.View, error) {
+	if err := p.logDir.Load().Err(); err != nil {
+		return nil, err
+	}
+
 	p.mu.RLock()
+
+	// 0. Remote Path: offsets that only live in remote storage are read without p.mu,
+	// since a fetch cache miss downloads the whole segment.
+	if meta, ok := p.remoteSegmentFor(offset); ok && offset >= p.logStartOffset {
+		p.mu.RUnlock()
+		return p.readRemote(meta, offset, maxBytes)
+	}
 	defer p.mu.RUnlock()
 
 	// 1. Validate range
 	if len(p.Segments) == 0 {
 		return nil, segment.ErrOffsetOutOfRange
 	}
-	if offset < p.Segments[0] {
+	if offset < p.logStartOffset {
 		return nil, segment.ErrOffsetOutOfRange
 	}
-	if offset >= p.activeSegment.NextOffset {
+	if offset >= p.activeSegment.NextOffset() {
 		return nil, nil // No new data available (EOF)
 	}
 
 	// 2. Fast Path: Read from Active Segment
 	// If the offset is in the active segment, we read directly without cache overhead.
-	if offset >= p.activeSegment.BaseOffset {
-		return p.activeSegment.Read(offset, maxBytes)
+	if offset >= p.activeSegment.BaseOffset() {
+		return p.activeSegment.ReadView(offset, maxBytes)
 	}
 
 	// 3. Read-Only Path: Find the correct old segment
@@ -199,32 +448,256 @@ func (p *Partition) Read(offset int64, maxBytes int32) ([]byte, error) {
 		idx = 0
 	}
 
-	targetBaseOffset := p.Segments[idx]
+	// 4. Read data
+	// A compacted segment may end before the next segment's BaseOffset.
+	// If nothing is left at or after offset, continue with the next segment.
+	for ; idx < len(p.Segments); idx++ {
+		targetBaseOffset := p.Segments[idx]
+		if targetBaseOffset == p.activeSegment.BaseOffset() {
+			return p.activeSegment.ReadView(max(offset, targetBaseOffset), maxBytes)
+		}
+
+		seg, err := p.loadSegment(targetBaseOffset)
+		if err != nil {
+			return nil, err
+		}
+
+		view, err := seg.ReadView(max(offset, targetBaseOffset), maxBytes)
+		seg.Release()
+		if err == segment.ErrOffsetOutOfRange {
+			continue
+		}
+		return view, err
+	}
+
+	return nil, segment.ErrOffsetOutOfRange
+}
 
-	cacheKey := fmt.Sprintf("%s-%d-%d", p.Topic, p.ID, targetBaseOffset)
+// OffsetForTimestamp returns the offset of the first record whose timestamp is >= ts.
+// If every record is older than ts, it returns the log end offset so that a consumer
+// seeking to it waits for new data. Offsets below the log start offset are never returned.
+func (p *Partition) OffsetForTimestamp(ts int64) (int64, error) {
+	// Remote-only and closed segments first, without p.mu held. Their largest timestamp
+	// (remote metadata, or maxTimestamps once known) tells whether a segment can hold
+	// a match, so usually only that one is opened.
+	p.mu.RLock()
+	remoteOnly := slices.Clone(p.remoteOnlySegments())
+	closed := p.closedSegments()
+	logStartOffset := p.logStartOffset
+	p.mu.RUnlock()
+
+	for _, meta := range remoteOnly {
+		if meta.MaxTimestamp < ts {
+			continue
+		}
 
-	loader := func() (*segment.Segment, error) {
-		return segment.NewSegment(p.Dir, targetBaseOffset, p.Config.SegmentConfig)
+		seg, err := p.openRemoteSegment(meta.SegmentKey)
+		if err != nil {
+			return 0, err
+		}
+		offset, found, err := seg.OffsetForTimestamp(ts)
+		seg.Release()
+		if err != nil {
+			return 0, err
+		}
+		if found {
+			return max(offset, logStartOffset), nil
+		}
 	}
 
-	seg, err := p.cache.GetOrLoad(cacheKey, loader)
+	for _, baseOffset := range closed {
+		if maxTs, ok := p.knownMaxTimestamp(baseOffset); ok && maxTs < ts {
+			continue
+		}
+
+		seg, err := p.loadClosedSegment(baseOffset)
+		if err != nil {
+			return 0, err
+		}
+		if seg == nil {
+			continue // Deleted in the meantime
+		}
+
+		offset, found, err := seg.OffsetForTimestamp(ts)
+		seg.Release()
+		if err != nil {
+			return 0, err
+		}
+		if found {
+			return max(offset, logStartOffset), nil
+		}
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	// Segments rolled since the list was taken, then the active one
+	for _, baseOffset := range p.closedSegments() {
+		if len(closed) > 0 && baseOffset <= closed[len(closed)-1] {
+			continue
+		}
+
+		seg, err := p.loadSegment(baseOffset)
+		if err != nil {
+			return 0, err
+		}
+
+		offset, found, err := seg.OffsetForTimestamp(ts)
+		seg.Release()
+		if err != nil {
+			return 0, err
+		}
+		if found {
+			return max(offset, p.logStartOffset), nil
+		}
+	}
+
+	offset, found, err := p.activeSegment.OffsetForTimestamp(ts)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
+	if found {
+		return max(offset, p.logStartOffset), nil
+	}
+	return p.activeSegment.NextOffset(), nil
+}
 
-	// 5. Read data
-	return seg.Read(offset, maxBytes)
+// Flush syncs the active segment to disk and checkpoints the recovery point.
+// Closed segments were synced when they were rolled.
+func (p *Partition) Flush() (err error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if err := p.logDir.Load().Err(); err != nil {
+		return err
+	}
+	defer func() { p.checkStorage(err) }()
+
+	if err := p.activeSegment.Flush(); err != nil {
+		return err
+	}
+	p.advanceRecoveryPoint(p.activeSegment.FlushedOffset())
+	return p.writeRecoveryPoint()
+}
+
+// IndexFullRolls returns how many times the active segment was rolled because its index filled up.
+func (p *Partition) IndexFullRolls() int64 {
+	return p.indexFullRolls.Load()
+}
+
+// RecoveryPoint returns the offset below which all data is known to be on disk.
+// Everything before the active segment was synced when it was rolled.
+func (p *Partition) RecoveryPoint() int64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return max(p.recoveryPoint.Load(), p.activeSegment.FlushedOffset())
+}
+
+// advanceRecoveryPoint moves the recovery point forward (never backward).
+func (p *Partition) advanceRecoveryPoint(offset int64) {
+	for {
+		current := p.recoveryPoint.Load()
+		if offset <= current || p.recoveryPoint.CompareAndSwap(current, offset) {
+			return
+		}
+	}
+}
+
+// writeRecoveryPoint persists the recovery point to the checkpoint file.
+func (p *Partition) writeRecoveryPoint() error {
+	p.checkpointMu.Lock()
+	defer p.checkpointMu.Unlock()
+	return p.storage.WriteCheckpoint(recoveryPointCheckpointFile, p.recoveryPoint.Load())
+}
+
+// startFlusher launches the flush.ms background flusher.
+func (p *Partition) startFlusher() {
+	if p.Config.FlushIntervalMs <= 0 {
+		return
+	}
+	p.schedule("flush", time.Duration(p.Config.FlushIntervalMs)*time.Millisecond, p.Flush)
+}
+
+// LogStartOffset returns the first offset still available in the partition.
+func (p *Partition) LogStartOffset() int64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.logStartOffset
+}
+
+// LogDir returns the log directory holding the partition, nil for memory storage.
+func (p *Partition) LogDir() *resource.LogDir {
+	return p.logDir.Load()
+}
+
+// LogEndOffset returns the offset that the next appended record will receive.
+func (p *Partition) LogEndOffset() int64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.activeSegment.NextOffset()
+}
+
+// loadSegment returns a closed segment through the shared cache, opening it on a miss.
+// The segment is acquired for the caller, who must Release it.
+func (p *Partition) loadSegment(baseOffset int64) (segment.LogStore, error) {
+	loader := func() (segment.LogStore, error) {
+		return p.openSegment(baseOffset)
+	}
+
+	return p.cache.GetOrLoad(p.cacheKey(baseOffset), loader)
+}
+
+// openSegment opens a closed segment read-only. Segments that end at or below the
+// recovery point are sealed and skip CRC validation. Callers must hold p.mu.
+func (p *Partition) openSegment(baseOffset int64) (segment.LogStore, error) {
+	idx := sort.Search(len(p.Segments), func(i int) bool {
+		return p.Segments[i] > baseOffset
+	})
+	sealed := idx < len(p.Segments) && p.Segments[idx] <= p.recoveryPoint.Load()
+	return p.storage.Open(baseOffset, sealed)
+}
+
+// partitionDirName is the directory of a partition inside its log directory.
+func partitionDirName(topic string, id int) string {
+	return fmt.Sprintf("%s-%d", topic, id)
+}
+
+// cacheKey identifies a segment of this partition in the shared cache.
+func (p *Partition) cacheKey(baseOffset int64) string {
+	return resource.SegmentKey(p.Topic, p.ID, baseOffset)
 }
 
 /* Close */
-func (p *Partition) Close() error {
+func (p *Partition) Close() (err error) {
+	// Stop background tasks first; they take p.mu themselves.
+	close(p.quit)
+	p.wg.Wait()
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	if p.activeSegment != nil {
-		if err := p.activeSegment.Close(); err != nil {
-			return err
-		}
+	// Runs after the segment is closed and the marker is written (releases the dir lock).
+	defer p.storage.Close()
+
+	if p.activeSegment == nil {
+		return nil
 	}
-	return nil
+	defer func() { p.checkStorage(err) }()
+
+	// Clean Shutdown: sync explicitly, a fetch may still hold the segment open past Release.
+	logEndOffset := p.activeSegment.NextOffset()
+	flushErr := p.activeSegment.Flush()
+	if err := errors.Join(flushErr, p.activeSegment.Close()); err != nil {
+		return err
+	}
+	if err := p.logDir.Load().Err(); err != nil {
+		return err // Data on an offline directory is not trusted: no checkpoint, no marker
+	}
+	p.advanceRecoveryPoint(logEndOffset)
+	if err := p.writeRecoveryPoint(); err != nil {
+		return err
+	}
+
+	// The marker lets the next start skip validation of the active segment.
+	return p.storage.MarkCleanShutdown()
 }
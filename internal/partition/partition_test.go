@@ -0,0 +1,510 @@
+package partition
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"lightkafka/internal/message"
+	"lightkafka/internal/resource"
+	"lightkafka/internal/segment"
+)
+
+// readBytes reads from the partition and copies the data out so the view can be
+// released right away.
+func readBytes(p *Partition, offset int64, maxBytes int32) ([]byte, error) {
+	view, err := p.Read(offset, maxBytes)
+	if err != nil || view == nil {
+		return nil, err
+	}
+	defer view.Release()
+	return bytes.Clone(view.Data), nil
+}
+
+// createBatchBytes builds a valid batch of recordsCount records whose values are cut
+// from payload. The batch keeps the size of 61+len(payload) bytes as long as payload
+// leaves 7 bytes of framing per record and no value exceeds 57 bytes.
+func createBatchBytes(recordsCount int32, ts int64, payload []byte) []byte {
+	values := max(len(payload)-7*int(recordsCount), 0)
+
+	var records []byte
+	pos := 0
+	for i := range recordsCount {
+		n := values / int(recordsCount)
+		if i == recordsCount-1 {
+			n = values - pos
+		}
+		records = message.AppendRecord(records, &message.Record{OffsetDelta: i, Value: payload[pos : pos+n]})
+		pos += n
+	}
+
+	return message.EncodeBatch(message.BatchHeader{
+		LastOffsetDelta: recordsCount - 1,
+		BaseTimestamp:   ts,
+		MaxTimestamp:    ts,
+		ProducerId:      -1,
+		ProducerEpoch:   -1,
+		BaseSequence:    -1,
+		RecordsCount:    recordsCount,
+	}, records)
+}
+
+// segmentsOf returns a copy of p.Segments, which background rolls may change.
+func segmentsOf(p *Partition) []int64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return slices.Clone(p.Segments)
+}
+
+// newTestPartition creates a partition. By default its segments hold exactly one 161-byte batch.
+func newTestPartition(t *testing.T, c PartitionConfig) *Partition {
+	t.Helper()
+
+	if c.SegmentConfig.SegmentMaxBytes == 0 {
+		c.SegmentConfig.SegmentMaxBytes = 200
+	}
+	if c.SegmentConfig.IndexMaxBytes == 0 {
+		c.SegmentConfig.IndexMaxBytes = 1024
+	}
+	if c.SegmentConfig.IndexIntervalBytes == 0 {
+		c.SegmentConfig.IndexIntervalBytes = 4096
+	}
+
+	cache := resource.NewSegmentCache(10)
+	t.Cleanup(func() { cache.Close() })
+
+	p, err := NewPartition(t.TempDir(), "test", 0, c, cache)
+	if err != nil {
+		t.Fatalf("Failed to create partition: %v", err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func TestPartition_RollOnIndexFull(t *testing.T) {
+	p := newTestPartition(t, PartitionConfig{
+		SegmentConfig: segment.Config{
+			SegmentMaxBytes:    1024 * 1024,
+			IndexMaxBytes:      12, // Room for a single index entry
+			IndexIntervalBytes: 1,  // Index every batch
+		},
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, err := p.Append(createBatchBytes(5, time.Now().UnixMilli(), []byte("payload"))); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	if len(p.Segments) != 3 {
+		t.Errorf("Expected a roll per full index, got segments %v", p.Segments)
+	}
+	if p.IndexFullRolls() != 2 {
+		t.Errorf("IndexFullRolls mismatch. Want 2, Got %d", p.IndexFullRolls())
+	}
+
+	for _, offset := range []int64{0, 5, 10} {
+		if data, err := readBytes(p, offset, 1024); err != nil || len(data) == 0 {
+			t.Errorf("Read(%d) failed. Len: %d, Err: %v", offset, len(data), err)
+		}
+	}
+}
+
+func TestPartition_RollBySegmentAge(t *testing.T) {
+	p := newTestPartition(t, PartitionConfig{
+		SegmentConfig:   segment.Config{SegmentMaxBytes: 1024 * 1024},
+		SegmentMaxAgeMs: 50,
+	})
+
+	// Producer timestamps do not count: an hour-old batch does not expire the segment
+	old := time.Now().Add(-time.Hour).UnixMilli()
+	for i := 0; i < 2; i++ {
+		if _, err := p.Append(createBatchBytes(5, old, []byte("payload"))); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	if got := segmentsOf(p); len(got) != 1 {
+		t.Fatalf("Rolled on producer timestamps: segments %v", got)
+	}
+
+	// The roll checker or the next append rolls once segment.ms has passed
+	time.Sleep(60 * time.Millisecond)
+	if _, err := p.Append(createBatchBytes(5, time.Now().UnixMilli(), []byte("payload"))); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if got := segmentsOf(p); len(got) != 2 || got[1] != 10 {
+		t.Errorf("Expected a roll at offset 10 after segment.ms, got segments %v", got)
+	}
+}
+
+func TestPartition_RollChecker(t *testing.T) {
+	p := newTestPartition(t, PartitionConfig{
+		SegmentConfig:   segment.Config{SegmentMaxBytes: 1024 * 1024},
+		SegmentMaxAgeMs: 20, // Also the check interval
+	})
+	segments := func() []int64 { return segmentsOf(p) }
+
+	// The empty active segment never expires
+	time.Sleep(50 * time.Millisecond)
+	if got := segments(); len(got) != 1 {
+		t.Fatalf("Empty segment rolled: %v", got)
+	}
+
+	// An idle segment with data rolls without another append
+	if _, err := p.Append(createBatchBytes(5, time.Now().UnixMilli(), []byte("payload"))); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(segments()) == 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := segments(); len(got) != 2 || got[1] != 5 {
+		t.Fatalf("Roll checker did not roll the idle segment: %v", got)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if got := segments(); len(got) != 2 {
+		t.Errorf("Roll checker rolled the new empty segment: %v", got)
+	}
+}
+
+func TestPartition_RecoveryCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	cache := resource.NewSegmentCache(10)
+	defer cache.Close()
+
+	c := PartitionConfig{SegmentConfig: segment.Config{
+		SegmentMaxBytes:    200,
+		IndexMaxBytes:      1024,
+		IndexIntervalBytes: 4096,
+	}}
+
+	p, err := NewPartition(dir, "test", 0, c, cache)
+	if err != nil {
+		t.Fatalf("Failed to create partition: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := p.Append(createBatchBytes(5, time.Now().UnixMilli(), make([]byte, 100))); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	// Segments [0, 5] were synced on roll; [10] is the unflushed active segment
+	if p.RecoveryPoint() != 10 {
+		t.Errorf("RecoveryPoint before flush mismatch. Want 10, Got %d", p.RecoveryPoint())
+	}
+	if err := p.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if offset, _, _ := readCheckpoint(filepath.Join(p.Dir, recoveryPointCheckpointFile)); offset != 15 {
+		t.Errorf("Checkpoint after flush mismatch. Want 15, Got %d", offset)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(p.Dir, cleanShutdownFile)); err != nil {
+		t.Errorf("Clean shutdown marker missing: %v", err)
+	}
+
+	// Reopen: the marker is consumed and the checkpoint restored
+	p, err = NewPartition(dir, "test", 0, c, cache)
+	if err != nil {
+		t.Fatalf("Failed to reopen partition: %v", err)
+	}
+	defer p.Close()
+
+	if _, err := os.Stat(filepath.Join(p.Dir, cleanShutdownFile)); !os.IsNotExist(err) {
+		t.Errorf("Clean shutdown marker should be removed on open (err: %v)", err)
+	}
+	if p.RecoveryPoint() != 15 || p.LogEndOffset() != 15 {
+		t.Errorf("Reopened offsets mismatch. RecoveryPoint: %d, LogEndOffset: %d", p.RecoveryPoint(), p.LogEndOffset())
+	}
+	if data, err := readBytes(p, 0, 1024); err != nil || len(data) == 0 {
+		t.Errorf("Read after reopen failed. Len: %d, Err: %v", len(data), err)
+	}
+}
+
+func TestPartition_RecoversSegmentsPastCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	cache := resource.NewSegmentCache(10)
+	defer cache.Close()
+
+	c := PartitionConfig{SegmentConfig: segment.Config{
+		SegmentMaxBytes:    200,
+		IndexMaxBytes:      1024,
+		IndexIntervalBytes: 4096,
+	}}
+
+	p, err := NewPartition(dir, "test", 0, c, cache)
+	if err != nil {
+		t.Fatalf("Failed to create partition: %v", err)
+	}
+	// 4 batches -> Segments [0, 5, 10, 15]
+	for i := 0; i < 4; i++ {
+		if _, err := p.Append(createBatchBytes(5, time.Now().UnixMilli(), make([]byte, 100))); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Crash with a checkpoint several rolls behind and a torn write in segment 5,
+	// which is no longer the last one
+	if err := os.Remove(filepath.Join(p.Dir, cleanShutdownFile)); err != nil {
+		t.Fatalf("Remove marker failed: %v", err)
+	}
+	if err := writeCheckpoint(filepath.Join(p.Dir, recoveryPointCheckpointFile), 0); err != nil {
+		t.Fatalf("writeCheckpoint failed: %v", err)
+	}
+	logPath := segment.FilePath(p.Dir, 5, segment.LogFileSuffix)
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	data[len(data)-1]++
+	if err := os.WriteFile(logPath, data, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	p, err = NewPartition(dir, "test", 0, c, cache)
+	if err != nil {
+		t.Fatalf("Failed to reopen partition: %v", err)
+	}
+	defer p.Close()
+
+	// The log ends at the corrupt batch: the segments after it are gone
+	if p.LogEndOffset() != 5 || !slices.Equal(p.Segments, []int64{0, 5}) {
+		t.Errorf("Recovered log mismatch. LogEndOffset: %d, Segments: %v", p.LogEndOffset(), p.Segments)
+	}
+	if p.recoveryPoint.Load() != 0 {
+		t.Errorf("Recovery point mismatch. Want the checkpoint 0, Got %d", p.recoveryPoint.Load())
+	}
+	if _, err := os.Stat(segment.FilePath(p.Dir, 10, segment.LogFileSuffix)); !os.IsNotExist(err) {
+		t.Errorf("Segment after the corruption still exists (err: %v)", err)
+	}
+	if offset, err := p.Append(createBatchBytes(5, time.Now().UnixMilli(), make([]byte, 100))); err != nil || offset != 5 {
+		t.Errorf("Append after recovery. Want offset 5, Got %d (err: %v)", offset, err)
+	}
+}
+
+func TestPartition_SyncsPinnedSegments(t *testing.T) {
+	dir := t.TempDir()
+	cache := resource.NewSegmentCache(10)
+	defer cache.Close()
+
+	p, err := NewPartition(dir, "test", 0, PartitionConfig{SegmentConfig: segment.Config{
+		SegmentMaxBytes:    200,
+		IndexMaxBytes:      1024,
+		IndexIntervalBytes: 4096,
+	}}, cache)
+	if err != nil {
+		t.Fatalf("Failed to create partition: %v", err)
+	}
+	if _, err := p.Append(createBatchBytes(5, time.Now().UnixMilli(), make([]byte, 100))); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	// A fetch holds the active segment open across the roll: Release does not close it
+	first := p.activeSegment
+	view, err := p.Read(0, 1024)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	defer view.Release()
+
+	if _, err := p.Append(createBatchBytes(5, time.Now().UnixMilli(), make([]byte, 100))); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if first.FlushedOffset() != 5 || p.RecoveryPoint() != 5 {
+		t.Errorf("Rolled segment not synced. FlushedOffset: %d, RecoveryPoint: %d", first.FlushedOffset(), p.RecoveryPoint())
+	}
+
+	// Same for the active segment on Close
+	active := p.activeSegment
+	activeView, err := p.Read(5, 1024)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	defer activeView.Release()
+
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if active.FlushedOffset() != 10 {
+		t.Errorf("Active segment not synced on Close. FlushedOffset: %d", active.FlushedOffset())
+	}
+	if offset, _, _ := readCheckpoint(filepath.Join(p.Dir, recoveryPointCheckpointFile)); offset != 10 {
+		t.Errorf("Checkpoint after Close mismatch. Want 10, Got %d", offset)
+	}
+}
+
+func TestPartition_DirectoryLock(t *testing.T) {
+	dir := t.TempDir()
+	cache := resource.NewSegmentCache(10)
+	defer cache.Close()
+
+	c := PartitionConfig{SegmentConfig: segment.Config{
+		SegmentMaxBytes:    200,
+		IndexMaxBytes:      1024,
+		IndexIntervalBytes: 4096,
+	}}
+
+	p, err := NewPartition(dir, "test", 0, c, cache)
+	if err != nil {
+		t.Fatalf("Failed to create partition: %v", err)
+	}
+
+	// A second open of the same directory must be refused while the first is alive
+	if _, err := NewPartition(dir, "test", 0, c, cache); !errors.Is(err, resource.ErrDirLocked) {
+		t.Fatalf("Expected ErrDirLocked, Got %v", err)
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	p, err = NewPartition(dir, "test", 0, c, cache)
+	if err != nil {
+		t.Fatalf("Reopen after Close failed: %v", err)
+	}
+	p.Close()
+}
+
+func TestPartition_MemoryStorage(t *testing.T) {
+	baseDir := t.TempDir()
+	cache := resource.NewSegmentCache(10)
+	defer cache.Close()
+
+	c := PartitionConfig{
+		LogStorage: LogStorageMemory,
+		SegmentConfig: segment.Config{
+			SegmentMaxBytes:    200,
+			IndexMaxBytes:      1024,
+			IndexIntervalBytes: 4096,
+		},
+	}
+	p, err := NewPartition(baseDir, "test", 0, c, cache)
+	if err != nil {
+		t.Fatalf("Failed to create partition: %v", err)
+	}
+	defer p.Close()
+
+	// 4 batches -> Segments [0, 5, 10, 15]
+	for i := 0; i < 4; i++ {
+		if _, err := p.Append(createBatchBytes(5, time.Now().UnixMilli(), make([]byte, 100))); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	if len(p.Segments) != 4 {
+		t.Fatalf("Expected 4 segments, got %v", p.Segments)
+	}
+	for _, offset := range []int64{0, 7, 15} {
+		if data, err := readBytes(p, offset, 1024); err != nil || len(data) == 0 {
+			t.Errorf("Read at %d failed. Len: %d, Err: %v", offset, len(data), err)
+		}
+	}
+
+	if _, err := p.DeleteRecordsBefore(6); err != nil {
+		t.Fatalf("DeleteRecordsBefore failed: %v", err)
+	}
+	if err := p.TruncateTo(12); err != nil {
+		t.Fatalf("TruncateTo failed: %v", err)
+	}
+	if p.LogStartOffset() != 6 || p.LogEndOffset() != 10 || len(p.Segments) != 2 {
+		t.Errorf("Offsets mismatch. LogStart: %d, LogEnd: %d, Segments: %v", p.LogStartOffset(), p.LogEndOffset(), p.Segments)
+	}
+
+	if entries, _ := os.ReadDir(baseDir); len(entries) != 0 {
+		t.Errorf("Memory storage wrote to disk: %v", entries)
+	}
+}
+
+func TestPartition_DiskHealth(t *testing.T) {
+	// A segment larger than any test disk: rolling must be refused for lack of space
+	cache := resource.NewSegmentCache(10)
+	defer cache.Close()
+
+	p, err := NewPartition(t.TempDir(), "test", 0, PartitionConfig{
+		SegmentConfig: segment.Config{
+			SegmentMaxBytes:    1 << 50,
+			IndexMaxBytes:      1024,
+			IndexIntervalBytes: 4096,
+		},
+		SegmentMaxAgeMs: 1,
+	}, cache)
+	if err != nil {
+		t.Fatalf("Failed to create partition: %v", err)
+	}
+
+	if _, err := p.Append(createBatchBytes(5, time.Now().UnixMilli(), []byte("payload"))); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := p.Append(createBatchBytes(5, time.Now().UnixMilli(), []byte("payload"))); !errors.Is(err, resource.ErrInsufficientSpace) {
+		t.Fatalf("Expected ErrInsufficientSpace on roll, Got %v", err)
+	}
+	if err := p.LogDir().Err(); err != nil {
+		t.Fatalf("A full disk must not take the directory offline: %v", err)
+	}
+	if data, err := readBytes(p, 0, 1024); err != nil || len(data) == 0 {
+		t.Fatalf("Read after refused roll failed. Len: %d, Err: %v", len(data), err)
+	}
+
+	// An I/O error takes the directory offline: everything fails fast from then on
+	p.LogDir().MarkOffline(fmt.Errorf("%w: simulated EIO", segment.ErrStorage))
+
+	if _, err := p.Append(createBatchBytes(5, time.Now().UnixMilli(), []byte("payload"))); !errors.Is(err, resource.ErrLogDirOffline) {
+		t.Errorf("Append: expected ErrLogDirOffline, Got %v", err)
+	}
+	if _, err := p.Read(0, 1024); !errors.Is(err, resource.ErrLogDirOffline) {
+		t.Errorf("Read: expected ErrLogDirOffline, Got %v", err)
+	}
+	if err := p.Flush(); !errors.Is(err, segment.ErrStorage) {
+		t.Errorf("Flush: expected the offline cause, Got %v", err)
+	}
+
+	// No clean shutdown marker: the next start must re-validate the log
+	if err := p.Close(); !errors.Is(err, resource.ErrLogDirOffline) {
+		t.Errorf("Close: expected ErrLogDirOffline, Got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(p.Dir, cleanShutdownFile)); !os.IsNotExist(err) {
+		t.Errorf("Clean shutdown marker written for an offline directory")
+	}
+}
+
+func TestPartition_RejectsInvalidBatches(t *testing.T) {
+	p := newTestPartition(t, PartitionConfig{MaxMessageBytes: 150})
+
+	if _, err := p.Append(createBatchBytes(5, time.Now().UnixMilli(), make([]byte, 80))); err != nil {
+		t.Fatalf("Append of a 141-byte batch failed: %v", err)
+	}
+	if _, err := p.Append(createBatchBytes(5, time.Now().UnixMilli(), make([]byte, 100))); !errors.Is(err, message.ErrRecordTooLarge) {
+		t.Errorf("161-byte batch over max.message.bytes: want ErrRecordTooLarge, got %v", err)
+	}
+
+	// RecordsCount claims one record more than the batch holds
+	batch, err := message.DecodeBatch(createBatchBytes(5, time.Now().UnixMilli(), make([]byte, 80)))
+	if err != nil {
+		t.Fatalf("DecodeBatch failed: %v", err)
+	}
+	h := batch.Header
+	h.RecordsCount, h.LastOffsetDelta = 6, 5
+	var recErr *message.RecordError
+	if _, err := p.Append(message.EncodeBatch(h, batch.Payload)); !errors.As(err, &recErr) || recErr.Index != -1 {
+		t.Errorf("RecordsCount mismatch: want a batch RecordError, got %v", err)
+	}
+	if _, err := p.Append(append(createBatchBytes(1, time.Now().UnixMilli(), make([]byte, 10)), 0, 0)); !errors.As(err, &recErr) || recErr.Index != -1 {
+		t.Errorf("Bytes after the batch: want a batch RecordError, got %v", err)
+	}
+
+	if p.LogEndOffset() != 5 {
+		t.Errorf("LogEndOffset after rejected batches: %d, want 5", p.LogEndOffset())
+	}
+}
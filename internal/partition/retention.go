@@ -0,0 +1,165 @@
+package partition
+
+import (
+	"fmt"
+	"time"
+
+	"lightkafka/internal/segment"
+)
+
+// startRetention launches the retention loop if any retention limit is configured.
+func (p *Partition) startRetention() {
+	if !p.Config.deleteEnabled() {
+		return
+	}
+	if p.Config.RetentionMs <= 0 && p.Config.RetentionBytes <= 0 {
+		return
+	}
+
+	intervalMs := p.Config.RetentionCheckIntervalMs
+	if intervalMs <= 0 {
+		intervalMs = defaultRetentionCheckIntervalMs
+	}
+
+	p.schedule("retention", time.Duration(intervalMs)*time.Millisecond, func() error {
+		_, err := p.EnforceRetention()
+		return err
+	})
+}
+
+// EnforceRetention deletes the oldest closed segments that exceed retention.ms or
+// retention.bytes and advances the log start offset. The active segment is never deleted.
+// With tiered storage the remote-only segments are the oldest part of the log and are
+// deleted first. It returns the number of deleted segments.
+func (p *Partition) EnforceRetention() (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// 1. Compute the total size (needed for retention.bytes) without opening the closed segments
+	var totalBytes int64
+	if p.Config.RetentionBytes > 0 {
+		for _, meta := range p.remoteOnlySegments() {
+			totalBytes += meta.SizeInBytes
+		}
+		for _, baseOffset := range p.closedSegments() {
+			size, err := p.storage.Size(baseOffset)
+			if err != nil {
+				return 0, err
+			}
+			totalBytes += size
+		}
+		totalBytes += p.activeSegment.Size()
+	}
+
+	// 2. Walk from the oldest segment and stop at the first one we must keep
+	now := time.Now().UnixMilli()
+	deleted := 0
+
+	for {
+		size, maxTs, ok, err := p.oldestSegmentStats()
+		if err != nil {
+			return deleted, err
+		}
+		if !ok {
+			break
+		}
+
+		expired := false
+		if p.Config.RetentionMs > 0 {
+			expired = now-maxTs > p.Config.RetentionMs
+		}
+		if !expired && p.Config.RetentionBytes > 0 {
+			expired = totalBytes-size >= p.Config.RetentionBytes
+		}
+		if !expired {
+			break
+		}
+
+		totalBytes -= size
+		if err := p.deleteOldestSegment(); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// oldestSegmentStats returns the size and largest timestamp of the oldest deletable
+// segment. ok is false if only the active segment is left. Callers must hold p.mu.
+func (p *Partition) oldestSegmentStats() (size, maxTs int64, ok bool, err error) {
+	if remoteOnly := p.remoteOnlySegments(); len(remoteOnly) > 0 {
+		return remoteOnly[0].SizeInBytes, remoteOnly[0].MaxTimestamp, true, nil
+	}
+	if len(p.Segments) < 2 {
+		return 0, 0, false, nil
+	}
+
+	seg, err := p.loadSegment(p.Segments[0])
+	if err != nil {
+		return 0, 0, false, err
+	}
+	defer seg.Release()
+
+	maxTs, err = p.segmentTimestamp(seg)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	return seg.Size(), maxTs, true, nil
+}
+
+// closedSegments returns the base offsets of every segment except the active one.
+func (p *Partition) closedSegments() []int64 {
+	closed := make([]int64, 0, len(p.Segments))
+	for _, baseOffset := range p.Segments {
+		if baseOffset == p.activeSegment.BaseOffset() {
+			break
+		}
+		closed = append(closed, baseOffset)
+	}
+	return closed
+}
+
+// segmentTimestamp returns the segment's largest timestamp, falling back to
+// the time it was last written for segments without timestamps.
+func (p *Partition) segmentTimestamp(seg segment.LogStore) (int64, error) {
+	if ts := seg.MaxTimestamp(); ts >= 0 {
+		return ts, nil
+	}
+	return p.storage.LastModified(seg.BaseOffset())
+}
+
+// deleteOldestSegment removes the oldest segment from the partition and disk (or from
+// remote storage if it only lives there), and moves the log start offset to the next
+// segment. A local segment that was also uploaded loses its remote copy as well.
+// Callers must hold p.mu.
+func (p *Partition) deleteOldestSegment() error {
+	if remoteOnly := p.remoteOnlySegments(); len(remoteOnly) > 0 {
+		meta := remoteOnly[0]
+		p.remoteSegments = p.remoteSegments[1:]
+		p.logStartOffset = max(p.logStartOffset, p.firstSegmentOffset())
+
+		fmt.Printf("[Partition %d] Deleting remote segment %d (LogStartOffset -> %d)\n", p.ID, meta.BaseOffset, p.logStartOffset)
+
+		return p.deleteRemoteSegment(meta.SegmentKey)
+	}
+
+	baseOffset := p.Segments[0]
+
+	p.Segments = p.Segments[1:]
+	p.logStartOffset = max(p.logStartOffset, p.Segments[0])
+	p.cache.Remove(p.cacheKey(baseOffset))
+	p.forgetMaxTimestamp(baseOffset)
+
+	fmt.Printf("[Partition %d] Deleting segment %d (LogStartOffset -> %d)\n", p.ID, baseOffset, p.logStartOffset)
+
+	if len(p.remoteSegments) > 0 && p.remoteSegments[0].BaseOffset == baseOffset {
+		key := p.remoteSegments[0].SegmentKey
+		p.remoteSegments = p.remoteSegments[1:]
+		if err := p.deleteRemoteSegment(key); err != nil {
+			return err
+		}
+	}
+
+	return p.storage.Remove(baseOffset)
+}
@@ -0,0 +1,82 @@
+package partition
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"lightkafka/internal/segment"
+)
+
+func TestPartition_Retention_Bytes(t *testing.T) {
+	p := newTestPartition(t, PartitionConfig{RetentionBytes: 322})
+
+	// 4 batches -> Segments [0, 5, 10, 15], 161 bytes each
+	for i := 0; i < 4; i++ {
+		if _, err := p.Append(createBatchBytes(5, time.Now().UnixMilli(), make([]byte, 100))); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	deleted, err := p.EnforceRetention()
+	if err != nil {
+		t.Fatalf("EnforceRetention failed: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("Deleted segments mismatch. Want 2, Got %d", deleted)
+	}
+	if p.LogStartOffset() != 10 {
+		t.Errorf("LogStartOffset mismatch. Want 10, Got %d", p.LogStartOffset())
+	}
+
+	if _, err := readBytes(p, 0, 1024); !errors.Is(err, segment.ErrOffsetOutOfRange) {
+		t.Errorf("Read below log start should be out of range, got %v", err)
+	}
+	if data, err := readBytes(p, 10, 1024); err != nil || len(data) == 0 {
+		t.Errorf("Read of retained offset failed. Len: %d, Err: %v", len(data), err)
+	}
+
+	if _, err := os.Stat(segment.FilePath(p.Dir, 0, segment.LogFileSuffix)); !os.IsNotExist(err) {
+		t.Errorf("Deleted segment file still exists (err: %v)", err)
+	}
+}
+
+func TestPartition_Retention_BytesMemoryStorage(t *testing.T) {
+	p := newTestPartition(t, PartitionConfig{RetentionBytes: 322, LogStorage: LogStorageMemory})
+
+	// Closed segments are sized through the storage, never opened
+	for i := 0; i < 4; i++ {
+		if _, err := p.Append(createBatchBytes(5, time.Now().UnixMilli(), make([]byte, 100))); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	if deleted, err := p.EnforceRetention(); err != nil || deleted != 2 {
+		t.Errorf("Deleted segments mismatch. Want 2, Got %d (err: %v)", deleted, err)
+	}
+	if p.LogStartOffset() != 10 {
+		t.Errorf("LogStartOffset mismatch. Want 10, Got %d", p.LogStartOffset())
+	}
+}
+
+func TestPartition_Retention_Time(t *testing.T) {
+	p := newTestPartition(t, PartitionConfig{RetentionMs: time.Minute.Milliseconds()})
+
+	old := time.Now().Add(-time.Hour).UnixMilli()
+	for _, ts := range []int64{old, old, time.Now().UnixMilli(), time.Now().UnixMilli()} {
+		if _, err := p.Append(createBatchBytes(5, ts, make([]byte, 100))); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	deleted, err := p.EnforceRetention()
+	if err != nil {
+		t.Fatalf("EnforceRetention failed: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("Deleted segments mismatch. Want 2, Got %d", deleted)
+	}
+	if len(p.Segments) != 2 || p.Segments[0] != 10 {
+		t.Errorf("Segments mismatch after retention: %v", p.Segments)
+	}
+}
@@ -0,0 +1,32 @@
+package partition
+
+import (
+	"fmt"
+	"time"
+)
+
+// schedule runs task every interval in the background until the partition is closed.
+func (p *Partition) schedule(name string, interval time.Duration, task func() error) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-p.quit:
+				return
+			case <-ticker.C:
+				// An offline directory is left alone until the broker restarts
+				if p.logDir.Load().Err() != nil {
+					continue
+				}
+				if err := p.checkStorage(task()); err != nil {
+					fmt.Printf("[Partition %d] %s failed: %v\n", p.ID, name, err)
+				}
+			}
+		}
+	}()
+}
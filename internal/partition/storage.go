@@ -0,0 +1,341 @@
+package partition
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"lightkafka/internal/resource"
+	"lightkafka/internal/segment"
+)
+
+// Storage engines (PartitionConfig.LogStorage).
+const (
+	LogStorageMmap   = "mmap"
+	LogStorageMemory = "memory"
+)
+
+// Storage creates, opens and removes the segments of one partition and keeps its
+// checkpoints. Segments are handed out as segment.LogStore; every store returned by
+// Create or Open belongs to the caller, who gives it back with Release.
+type Storage interface {
+	// Segments lists the base offsets of the existing segments, oldest first.
+	Segments() ([]int64, error)
+	// Create opens the segment at baseOffset for writing, creating it if needed.
+	// With verify, every batch of an existing segment is CRC-checked (see segment.NewSegment).
+	Create(baseOffset int64, verify bool) (segment.LogStore, error)
+	// Recover is Create for a segment that is durable up to recoveryPoint: only the
+	// batches after it are CRC-checked (see segment.RecoverSegment). truncated reports
+	// whether invalid data was cut off the end of the log.
+	Recover(baseOffset, recoveryPoint int64) (store segment.LogStore, truncated bool, err error)
+	// Open opens a closed segment for reading. Sealed segments skip CRC validation.
+	Open(baseOffset int64, sealed bool) (segment.LogStore, error)
+	// Remove deletes a closed segment. Missing segments are ignored.
+	Remove(baseOffset int64) error
+	// LastModified returns when the segment was last written (Unix ms), for segments
+	// without timestamps.
+	LastModified(baseOffset int64) (int64, error)
+	// Size returns the bytes of batches held by a closed segment, without opening it.
+	Size(baseOffset int64) (int64, error)
+
+	// ReadCheckpoint returns the offset stored under name. ok is false if there is none.
+	ReadCheckpoint(name string) (offset int64, ok bool, err error)
+	WriteCheckpoint(name string, offset int64) error
+	// ConsumeCleanShutdown reports whether the last Close was clean and clears the marker.
+	ConsumeCleanShutdown() (bool, error)
+	MarkCleanShutdown() error
+
+	Close() error
+}
+
+// newStorage opens the storage engine selected by c.LogStorage for dir.
+func newStorage(dir string, c PartitionConfig) (Storage, error) {
+	if c.LogStorage == LogStorageMemory {
+		return newMemoryStorage(c.SegmentConfig), nil
+	}
+	return newDiskStorage(dir, c.SegmentConfig)
+}
+
+// diskStorage keeps segments in mmap'ed files under the partition directory, which it
+// locks for its whole lifetime.
+type diskStorage struct {
+	dir     string
+	config  segment.Config
+	dirLock *resource.DirLock
+}
+
+func newDiskStorage(dir string, c segment.Config) (*diskStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	// Exclusive Lock: a second process writing the same mmap'ed files would corrupt them.
+	dirLock, err := resource.LockDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Discard output of a compaction that was interrupted before its swap.
+	if err := os.RemoveAll(filepath.Join(dir, cleanerDirName)); err != nil {
+		dirLock.Unlock()
+		return nil, err
+	}
+
+	return &diskStorage{dir: dir, config: c, dirLock: dirLock}, nil
+}
+
+// Segments scans the directory for .log files. No file is opened, to keep startup fast.
+func (d *diskStorage) Segments() ([]int64, error) {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []int64
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		// Only look for .log files (.index is handled by segment)
+		if strings.HasSuffix(name, segment.LogFileSuffix) {
+			prefix := strings.TrimSuffix(name, segment.LogFileSuffix)
+			baseOffset, err := strconv.ParseInt(prefix, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid log filename: %s", name)
+			}
+			segments = append(segments, baseOffset)
+		}
+	}
+
+	// Sort by BaseOffset ASC
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i] < segments[j]
+	})
+	return segments, nil
+}
+
+func (d *diskStorage) Create(baseOffset int64, verify bool) (segment.LogStore, error) {
+	if verify {
+		return segment.NewSegment(d.dir, baseOffset, d.config)
+	}
+	return segment.LoadSegment(d.dir, baseOffset, d.config)
+}
+
+func (d *diskStorage) Recover(baseOffset, recoveryPoint int64) (segment.LogStore, bool, error) {
+	seg, err := segment.RecoverSegment(d.dir, baseOffset, d.config, recoveryPoint)
+	if err != nil {
+		return nil, false, err
+	}
+	return seg, seg.Truncated(), nil
+}
+
+func (d *diskStorage) Open(baseOffset int64, sealed bool) (segment.LogStore, error) {
+	return segment.OpenReadOnly(d.dir, baseOffset, d.config, sealed)
+}
+
+func (d *diskStorage) Remove(baseOffset int64) error {
+	return segment.RemoveFiles(d.dir, baseOffset)
+}
+
+// LastModified returns the log file's modification time.
+func (d *diskStorage) LastModified(baseOffset int64) (int64, error) {
+	fi, err := os.Stat(segment.FilePath(d.dir, baseOffset, segment.LogFileSuffix))
+	if err != nil {
+		return 0, err
+	}
+	return fi.ModTime().UnixMilli(), nil
+}
+
+// Size returns the log file's size: closed segments are trimmed to their data on close.
+func (d *diskStorage) Size(baseOffset int64) (int64, error) {
+	fi, err := os.Stat(segment.FilePath(d.dir, baseOffset, segment.LogFileSuffix))
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+func (d *diskStorage) ReadCheckpoint(name string) (int64, bool, error) {
+	return readCheckpoint(filepath.Join(d.dir, name))
+}
+
+func (d *diskStorage) WriteCheckpoint(name string, offset int64) error {
+	if err := writeCheckpoint(filepath.Join(d.dir, name), offset); err != nil {
+		return fmt.Errorf("%w: write checkpoint %s: %w", segment.ErrStorage, name, err)
+	}
+	return nil
+}
+
+// ConsumeCleanShutdown removes the marker durably: if it came back after a crash,
+// unsynced data would be trusted on the next start.
+func (d *diskStorage) ConsumeCleanShutdown() (bool, error) {
+	err := os.Remove(filepath.Join(d.dir, cleanShutdownFile))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, syncPath(d.dir)
+}
+
+func (d *diskStorage) MarkCleanShutdown() error {
+	if err := os.WriteFile(filepath.Join(d.dir, cleanShutdownFile), nil, 0644); err != nil {
+		return err
+	}
+	return syncPath(d.dir)
+}
+
+// Close releases the directory lock.
+func (d *diskStorage) Close() error {
+	return d.dirLock.Unlock()
+}
+
+// memoryStorage keeps segments in segment.MemoryStore and never touches disk.
+// It holds the owner reference of every store; Create and Open hand out extra ones,
+// wrapped in a memoryHandle so that callers give them back with Close like a Segment.
+type memoryStorage struct {
+	mu          sync.Mutex
+	config      segment.Config
+	stores      map[int64]*segment.MemoryStore
+	checkpoints map[string]int64
+}
+
+func newMemoryStorage(c segment.Config) *memoryStorage {
+	return &memoryStorage{
+		config:      c,
+		stores:      make(map[int64]*segment.MemoryStore),
+		checkpoints: make(map[string]int64),
+	}
+}
+
+func (m *memoryStorage) Segments() ([]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Sorted(maps.Keys(m.stores)), nil
+}
+
+func (m *memoryStorage) Create(baseOffset int64, verify bool) (segment.LogStore, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	store, ok := m.stores[baseOffset]
+	if !ok {
+		var err error
+		if store, err = segment.NewMemoryStore(baseOffset, m.config); err != nil {
+			return nil, err
+		}
+		m.stores[baseOffset] = store
+	}
+	store.Acquire()
+	return &memoryHandle{MemoryStore: store}, nil
+}
+
+// Recover is Create: memory stores do not outlive the process, there is nothing to verify.
+func (m *memoryStorage) Recover(baseOffset, recoveryPoint int64) (segment.LogStore, bool, error) {
+	store, err := m.Create(baseOffset, false)
+	return store, false, err
+}
+
+func (m *memoryStorage) Open(baseOffset int64, sealed bool) (segment.LogStore, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	store, ok := m.stores[baseOffset]
+	if !ok {
+		return nil, fmt.Errorf("open segment %d: %w", baseOffset, fs.ErrNotExist)
+	}
+	store.Acquire()
+	return &memoryHandle{MemoryStore: store}, nil
+}
+
+func (m *memoryStorage) Remove(baseOffset int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if store, ok := m.stores[baseOffset]; ok {
+		delete(m.stores, baseOffset)
+		return store.Close()
+	}
+	return nil
+}
+
+func (m *memoryStorage) LastModified(baseOffset int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	store, ok := m.stores[baseOffset]
+	if !ok {
+		return 0, fmt.Errorf("segment %d: %w", baseOffset, fs.ErrNotExist)
+	}
+	return store.ModTime(), nil
+}
+
+func (m *memoryStorage) Size(baseOffset int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	store, ok := m.stores[baseOffset]
+	if !ok {
+		return 0, fmt.Errorf("segment %d: %w", baseOffset, fs.ErrNotExist)
+	}
+	return store.Size(), nil
+}
+
+func (m *memoryStorage) ReadCheckpoint(name string) (int64, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	offset, ok := m.checkpoints[name]
+	return offset, ok, nil
+}
+
+func (m *memoryStorage) WriteCheckpoint(name string, offset int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checkpoints[name] = offset
+	return nil
+}
+
+// ConsumeCleanShutdown is always false: a memory partition starts empty.
+func (m *memoryStorage) ConsumeCleanShutdown() (bool, error) {
+	return false, nil
+}
+
+func (m *memoryStorage) MarkCleanShutdown() error {
+	return nil
+}
+
+// Close drops every segment.
+func (m *memoryStorage) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for baseOffset, store := range m.stores {
+		store.Close()
+		delete(m.stores, baseOffset)
+	}
+	return nil
+}
+
+// memoryHandle is a reference to a store handed out by memoryStorage. Close gives the
+// reference back once; the store itself stays open until memoryStorage drops it.
+type memoryHandle struct {
+	*segment.MemoryStore
+	closed atomic.Bool
+}
+
+func (h *memoryHandle) Close() error {
+	if !h.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+	return h.MemoryStore.Release()
+}
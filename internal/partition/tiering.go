@@ -0,0 +1,287 @@
+package partition
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"lightkafka/internal/remote"
+	"lightkafka/internal/segment"
+)
+
+// Tiered storage
+//
+// Sealed segments are copied to Config.RemoteStorage and recorded in p.remoteSegments.
+// Once a copy exists and the segment is older than local.retention.ms, the local files
+// are deleted and the segment drops out of p.Segments. The log then consists of the
+// remote-only segments (base offset < Segments[0]) followed by the local segments.
+// Reads of remote-only offsets go through Config.RemoteFetchCache, which downloads the
+// segment into a local cache directory, and the shared SegmentCache.
+
+// startTiering launches the tiering manager if remote storage is configured.
+func (p *Partition) startTiering() {
+	if p.Config.RemoteStorage == nil {
+		return
+	}
+
+	intervalMs := p.Config.TieringIntervalMs
+	if intervalMs <= 0 {
+		intervalMs = defaultTieringIntervalMs
+	}
+
+	p.schedule("tiering", time.Duration(intervalMs)*time.Millisecond, func() error {
+		_, _, err := p.Tier()
+		return err
+	})
+}
+
+// loadRemoteSegments reads the remote segment list when the partition is opened.
+// If the local log is empty (e.g. a replaced disk) it is restarted after the last
+// remote segment. Callers: NewPartition, before any background task starts.
+func (p *Partition) loadRemoteSegments() error {
+	if p.Config.RemoteStorage == nil {
+		return nil
+	}
+
+	metas, err := p.Config.RemoteStorage.ListSegments(p.Topic, p.ID)
+	if err != nil {
+		return err
+	}
+	if len(metas) == 0 {
+		return nil
+	}
+
+	remoteEnd := metas[len(metas)-1].NextOffset
+	if len(p.Segments) == 1 && p.activeSegment.Size() == 0 && p.activeSegment.BaseOffset() < remoteEnd {
+		seg, err := p.storage.Create(remoteEnd, true)
+		if err != nil {
+			return err
+		}
+		oldSeg := p.activeSegment
+		p.activeSegment = seg
+		p.Segments = []int64{remoteEnd}
+		p.recoveryPoint.Store(remoteEnd)
+		if err := errors.Join(oldSeg.Close(), p.storage.Remove(oldSeg.BaseOffset())); err != nil {
+			return err
+		}
+	}
+
+	// Copies past the local log end are left over from a truncation
+	for len(metas) > 0 && metas[len(metas)-1].NextOffset > p.activeSegment.NextOffset() {
+		if err := p.deleteRemoteSegment(metas[len(metas)-1].SegmentKey); err != nil {
+			return err
+		}
+		metas = metas[:len(metas)-1]
+	}
+
+	p.remoteSegments = metas
+	return nil
+}
+
+// Tier copies sealed segments to remote storage and deletes the local copies of
+// uploaded segments older than local.retention.ms. It returns the number of uploaded
+// segments and of deleted local copies.
+func (p *Partition) Tier() (uploaded, deleted int, err error) {
+	if p.Config.RemoteStorage == nil {
+		return 0, 0, nil
+	}
+
+	p.cleanerMu.Lock()
+	defer p.cleanerMu.Unlock()
+
+	// 1. Upload sealed segments that have no remote copy yet
+	p.mu.RLock()
+	candidates := p.uploadCandidates()
+	p.mu.RUnlock()
+
+	for _, baseOffset := range candidates {
+		ok, err := p.uploadSegment(baseOffset)
+		if err != nil {
+			return uploaded, 0, err
+		}
+		if ok {
+			uploaded++
+		}
+	}
+
+	// 2. Drop local copies past local retention
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	deleted, err = p.deleteUploadedLocalSegments()
+	return uploaded, deleted, err
+}
+
+// uploadCandidates returns the closed segments after the last remote copy that are
+// entirely below the recovery point (synced). Callers must hold p.mu.
+func (p *Partition) uploadCandidates() []int64 {
+	uploadedEnd := int64(-1)
+	if len(p.remoteSegments) > 0 {
+		uploadedEnd = p.remoteSegments[len(p.remoteSegments)-1].NextOffset
+	}
+
+	var candidates []int64
+	closed := p.closedSegments()
+	for i, baseOffset := range closed {
+		if baseOffset < uploadedEnd {
+			continue
+		}
+		if p.Segments[i+1] > p.recoveryPoint.Load() {
+			break
+		}
+		candidates = append(candidates, baseOffset)
+	}
+	return candidates
+}
+
+// uploadSegment copies one closed segment to remote storage. The copy is recorded only
+// if the segment still exists once the upload is done; otherwise it is deleted again.
+func (p *Partition) uploadSegment(baseOffset int64) (bool, error) {
+	seg, err := p.openClosedSegment(baseOffset)
+	if err != nil || seg == nil {
+		return false, err
+	}
+
+	meta := remote.SegmentMetadata{
+		SegmentKey:  remote.SegmentKey{Topic: p.Topic, Partition: p.ID, BaseOffset: baseOffset},
+		NextOffset:  seg.NextOffset(),
+		SizeInBytes: seg.Size(),
+	}
+	meta.MaxTimestamp, err = p.segmentTimestamp(seg)
+	seg.Release()
+	if err != nil {
+		return false, err
+	}
+
+	p.mu.RLock()
+	if idx := slices.Index(p.Segments, baseOffset); idx >= 0 && idx+1 < len(p.Segments) {
+		meta.NextOffset = p.Segments[idx+1] // Keep the remote log contiguous
+	}
+	p.mu.RUnlock()
+
+	if err := p.Config.RemoteStorage.PutSegment(meta, p.Dir); err != nil {
+		return false, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Deleted or truncated away while we were uploading
+	if !slices.Contains(p.closedSegments(), baseOffset) {
+		return false, p.Config.RemoteStorage.DeleteSegment(meta.SegmentKey)
+	}
+
+	p.remoteSegments = append(p.remoteSegments, meta)
+	fmt.Printf("[Partition %d] Uploaded segment %d to remote storage\n", p.ID, baseOffset)
+	return true, nil
+}
+
+// deleteUploadedLocalSegments deletes the oldest local segments that have a remote copy
+// and are older than local.retention.ms. The log start offset does not move: the
+// records stay readable from remote storage. Callers must hold p.mu.
+func (p *Partition) deleteUploadedLocalSegments() (int, error) {
+	now := time.Now().UnixMilli()
+	deleted := 0
+
+	for len(p.Segments) > 1 {
+		baseOffset := p.Segments[0]
+		meta, ok := p.remoteSegmentAt(baseOffset)
+		if !ok {
+			break
+		}
+		if p.Config.LocalRetentionMs > 0 && now-meta.MaxTimestamp <= p.Config.LocalRetentionMs {
+			break
+		}
+
+		p.Segments = p.Segments[1:]
+		p.cache.Remove(p.cacheKey(baseOffset))
+		p.forgetMaxTimestamp(baseOffset)
+		if err := p.storage.Remove(baseOffset); err != nil {
+			return deleted, err
+		}
+		deleted++
+
+		fmt.Printf("[Partition %d] Deleted local copy of segment %d (kept in remote storage)\n", p.ID, baseOffset)
+	}
+
+	return deleted, nil
+}
+
+// remoteOnlySegments returns the remote segments whose local copy is gone: the oldest
+// part of the log. Callers must hold p.mu.
+func (p *Partition) remoteOnlySegments() []remote.SegmentMetadata {
+	n := sort.Search(len(p.remoteSegments), func(i int) bool {
+		return p.remoteSegments[i].BaseOffset >= p.Segments[0]
+	})
+	return p.remoteSegments[:n]
+}
+
+// remoteSegmentAt returns the remote copy of the segment starting at baseOffset.
+// Callers must hold p.mu.
+func (p *Partition) remoteSegmentAt(baseOffset int64) (remote.SegmentMetadata, bool) {
+	i := sort.Search(len(p.remoteSegments), func(i int) bool {
+		return p.remoteSegments[i].BaseOffset >= baseOffset
+	})
+	if i < len(p.remoteSegments) && p.remoteSegments[i].BaseOffset == baseOffset {
+		return p.remoteSegments[i], true
+	}
+	return remote.SegmentMetadata{}, false
+}
+
+// remoteSegmentFor returns the remote-only segment that holds offset (or the first one
+// after it). Callers must hold p.mu.
+func (p *Partition) remoteSegmentFor(offset int64) (remote.SegmentMetadata, bool) {
+	remoteOnly := p.remoteOnlySegments()
+	i := sort.Search(len(remoteOnly), func(i int) bool {
+		return remoteOnly[i].NextOffset > offset
+	})
+	if i == len(remoteOnly) {
+		return remote.SegmentMetadata{}, false
+	}
+	return remoteOnly[i], true
+}
+
+// firstSegmentOffset returns the base offset of the oldest segment, remote or local.
+// Callers must hold p.mu.
+func (p *Partition) firstSegmentOffset() int64 {
+	if remoteOnly := p.remoteOnlySegments(); len(remoteOnly) > 0 {
+		return remoteOnly[0].BaseOffset
+	}
+	return p.Segments[0]
+}
+
+// readRemote reads from a remote-only segment. It must be called without p.mu held,
+// since a cache miss downloads the whole segment.
+func (p *Partition) readRemote(meta remote.SegmentMetadata, offset int64, maxBytes int32) (*segment.View, error) {
+	seg, err := p.openRemoteSegment(meta.SegmentKey)
+	if err != nil {
+		return nil, err
+	}
+	defer seg.Release()
+
+	return seg.ReadView(max(offset, meta.BaseOffset), maxBytes)
+}
+
+// openRemoteSegment returns a remote-only segment through the shared cache, fetching
+// its files into the remote fetch cache first. The files stay pinned until they are
+// mapped, so a concurrent eviction cannot delete them first. The caller must Release it.
+func (p *Partition) openRemoteSegment(key remote.SegmentKey) (segment.LogStore, error) {
+	dir, release, err := p.Config.RemoteFetchCache.Fetch(key)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	loader := func() (segment.LogStore, error) {
+		return segment.OpenReadOnly(dir, key.BaseOffset, p.Config.SegmentConfig, true)
+	}
+	return p.cache.GetOrLoad(p.cacheKey(key.BaseOffset), loader)
+}
+
+// deleteRemoteSegment deletes a segment from remote storage and from the fetch cache.
+func (p *Partition) deleteRemoteSegment(key remote.SegmentKey) error {
+	p.Config.RemoteFetchCache.Remove(key)
+	return p.Config.RemoteStorage.DeleteSegment(key)
+}
@@ -0,0 +1,112 @@
+package partition
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"lightkafka/internal/remote"
+	"lightkafka/internal/resource"
+	"lightkafka/internal/segment"
+)
+
+func TestPartition_Tiering(t *testing.T) {
+	dir := t.TempDir()
+	cache := resource.NewSegmentCache(10)
+	defer cache.Close()
+
+	store, err := remote.NewLocalStorage(filepath.Join(t.TempDir(), "remote"))
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+	fetchCache, err := resource.NewRemoteFetchCache(filepath.Join(t.TempDir(), "fetch"), 2, store, cache)
+	if err != nil {
+		t.Fatalf("NewRemoteFetchCache failed: %v", err)
+	}
+	defer fetchCache.Close()
+
+	c := PartitionConfig{
+		SegmentConfig: segment.Config{
+			SegmentMaxBytes:    200,
+			IndexMaxBytes:      1024,
+			IndexIntervalBytes: 4096,
+		},
+		RemoteStorage:    store,
+		RemoteFetchCache: fetchCache,
+		LocalRetentionMs: 0, // Delete local copies as soon as they are uploaded
+	}
+
+	p, err := NewPartition(dir, "test", 0, c, cache)
+	if err != nil {
+		t.Fatalf("Failed to create partition: %v", err)
+	}
+
+	// 4 batches -> Segments [0, 5, 10, 15]
+	want := make(map[int64][]byte)
+	for i := 0; i < 4; i++ {
+		offset, err := p.Append(createBatchBytes(5, time.Now().UnixMilli(), bytes.Repeat([]byte{byte(i)}, 100)))
+		if err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+		if want[offset], err = readBytes(p, offset, 1024); err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+	}
+
+	uploaded, deleted, err := p.Tier()
+	if err != nil {
+		t.Fatalf("Tier failed: %v", err)
+	}
+	if uploaded != 3 || deleted != 3 {
+		t.Errorf("Tier mismatch. Uploaded %d (want 3), deleted %d (want 3)", uploaded, deleted)
+	}
+	if len(p.Segments) != 1 || p.Segments[0] != 15 {
+		t.Errorf("Local segments mismatch. Want [15], Got %v", p.Segments)
+	}
+	if _, err := os.Stat(segment.FilePath(p.Dir, 0, segment.LogFileSuffix)); !os.IsNotExist(err) {
+		t.Errorf("Local copy of segment 0 should be deleted (err: %v)", err)
+	}
+	if p.LogStartOffset() != 0 {
+		t.Errorf("LogStartOffset must not move when local copies are deleted, got %d", p.LogStartOffset())
+	}
+
+	// Remote offsets are served through the fetch cache (capacity 2 forces an eviction)
+	for _, offset := range []int64{0, 5, 10, 0} {
+		data, err := readBytes(p, offset, 1024)
+		if err != nil || !bytes.Equal(data, want[offset]) {
+			t.Errorf("Remote read(%d) mismatch (err: %v)", offset, err)
+		}
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Reopen: the remote segments are rediscovered
+	p, err = NewPartition(dir, "test", 0, c, cache)
+	if err != nil {
+		t.Fatalf("Failed to reopen partition: %v", err)
+	}
+	defer p.Close()
+
+	if p.LogStartOffset() != 0 || p.LogEndOffset() != 20 {
+		t.Errorf("Reopened offsets mismatch. LogStartOffset %d (want 0), LogEndOffset %d (want 20)", p.LogStartOffset(), p.LogEndOffset())
+	}
+	if data, err := readBytes(p, 5, 1024); err != nil || !bytes.Equal(data, want[5]) {
+		t.Errorf("Remote read after reopen mismatch (err: %v)", err)
+	}
+
+	// Deleting records removes remote-only segments too
+	if _, err := p.DeleteRecordsBefore(7); err != nil {
+		t.Fatalf("DeleteRecordsBefore failed: %v", err)
+	}
+	metas, err := store.ListSegments("test", 0)
+	if err != nil {
+		t.Fatalf("ListSegments failed: %v", err)
+	}
+	if len(metas) != 2 || metas[0].BaseOffset != 5 {
+		t.Errorf("Remote segments after delete mismatch: %+v", metas)
+	}
+}
@@ -0,0 +1,75 @@
+package partition
+
+import (
+	"fmt"
+	"slices"
+
+	"lightkafka/internal/message"
+	"lightkafka/internal/segment"
+)
+
+// Producers always send CreateTime batches. With message.timestamp.type=CreateTime the
+// broker keeps their timestamps, but rejects batches whose clock is off by more than
+// MaxTimestampDiffMs: they would break time-based retention and offset lookups. With
+// LogAppendTime the broker overwrites the timestamps when appending (see Append), so
+// consumers see the ingestion time and the producer's clock does not matter.
+
+// checkTimestampType rejects batches claiming LogAppendTime.
+func checkTimestampType(batch *message.RecordBatch) error {
+	if batch.Header.TimestampType() != message.TimestampCreateTime {
+		return fmt.Errorf("%w: producers must send CreateTime batches", message.ErrInvalidTimestamp)
+	}
+	return nil
+}
+
+// maxTimestampDiffMs returns how far CreateTime timestamps may be from broker time,
+// 0 if they are not checked. Validate checks them along with the records.
+func (p *Partition) maxTimestampDiffMs() int64 {
+	if p.Config.logAppendTime() {
+		return 0
+	}
+	return p.Config.MaxTimestampDiffMs
+}
+
+// A closed segment's largest timestamp only changes through compaction, which drops
+// records and so can only lower it. It is kept in maxTimestamps once the segment has
+// been rolled, recovered or opened, so that OffsetForTimestamp skips segments that
+// cannot hold a match, as it does with the MaxTimestamp of remote segments.
+
+// knownMaxTimestamp returns the largest timestamp of a closed segment, if known.
+func (p *Partition) knownMaxTimestamp(baseOffset int64) (int64, bool) {
+	p.maxTimestampsMu.Lock()
+	defer p.maxTimestampsMu.Unlock()
+	ts, ok := p.maxTimestamps[baseOffset]
+	return ts, ok
+}
+
+func (p *Partition) rememberMaxTimestamp(baseOffset, ts int64) {
+	p.maxTimestampsMu.Lock()
+	defer p.maxTimestampsMu.Unlock()
+	p.maxTimestamps[baseOffset] = ts
+}
+
+// forgetMaxTimestamp drops the entry of a segment that is deleted or active again.
+func (p *Partition) forgetMaxTimestamp(baseOffset int64) {
+	p.maxTimestampsMu.Lock()
+	defer p.maxTimestampsMu.Unlock()
+	delete(p.maxTimestamps, baseOffset)
+}
+
+// loadClosedSegment is loadSegment for callers that do not hold p.mu, and remembers the
+// segment's largest timestamp. It returns nil if the segment is no longer closed.
+func (p *Partition) loadClosedSegment(baseOffset int64) (segment.LogStore, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if !slices.Contains(p.closedSegments(), baseOffset) {
+		return nil, nil
+	}
+	seg, err := p.loadSegment(baseOffset)
+	if err != nil {
+		return nil, err
+	}
+	p.rememberMaxTimestamp(baseOffset, seg.MaxTimestamp())
+	return seg, nil
+}
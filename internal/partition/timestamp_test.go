@@ -0,0 +1,116 @@
+package partition
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"lightkafka/internal/message"
+	"lightkafka/internal/segment"
+)
+
+// encodeTimestampBatch builds a batch of records with the given CreateTime timestamps.
+func encodeTimestampBatch(timestamps ...int64) []byte {
+	h := message.BatchHeader{
+		LastOffsetDelta: int32(len(timestamps) - 1),
+		BaseTimestamp:   timestamps[0],
+		RecordsCount:    int32(len(timestamps)),
+	}
+	var payload []byte
+	for i, ts := range timestamps {
+		h.MaxTimestamp = max(h.MaxTimestamp, ts)
+		payload = message.AppendRecord(payload, &message.Record{
+			OffsetDelta:    int32(i),
+			TimestampDelta: ts - timestamps[0],
+			Value:          []byte("v"),
+		})
+	}
+	return message.EncodeBatch(h, payload)
+}
+
+func TestPartition_LogAppendTime(t *testing.T) {
+	p := newTestPartition(t, PartitionConfig{TimestampType: TimestampTypeLogAppendTime})
+
+	before := time.Now().UnixMilli()
+	if _, err := p.Append(encodeTimestampBatch(1000, 2000)); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	after := time.Now().UnixMilli()
+
+	data, err := readBytes(p, 0, 1024)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	batch, err := message.DecodeBatch(data)
+	if err != nil {
+		t.Fatalf("Stamped batch does not decode (CRC not recomputed?): %v", err)
+	}
+	h := batch.Header
+	if h.TimestampType() != message.TimestampLogAppendTime {
+		t.Errorf("Timestamp type: want LogAppendTime, got %s", h.TimestampType())
+	}
+	if h.MaxTimestamp < before || h.MaxTimestamp > after || h.BaseTimestamp != h.MaxTimestamp {
+		t.Errorf("Timestamps not broker time [%d, %d]: base %d, max %d", before, after, h.BaseTimestamp, h.MaxTimestamp)
+	}
+
+	var rec message.Record
+	it := batch.NewIterator()
+	for it.Next(&rec) {
+		if rec.Timestamp != h.MaxTimestamp {
+			t.Errorf("Record %d timestamp: want %d, got %d", rec.Offset, h.MaxTimestamp, rec.Timestamp)
+		}
+	}
+}
+
+func TestPartition_CreateTimeSkew(t *testing.T) {
+	p := newTestPartition(t, PartitionConfig{MaxTimestampDiffMs: 60 * 1000})
+	now := time.Now().UnixMilli()
+
+	if _, err := p.Append(encodeTimestampBatch(now, now+1)); err != nil {
+		t.Fatalf("Append of current timestamps failed: %v", err)
+	}
+
+	cases := map[string][]byte{
+		"past":   encodeTimestampBatch(now - 2*60*1000),
+		"future": encodeTimestampBatch(now + 2*60*1000),
+		"record": encodeTimestampBatch(now, now-2*60*1000), // MaxTimestamp is fine, one record is not
+	}
+	stamped := encodeTimestampBatch(now)
+	message.SetLogAppendTime(stamped, now)
+	cases["log append time"] = stamped
+
+	for name, batch := range cases {
+		if _, err := p.Append(batch); !errors.Is(err, message.ErrInvalidTimestamp) {
+			t.Errorf("%s: want ErrInvalidTimestamp, got %v", name, err)
+		}
+	}
+	if p.LogEndOffset() != 2 {
+		t.Errorf("LogEndOffset after rejected batches: %d, want 2", p.LogEndOffset())
+	}
+}
+
+func TestPartition_OffsetForTimestamp(t *testing.T) {
+	p := newTestPartition(t, PartitionConfig{})
+	for _, ts := range []int64{1000, 2000, 3000, 4000} {
+		if _, err := p.Append(createBatchBytes(1, ts, make([]byte, 100))); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	// Segments [0] and [1] are known to be too old: they must not be opened
+	for _, baseOffset := range []int64{0, 1} {
+		p.cache.Remove(p.cacheKey(baseOffset))
+		if err := segment.RemoveFiles(p.Dir, baseOffset); err != nil {
+			t.Fatalf("RemoveFiles failed: %v", err)
+		}
+	}
+
+	for ts, want := range map[int64]int64{2500: 2, 3000: 2, 3500: 3, 5000: 4} {
+		if offset, err := p.OffsetForTimestamp(ts); err != nil || offset != want {
+			t.Errorf("OffsetForTimestamp(%d): want %d, got %d (err: %v)", ts, want, offset, err)
+		}
+	}
+	if _, err := p.OffsetForTimestamp(500); err == nil {
+		t.Error("OffsetForTimestamp(500) should open the deleted segment [0] and fail")
+	}
+}
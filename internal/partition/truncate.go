@@ -0,0 +1,107 @@
+package partition
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"lightkafka/internal/segment"
+)
+
+// TruncateTo removes every record at or after offset, e.g. when a follower diverged
+// from a new leader or to undo a bad produce burst. Segments that start after the
+// cut are deleted, and the segment containing it becomes the active segment and is
+// cut back on a batch boundary. The log end offset may therefore end up below offset
+// when offset falls inside a batch. The result is synced and the recovery point is
+// checkpointed before TruncateTo returns.
+func (p *Partition) TruncateTo(offset int64) (err error) {
+	// The cleaner must not record segments that are cut away as compacted
+	p.cleanerMu.Lock()
+	defer p.cleanerMu.Unlock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.logDir.Load().Err(); err != nil {
+		return err
+	}
+	defer func() { p.checkStorage(err) }()
+
+	if offset >= p.activeSegment.NextOffset() {
+		return nil
+	}
+	// Remote-only segments are sealed history and cannot be cut back
+	if offset < p.logStartOffset || offset < p.Segments[0] {
+		return segment.ErrOffsetOutOfRange
+	}
+
+	fmt.Printf("[Partition %d] Truncating log to offset %d (LogEndOffset %d)\n", p.ID, offset, p.activeSegment.NextOffset())
+
+	// Segments written after the cut start out dirty
+	if offset < p.cleanedUpTo {
+		p.cleanedUpTo = offset
+		if err := p.storage.WriteCheckpoint(cleanerOffsetCheckpointFile, offset); err != nil {
+			return err
+		}
+	}
+
+	// 1. Make the segment containing offset the active one
+	idx := sort.Search(len(p.Segments), func(i int) bool {
+		return p.Segments[i] > offset
+	}) - 1
+	if idx < 0 {
+		idx = 0
+	}
+
+	if baseOffset := p.Segments[idx]; baseOffset != p.activeSegment.BaseOffset() {
+		// Open it writable first, so a failure leaves the current active segment in place
+		p.cache.Remove(p.cacheKey(baseOffset))
+		p.forgetMaxTimestamp(baseOffset)
+		seg, err := p.storage.Create(baseOffset, true)
+		if err != nil {
+			return err
+		}
+		oldSeg := p.activeSegment
+		p.activeSegment = seg
+		p.activeSince = time.Now().UnixMilli() // segment.ms starts over
+		closeErr := oldSeg.Close()
+
+		// Newest first: a crash in between leaves a shorter, still contiguous log
+		for i := len(p.Segments) - 1; i > idx; i-- {
+			p.cache.Remove(p.cacheKey(p.Segments[i]))
+			p.forgetMaxTimestamp(p.Segments[i])
+			if err := p.storage.Remove(p.Segments[i]); err != nil {
+				return errors.Join(closeErr, err)
+			}
+			p.Segments = p.Segments[:i]
+		}
+		if closeErr != nil {
+			return closeErr
+		}
+	}
+
+	// 2. Cut the active segment back and persist the result
+	if err := p.activeSegment.TruncateTo(offset); err != nil {
+		return err
+	}
+	if err := p.activeSegment.Flush(); err != nil {
+		return err
+	}
+
+	// Remote copies of the segments that were cut are stale now
+	for len(p.remoteSegments) > 0 && p.remoteSegments[len(p.remoteSegments)-1].NextOffset > p.activeSegment.NextOffset() {
+		last := p.remoteSegments[len(p.remoteSegments)-1]
+		p.remoteSegments = p.remoteSegments[:len(p.remoteSegments)-1]
+		if err := p.deleteRemoteSegment(last.SegmentKey); err != nil {
+			return err
+		}
+	}
+
+	if p.activeSegment.Size() == 0 {
+		p.activeSince = 0
+	}
+
+	p.recoveryPoint.Store(min(p.recoveryPoint.Load(), p.activeSegment.NextOffset()))
+	return p.writeRecoveryPoint()
+}
@@ -0,0 +1,76 @@
+package partition
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"lightkafka/internal/resource"
+	"lightkafka/internal/segment"
+)
+
+func TestPartition_TruncateTo(t *testing.T) {
+	dir := t.TempDir()
+	cache := resource.NewSegmentCache(10)
+	defer cache.Close()
+
+	c := PartitionConfig{SegmentConfig: segment.Config{
+		SegmentMaxBytes:    200,
+		IndexMaxBytes:      1024,
+		IndexIntervalBytes: 4096,
+	}}
+
+	p, err := NewPartition(dir, "test", 0, c, cache)
+	if err != nil {
+		t.Fatalf("Failed to create partition: %v", err)
+	}
+
+	// 4 batches -> Segments [0, 5, 10, 15]
+	for i := 0; i < 4; i++ {
+		if _, err := p.Append(createBatchBytes(5, time.Now().UnixMilli(), make([]byte, 100))); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	// Warm the cache so the truncated segment has a read-only handle to replace
+	if _, err := readBytes(p, 5, 1024); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	// 7 is inside batch [5, 9]: the whole batch goes, together with segments [10] and [15]
+	if err := p.TruncateTo(7); err != nil {
+		t.Fatalf("TruncateTo failed: %v", err)
+	}
+	if p.LogEndOffset() != 5 || len(p.Segments) != 2 {
+		t.Errorf("After truncate: LogEndOffset %d (want 5), Segments %v (want [0 5])", p.LogEndOffset(), p.Segments)
+	}
+	if p.RecoveryPoint() != 5 {
+		t.Errorf("RecoveryPoint mismatch. Want 5, Got %d", p.RecoveryPoint())
+	}
+	for _, base := range []int64{10, 15} {
+		if _, err := os.Stat(segment.FilePath(p.Dir, base, segment.LogFileSuffix)); !os.IsNotExist(err) {
+			t.Errorf("Segment %d should be deleted (err: %v)", base, err)
+		}
+	}
+	if data, err := readBytes(p, 5, 1024); err != nil || data != nil {
+		t.Errorf("Read at the new log end should be empty. Len: %d, Err: %v", len(data), err)
+	}
+
+	// The log keeps growing from the cut
+	offset, err := p.Append(createBatchBytes(3, time.Now().UnixMilli(), make([]byte, 10)))
+	if err != nil || offset != 5 {
+		t.Fatalf("Append after truncate: offset %d (want 5), err %v", offset, err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	p, err = NewPartition(dir, "test", 0, c, cache)
+	if err != nil {
+		t.Fatalf("Failed to reopen partition: %v", err)
+	}
+	defer p.Close()
+
+	if p.LogEndOffset() != 8 {
+		t.Errorf("Reopened LogEndOffset mismatch. Want 8, Got %d", p.LogEndOffset())
+	}
+}
@@ -1,8 +1,51 @@
 package protocol
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	ErrInvalidRequestSize = errors.New("invalid request size")
 	ErrPacketTooShort     = errors.New("packet too short")
 )
+
+// ErrorCode is a Kafka error code carried in a response body. ErrorNone means success.
+type ErrorCode int16
+
+// NOTE(Danu): Kafka와 같은 번호를 사용 (클라이언트가 재시도 여부를 판단할 수 있도록)
+const (
+	ErrorUnknownServerError         ErrorCode = -1
+	ErrorNone                       ErrorCode = 0
+	ErrorOffsetOutOfRange           ErrorCode = 1
+	ErrorCorruptMessage             ErrorCode = 2
+	ErrorMessageTooLarge            ErrorCode = 10
+	ErrorInvalidTimestamp           ErrorCode = 32
+	ErrorKafkaStorageError          ErrorCode = 56
+	ErrorUnsupportedCompressionType ErrorCode = 76
+	ErrorInvalidRecord              ErrorCode = 87
+)
+
+func (c ErrorCode) Error() string {
+	switch c {
+	case ErrorUnknownServerError:
+		return "UNKNOWN_SERVER_ERROR"
+	case ErrorNone:
+		return "NONE"
+	case ErrorOffsetOutOfRange:
+		return "OFFSET_OUT_OF_RANGE"
+	case ErrorCorruptMessage:
+		return "CORRUPT_MESSAGE"
+	case ErrorMessageTooLarge:
+		return "MESSAGE_TOO_LARGE"
+	case ErrorInvalidTimestamp:
+		return "INVALID_TIMESTAMP"
+	case ErrorKafkaStorageError:
+		return "KAFKA_STORAGE_ERROR"
+	case ErrorUnsupportedCompressionType:
+		return "UNSUPPORTED_COMPRESSION_TYPE"
+	case ErrorInvalidRecord:
+		return "INVALID_RECORD"
+	}
+	return fmt.Sprintf("error code %d", int16(c))
+}
@@ -0,0 +1,57 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// NOTE(Danu): Produce Response Body
+// NOTE(Danu): Structure: [ErrorCode(2)] + [Offset(8)] + [RecordIndex(4)] + [ErrorMessageLength(2)] + [ErrorMessage...]
+const (
+	PRODUCE_RESPONSE_BODY_SIZE = 16   //NOTE(Danu): ErrorMessage 앞의 고정 크기
+	MAX_ERROR_MESSAGE_SIZE     = 1024 //NOTE(Danu): 에러 메시지는 잘라서 보냄
+)
+
+// ProduceResponse is the body of a Produce response. A rejected batch carries its
+// error code, Offset -1, and, when a single record is at fault, that record's index
+// in the batch (-1 otherwise) with the broker's reason.
+type ProduceResponse struct {
+	ErrorCode    ErrorCode
+	Offset       int64 // Base offset of the appended batch, -1 on error
+	RecordIndex  int32 // Position of the invalid record in the batch, -1 if not a single record
+	ErrorMessage string
+}
+
+// Encode returns the response body. ErrorMessage is cut to MAX_ERROR_MESSAGE_SIZE bytes.
+func (r *ProduceResponse) Encode() []byte {
+	errMsg := r.ErrorMessage
+	if len(errMsg) > MAX_ERROR_MESSAGE_SIZE {
+		errMsg = errMsg[:MAX_ERROR_MESSAGE_SIZE]
+	}
+
+	body := make([]byte, PRODUCE_RESPONSE_BODY_SIZE+len(errMsg))
+	binary.BigEndian.PutUint16(body[0:2], uint16(r.ErrorCode))
+	binary.BigEndian.PutUint64(body[2:10], uint64(r.Offset))
+	binary.BigEndian.PutUint32(body[10:14], uint32(r.RecordIndex))
+	binary.BigEndian.PutUint16(body[14:16], uint16(len(errMsg)))
+	copy(body[16:], errMsg)
+	return body
+}
+
+// DecodeProduceResponse parses a body written by Encode.
+func DecodeProduceResponse(body []byte) (ProduceResponse, error) {
+	if len(body) < PRODUCE_RESPONSE_BODY_SIZE {
+		return ProduceResponse{}, fmt.Errorf("invalid produce response size: %d", len(body))
+	}
+	msgLen := int(binary.BigEndian.Uint16(body[14:16]))
+	if len(body) != PRODUCE_RESPONSE_BODY_SIZE+msgLen {
+		return ProduceResponse{}, fmt.Errorf("invalid produce response size: %d (error message %d bytes)", len(body), msgLen)
+	}
+
+	return ProduceResponse{
+		ErrorCode:    ErrorCode(binary.BigEndian.Uint16(body[0:2])),
+		Offset:       int64(binary.BigEndian.Uint64(body[2:10])),
+		RecordIndex:  int32(binary.BigEndian.Uint32(body[10:14])),
+		ErrorMessage: string(body[16:]),
+	}, nil
+}
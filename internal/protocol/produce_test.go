@@ -0,0 +1,35 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProduceResponse_RoundTrip(t *testing.T) {
+	for name, resp := range map[string]ProduceResponse{
+		"success":        {ErrorCode: ErrorNone, Offset: 42, RecordIndex: -1},
+		"invalid record": {ErrorCode: ErrorInvalidRecord, Offset: -1, RecordIndex: 3, ErrorMessage: "record 3: key too large"},
+	} {
+		got, err := DecodeProduceResponse(resp.Encode())
+		if err != nil {
+			t.Fatalf("%s: decode failed: %v", name, err)
+		}
+		if got != resp {
+			t.Errorf("%s: round trip mismatch. Want %+v, Got %+v", name, resp, got)
+		}
+	}
+
+	// Long messages are cut, and the body stays decodable
+	long := ProduceResponse{ErrorCode: ErrorCorruptMessage, Offset: -1, RecordIndex: -1, ErrorMessage: strings.Repeat("x", 2*MAX_ERROR_MESSAGE_SIZE)}
+	got, err := DecodeProduceResponse(long.Encode())
+	if err != nil || len(got.ErrorMessage) != MAX_ERROR_MESSAGE_SIZE {
+		t.Errorf("Long message: want %d bytes, got %d (err: %v)", MAX_ERROR_MESSAGE_SIZE, len(got.ErrorMessage), err)
+	}
+
+	body := (&ProduceResponse{ErrorMessage: "reason"}).Encode()
+	for _, bad := range [][]byte{body[:PRODUCE_RESPONSE_BODY_SIZE-1], body[:len(body)-1], append(body, 0)} {
+		if _, err := DecodeProduceResponse(bad); err == nil {
+			t.Errorf("Body of %d bytes accepted", len(bad))
+		}
+	}
+}
@@ -17,8 +17,16 @@ const (
 )
 
 const (
-	ApiKeyProduce = 0
-	ApiKeyFetch   = 1
+	ApiKeyProduce       = 0
+	ApiKeyFetch         = 1
+	ApiKeyListOffsets   = 2
+	ApiKeyDeleteRecords = 21
+)
+
+// NOTE(Danu): ListOffsets에서 사용하는 Kafka 예약 타임스탬프
+const (
+	LATEST_TIMESTAMP   = -1
+	EARLIEST_TIMESTAMP = -2
 )
 
 // NOTE(Danu): Kafka Request Header (RequestHeader v1)
@@ -3,6 +3,8 @@ package protocol
 import (
 	"encoding/binary"
 	"io"
+	"net"
+	"os"
 )
 
 // NOTE(Danu): Kafka Response Header v0 (CorrelationID only)
@@ -15,10 +17,68 @@ const (
 )
 
 // NOTE(Danu): Memory Allocation을 줄이기 위해 Header+Framing은 스택 배열을 사용하고, Body는 복사 없이 io.Writer로 직접 씁니다.
-// TODO(Danu): net.Buffers를 이용해서 더 효율적으로 처리할 수 있도록 수정해야 함
-func SendResponse(w io.Writer, correlationID int32, body []byte) error {
+// NOTE(Danu): net.Buffers를 사용하면 *net.TCPConn에서 Header와 Body를 writev 한 번으로 전송합니다.
+// NOTE(Danu): Body가 여러 조각이면 (예: Error Code + Records) 이어 붙이지 않고 순서대로 전송합니다.
+func SendResponse(w io.Writer, correlationID int32, body ...[]byte) error {
 
-	payloadSize := RESPONSE_HEADER_SIZE + len(body)
+	bodyLen := 0
+	for _, b := range body {
+		bodyLen += len(b)
+	}
+	headerBuf := responseHeader(correlationID, bodyLen)
+
+	// NOTE(Danu): Write Body (Zero-Copy), Body가 있다면 Header와 함께 io.Writer에 직접 씁니다.
+	// NOTE(Danu): 해당 정보는 mmap을 이용해서 메모리에 매핑된 데이터를 씁니다.
+	bufs := net.Buffers{headerBuf[:]}
+	for _, b := range body {
+		if len(b) > 0 {
+			bufs = append(bufs, b)
+		}
+	}
+
+	_, err := bufs.WriteTo(w)
+	return err
+}
+
+// SendFileResponse writes the header and head (the fixed part of the body, may be empty)
+// with writev and then transfers the rest of the body straight from the file's byte range.
+// On *net.TCPConn the range is sent with sendfile, so the data never passes through user space.
+func SendFileResponse(w io.Writer, correlationID int32, head []byte, f *os.File, position, length int64) error {
+
+	headerBuf := responseHeader(correlationID, len(head)+int(length))
+
+	bufs := net.Buffers{headerBuf[:]}
+	if len(head) > 0 {
+		bufs = append(bufs, head)
+	}
+	if _, err := bufs.WriteTo(w); err != nil {
+		return err
+	}
+
+	if length == 0 {
+		return nil
+	}
+
+	// NOTE(Danu): 파일 오프셋을 공유하지 않도록 position을 명시해서 전송 (동시 Fetch 안전)
+	if conn, ok := w.(*net.TCPConn); ok {
+		n, err := sendFile(conn, f, position, length)
+		if err != nil {
+			return err
+		}
+		if n != length {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	}
+
+	_, err := io.Copy(w, io.NewSectionReader(f, position, length))
+	return err
+}
+
+// responseHeader builds [Size(4)] + [CorrelationID(4)] for a body of bodyLen bytes.
+func responseHeader(correlationID int32, bodyLen int) [FRAMING_SIZE + RESPONSE_HEADER_SIZE]byte {
+
+	payloadSize := RESPONSE_HEADER_SIZE + bodyLen
 
 	// NOTE(Danu): make([]byte, 8) 대신 배열을 사용하여 Heap 할당 방지 (Escape Analysis에 유리)
 	var headerBuf [FRAMING_SIZE + RESPONSE_HEADER_SIZE]byte
@@ -31,20 +91,6 @@ func SendResponse(w io.Writer, correlationID int32, body []byte) error {
 
 	// NOTE(Danu): Correlation ID 쓰기
 	binary.BigEndian.PutUint32(headerBuf[offset:offset+CORRELATION_ID_SIZE], uint32(correlationID))
-	offset += CORRELATION_ID_SIZE
-
-	// NOTE(Danu): Write IO를 이용해서 헤더만 먼저 복사
-	if _, err := w.Write(headerBuf[:]); err != nil {
-		return err
-	}
-
-	// NOTE(Danu): Write Body (Zero-Copy), Body가 있다면 io.Writer에 직접 씁니다.
-	// NOTE(Danu): 해당 정보는 mmap을 이용해서 메모리에 매핑된 데이터를 씁니다.
-	if len(body) > 0 {
-		if _, err := w.Write(body); err != nil {
-			return err
-		}
-	}
 
-	return nil
+	return headerBuf
 }
@@ -0,0 +1,85 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSendFileResponse_TCP(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	path := filepath.Join(t.TempDir(), "00000000000000000000.log")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer ln.Close()
+
+	const position, length = 1234, 50000
+	head := []byte{0xab, 0xcd}
+	errc := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer conn.Close()
+		// Two responses back to back: the file offset must not be shared between them
+		if err := SendFileResponse(conn, 7, head, f, position, length); err != nil {
+			errc <- err
+			return
+		}
+		errc <- SendFileResponse(conn, 8, nil, f, 0, 10)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	for _, want := range []struct {
+		correlationID int32
+		body          []byte
+	}{
+		{7, append(head, content[position:position+length]...)},
+		{8, content[:10]},
+	} {
+		var header [FRAMING_SIZE + RESPONSE_HEADER_SIZE]byte
+		if _, err := io.ReadFull(conn, header[:]); err != nil {
+			t.Fatalf("read header: %v", err)
+		}
+		size := binary.BigEndian.Uint32(header[0:4])
+		correlationID := int32(binary.BigEndian.Uint32(header[4:8]))
+		if correlationID != want.correlationID || int(size) != RESPONSE_HEADER_SIZE+len(want.body) {
+			t.Fatalf("header: got (size=%d, cid=%d), want (size=%d, cid=%d)",
+				size, correlationID, RESPONSE_HEADER_SIZE+len(want.body), want.correlationID)
+		}
+
+		body := make([]byte, len(want.body))
+		if _, err := io.ReadFull(conn, body); err != nil {
+			t.Fatalf("read body: %v", err)
+		}
+		if !bytes.Equal(body, want.body) {
+			t.Fatalf("body mismatch for correlation id %d", want.correlationID)
+		}
+	}
+
+	if err := <-errc; err != nil {
+		t.Fatalf("SendFileResponse failed: %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+//go:build linux
+
+package protocol
+
+import (
+	"io"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxSendfileChunk caps a single sendfile call (the kernel limit is ~2GB).
+const maxSendfileChunk = 1 << 30
+
+// sendFile copies length bytes of f starting at position to conn with sendfile(2).
+// The explicit offset leaves the file's own offset untouched, so concurrent fetches
+// can share one *os.File. Returns the number of bytes written.
+func sendFile(conn *net.TCPConn, f *os.File, position, length int64) (int64, error) {
+	src, err := f.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	dst, err := conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var written int64
+	var sendErr, writeErr error
+
+	ctrlErr := src.Control(func(srcFd uintptr) {
+		// NOTE(Danu): EAGAIN이면 false를 반환해서 소켓이 쓰기 가능해질 때까지 대기
+		writeErr = dst.Write(func(dstFd uintptr) bool {
+			for written < length {
+				offset := position + written
+				n, err := unix.Sendfile(int(dstFd), int(srcFd), &offset, int(min(length-written, maxSendfileChunk)))
+				if n > 0 {
+					written += int64(n)
+				}
+				switch {
+				case err == unix.EAGAIN:
+					return false
+				case err == unix.EINTR:
+					continue
+				case err != nil:
+					sendErr = os.NewSyscallError("sendfile", err)
+					return true
+				case n == 0:
+					sendErr = io.ErrUnexpectedEOF // File shorter than the section
+					return true
+				}
+			}
+			return true
+		})
+	})
+	if ctrlErr != nil {
+		return written, ctrlErr
+	}
+	if sendErr != nil {
+		return written, sendErr
+	}
+	return written, writeErr
+}
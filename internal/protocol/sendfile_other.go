@@ -0,0 +1,15 @@
+//go:build !linux
+
+package protocol
+
+import (
+	"io"
+	"net"
+	"os"
+)
+
+// sendFile falls back to a plain copy. The section reader uses pread, so concurrent
+// fetches can still share one *os.File.
+func sendFile(conn *net.TCPConn, f *os.File, position, length int64) (int64, error) {
+	return io.Copy(conn, io.NewSectionReader(f, position, length))
+}
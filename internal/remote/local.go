@@ -0,0 +1,164 @@
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"lightkafka/internal/segment"
+)
+
+const metadataFileSuffix = ".metadata"
+
+var segmentFileSuffixes = []string{segment.LogFileSuffix, segment.IndexFileSuffix, segment.TimeIndexFileSuffix}
+
+// LocalStorage is a RemoteStorage backed by a local directory, laid out like the
+// broker's data directory: {root}/{topic}-{partition}/{baseOffset}.{log,index,timeindex}.
+// Each segment also gets a {baseOffset}.metadata file, written last, which marks the
+// upload as complete. It is meant for tests and single-host setups (e.g. an NFS mount).
+type LocalStorage struct {
+	root string
+}
+
+func NewLocalStorage(root string) (*LocalStorage, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &LocalStorage{root: root}, nil
+}
+
+func (s *LocalStorage) partitionDir(topic string, partition int) string {
+	return filepath.Join(s.root, fmt.Sprintf("%s-%d", topic, partition))
+}
+
+func (s *LocalStorage) PutSegment(meta SegmentMetadata, localDir string) error {
+	dir := s.partitionDir(meta.Topic, meta.Partition)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for _, suffix := range segmentFileSuffixes {
+		src := segment.FilePath(localDir, meta.BaseOffset, suffix)
+		dst := segment.FilePath(dir, meta.BaseOffset, suffix)
+		if err := copyFile(src, dst); err != nil {
+			// Index files are optional (rebuilt on open); the log is not
+			if suffix != segment.LogFileSuffix && os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(segment.FilePath(dir, meta.BaseOffset, metadataFileSuffix), data)
+}
+
+func (s *LocalStorage) GetSegment(key SegmentKey, localDir string) error {
+	dir := s.partitionDir(key.Topic, key.Partition)
+	if _, err := os.Stat(segment.FilePath(dir, key.BaseOffset, metadataFileSuffix)); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s-%d/%d", ErrSegmentNotFound, key.Topic, key.Partition, key.BaseOffset)
+		}
+		return err
+	}
+
+	for _, suffix := range segmentFileSuffixes {
+		src := segment.FilePath(dir, key.BaseOffset, suffix)
+		dst := segment.FilePath(localDir, key.BaseOffset, suffix)
+		if err := copyFile(src, dst); err != nil {
+			if suffix != segment.LogFileSuffix && os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *LocalStorage) DeleteSegment(key SegmentKey) error {
+	dir := s.partitionDir(key.Topic, key.Partition)
+
+	// Metadata first: a crash in between leaves unreferenced files, never a listed segment without data
+	for _, suffix := range append([]string{metadataFileSuffix}, segmentFileSuffixes...) {
+		if err := os.Remove(segment.FilePath(dir, key.BaseOffset, suffix)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *LocalStorage) ListSegments(topic string, partition int) ([]SegmentMetadata, error) {
+	entries, err := os.ReadDir(s.partitionDir(topic, partition))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var segments []SegmentMetadata
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), metadataFileSuffix) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.partitionDir(topic, partition), entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var meta SegmentMetadata
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return nil, fmt.Errorf("malformed remote metadata %s: %w", entry.Name(), err)
+		}
+		segments = append(segments, meta)
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].BaseOffset < segments[j].BaseOffset
+	})
+	return segments, nil
+}
+
+// copyFile copies src to dst through a temporary file, so dst is either complete or absent.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmpPath := dst + ".tmp"
+	out, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, dst)
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
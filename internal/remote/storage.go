@@ -0,0 +1,41 @@
+package remote
+
+import "errors"
+
+var ErrSegmentNotFound = errors.New("remote segment not found")
+
+// SegmentKey identifies a segment across all partitions.
+type SegmentKey struct {
+	Topic      string
+	Partition  int
+	BaseOffset int64
+}
+
+// SegmentMetadata describes a sealed segment copied to remote storage.
+type SegmentMetadata struct {
+	SegmentKey
+
+	NextOffset   int64 // First offset after the segment
+	MaxTimestamp int64 // Largest batch MaxTimestamp (-1 if unknown)
+	SizeInBytes  int64 // Size of the log file
+}
+
+// RemoteStorage stores sealed segments (log, offset index and time index) outside
+// the broker's local disk. Files are addressed by segment and by suffix, using the
+// same names as in the partition directory (segment.LogFileSuffix, ...).
+//
+// A segment becomes visible to ListSegments only once PutSegment has copied all of
+// its files, so a crash during an upload never exposes a partial segment.
+type RemoteStorage interface {
+	// PutSegment copies the segment's files from localDir.
+	PutSegment(meta SegmentMetadata, localDir string) error
+
+	// GetSegment copies the segment's files into localDir.
+	GetSegment(key SegmentKey, localDir string) error
+
+	// DeleteSegment removes the segment's files. Deleting a missing segment is not an error.
+	DeleteSegment(key SegmentKey) error
+
+	// ListSegments returns the partition's segments ordered by BaseOffset.
+	ListSegments(topic string, partition int) ([]SegmentMetadata, error)
+}
@@ -0,0 +1,74 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// LockFileName is the lock file created in every locked directory.
+const LockFileName = ".lock"
+
+var ErrDirLocked = errors.New("directory is locked by another process")
+
+// DirLock is an exclusive flock(2) on a data directory. Two brokers writing the same
+// MAP_SHARED log would corrupt it silently, so every directory is locked before use.
+// The kernel drops the lock when the process dies, so a stale lock file is harmless.
+type DirLock struct {
+	file *os.File
+}
+
+// LockDir takes an exclusive, non-blocking lock on dir, which must exist.
+// It fails with ErrDirLocked if another process (or another open in this process) holds it.
+func LockDir(dir string) (*DirLock, error) {
+	path := filepath.Join(dir, LockFileName)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, unix.EWOULDBLOCK) {
+			return nil, fmt.Errorf("%w: %s%s", ErrDirLocked, dir, holderInfo(path))
+		}
+		return nil, fmt.Errorf("lock %s: %w", path, err)
+	}
+
+	// Record the owner for the error message of the next process that tries
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+
+	return &DirLock{file: f}, nil
+}
+
+// holderInfo describes the lock holder from the pid in the lock file, if any.
+func holderInfo(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	if pid := strings.TrimSpace(string(data)); pid != "" {
+		return " (held by pid " + pid + ")"
+	}
+	return ""
+}
+
+// Unlock releases the lock. It is safe to call more than once.
+func (l *DirLock) Unlock() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	err := unix.Flock(int(l.file.Fd()), unix.LOCK_UN)
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+	return err
+}
@@ -0,0 +1,86 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+var (
+	ErrLogDirOffline     = errors.New("log directory is offline")
+	ErrInsufficientSpace = errors.New("insufficient disk space")
+)
+
+// LogDir tracks the health of a log directory shared by the partitions stored in it.
+// The first I/O error takes it offline: its mapped files may no longer match what was
+// acknowledged, so every later request fails fast until the broker is restarted.
+// A nil LogDir (memory storage) is always online and never short of space.
+type LogDir struct {
+	Path string
+
+	mu  sync.RWMutex
+	err error // Why the directory went offline, nil while online
+}
+
+func NewLogDir(path string) *LogDir {
+	return &LogDir{Path: path}
+}
+
+// MarkOffline takes the directory offline because of cause. Only the first cause is kept.
+func (d *LogDir) MarkOffline(cause error) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.err != nil {
+		return
+	}
+	d.err = cause
+	fmt.Printf("[LogDir] %s marked offline: %v\n", d.Path, cause)
+}
+
+// Err returns nil while the directory is online. Once offline, it returns an error
+// wrapping ErrLogDirOffline and the cause.
+func (d *LogDir) Err() error {
+	if d == nil {
+		return nil
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.err == nil {
+		return nil
+	}
+	return fmt.Errorf("%w: %s: %w", ErrLogDirOffline, d.Path, d.err)
+}
+
+// FreeBytes returns the space available to unprivileged writers on the directory's filesystem.
+func (d *LogDir) FreeBytes() (int64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(d.Path, &st); err != nil {
+		return 0, fmt.Errorf("statfs %s: %w", d.Path, err)
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
+
+// CheckFreeSpace fails with ErrInsufficientSpace if less than need bytes are free.
+func (d *LogDir) CheckFreeSpace(need int64) error {
+	if d == nil {
+		return nil
+	}
+
+	free, err := d.FreeBytes()
+	if err != nil {
+		return err
+	}
+	if free < need {
+		return fmt.Errorf("%w: %s has %d bytes free, need %d", ErrInsufficientSpace, d.Path, free, need)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package resource
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"lightkafka/internal/remote"
+)
+
+// RemoteFetchCache keeps segments read back from remote storage in a local directory.
+// Like SegmentCache it is shared system-wide and bounded by an LRU, here counted in
+// segments on disk. Each fetched segment lives in its own sub-directory.
+//
+// Downloads run without c.mu, one per key at a time: concurrent Fetches of the same key
+// wait for the first one. A fetched directory is pinned until its user releases it, and
+// an entry evicted while pinned is deleted only after the last release.
+type RemoteFetchCache struct {
+	mu       sync.Mutex
+	dir      string
+	capacity int
+	store    remote.RemoteStorage
+	segments *SegmentCache // Open handles on fetched files, dropped on eviction
+
+	lruList *list.List // Of downloaded *fetchEntry
+	items   map[remote.SegmentKey]*fetchEntry
+	nextDir int64 // A new download never reuses the directory of an evicted one
+}
+
+type fetchEntry struct {
+	key  remote.SegmentKey
+	dir  string
+	elem *list.Element // nil while downloading
+
+	ready chan struct{} // Closed once the download is done
+	err   error
+
+	pins    int
+	evicted bool // Out of the cache: the files go with the last release
+}
+
+func NewRemoteFetchCache(dir string, capacity int, store remote.RemoteStorage, segments *SegmentCache) (*RemoteFetchCache, error) {
+	if capacity <= 0 {
+		capacity = 20
+	}
+
+	// Fetched files are not tracked across restarts
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &RemoteFetchCache{
+		dir:      dir,
+		capacity: capacity,
+		store:    store,
+		segments: segments,
+		lruList:  list.New(),
+		items:    make(map[remote.SegmentKey]*fetchEntry),
+	}, nil
+}
+
+// SegmentKey is the SegmentCache key of a partition's segment ("topic-partID-baseOffset").
+func SegmentKey(topic string, partition int, baseOffset int64) string {
+	return fmt.Sprintf("%s-%d-%d", topic, partition, baseOffset)
+}
+
+// Fetch makes sure the segment's files are present locally, downloading them on a
+// miss, and returns the directory that holds them. The directory stays in place until
+// release is called, which the caller must do once it has opened the files.
+func (c *RemoteFetchCache) Fetch(key remote.SegmentKey) (dir string, release func(), err error) {
+	c.mu.Lock()
+	e, ok := c.items[key]
+	if !ok {
+		c.nextDir++
+		e = &fetchEntry{
+			key:   key,
+			dir:   filepath.Join(c.dir, fmt.Sprintf("%s.%d", SegmentKey(key.Topic, key.Partition, key.BaseOffset), c.nextDir)),
+			ready: make(chan struct{}),
+		}
+		c.items[key] = e
+	}
+	e.pins++
+	c.mu.Unlock()
+
+	if ok {
+		<-e.ready
+	} else {
+		c.download(e)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e.err != nil {
+		c.unpin(e)
+		return "", nil, e.err
+	}
+	if !e.evicted {
+		c.lruList.MoveToFront(e.elem)
+	}
+	return e.dir, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.unpin(e)
+	}, nil
+}
+
+// download fetches e's files without c.mu, then adds e to the LRU (or drops it on error).
+func (c *RemoteFetchCache) download(e *fetchEntry) {
+	err := os.MkdirAll(e.dir, 0755)
+	if err == nil {
+		err = c.store.GetSegment(e.key, e.dir)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer close(e.ready)
+
+	if err != nil {
+		e.err = err
+		c.evict(e)
+		return
+	}
+	if e.evicted {
+		return // Removed during the download
+	}
+	e.elem = c.lruList.PushFront(e)
+	for back := c.lruList.Back(); c.lruList.Len() > c.capacity && back != nil; {
+		prev := back.Prev()
+		if entry := back.Value.(*fetchEntry); entry.pins == 0 {
+			c.evict(entry)
+		}
+		back = prev
+	}
+}
+
+// Remove drops the local copy of a segment, e.g. after it was deleted remotely.
+func (c *RemoteFetchCache) Remove(key remote.SegmentKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.evict(e)
+	}
+}
+
+// evict takes e out of the cache and deletes its files unless they are pinned.
+// Callers must hold c.mu.
+func (c *RemoteFetchCache) evict(e *fetchEntry) {
+	if e.evicted {
+		return
+	}
+	e.evicted = true
+	delete(c.items, e.key)
+	if e.elem != nil {
+		c.lruList.Remove(e.elem)
+	}
+	if e.pins == 0 {
+		c.removeFiles(e)
+	}
+}
+
+// unpin drops a pin taken by Fetch. Callers must hold c.mu.
+func (c *RemoteFetchCache) unpin(e *fetchEntry) {
+	e.pins--
+	if e.pins == 0 && e.evicted {
+		c.removeFiles(e)
+	}
+}
+
+// removeFiles deletes an evicted entry's directory. Readers that opened the segment
+// keep their mapping: the files are unlinked only, their blocks are freed once the
+// last reader releases the segment. Callers must hold c.mu.
+func (c *RemoteFetchCache) removeFiles(e *fetchEntry) {
+	if c.segments != nil {
+		c.segments.Remove(SegmentKey(e.key.Topic, e.key.Partition, e.key.BaseOffset))
+	}
+	_ = os.RemoveAll(e.dir)
+}
+
+func (c *RemoteFetchCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, e := range c.items {
+		c.evict(e)
+	}
+	return nil
+}
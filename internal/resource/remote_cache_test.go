@@ -0,0 +1,124 @@
+package resource
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"lightkafka/internal/remote"
+)
+
+// slowStorage serves GetSegment with one file, blocking downloads of key 0 until
+// unblock is closed.
+type slowStorage struct {
+	remote.RemoteStorage
+	unblock chan struct{}
+	gets    atomic.Int32
+}
+
+func (s *slowStorage) GetSegment(key remote.SegmentKey, localDir string) error {
+	s.gets.Add(1)
+	if key.BaseOffset == 0 {
+		<-s.unblock
+	}
+	return os.WriteFile(filepath.Join(localDir, "segment.log"), []byte("data"), 0644)
+}
+
+func TestRemoteFetchCache_ConcurrentFetch(t *testing.T) {
+	store := &slowStorage{unblock: make(chan struct{})}
+	c, err := NewRemoteFetchCache(t.TempDir(), 1, store, nil)
+	if err != nil {
+		t.Fatalf("NewRemoteFetchCache failed: %v", err)
+	}
+	defer c.Close()
+
+	slow := remote.SegmentKey{Topic: "test", BaseOffset: 0}
+	fast := remote.SegmentKey{Topic: "test", BaseOffset: 1}
+
+	// Two readers of the slow segment share one download
+	var wg sync.WaitGroup
+	dirs := make([]string, 2)
+	for i := range dirs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dir, release, err := c.Fetch(slow)
+			if err != nil {
+				t.Errorf("Fetch failed: %v", err)
+				return
+			}
+			defer release()
+			dirs[i] = dir
+		}()
+	}
+
+	// Meanwhile other segments are served
+	for range 100 {
+		if store.gets.Load() > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	dir, release, err := c.Fetch(fast)
+	if err != nil {
+		t.Fatalf("Fetch during a download failed: %v", err)
+	}
+	release()
+
+	close(store.unblock)
+	wg.Wait()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Least recently used segment should be evicted over capacity (err: %v)", err)
+	}
+	if store.gets.Load() != 2 {
+		t.Errorf("Downloads mismatch. Want 2 (one per segment), Got %d", store.gets.Load())
+	}
+	if dirs[0] == "" || dirs[0] != dirs[1] {
+		t.Errorf("Readers got different directories: %q", dirs)
+	}
+}
+
+func TestRemoteFetchCache_PinnedAcrossEviction(t *testing.T) {
+	store := &slowStorage{unblock: make(chan struct{})}
+	close(store.unblock)
+	c, err := NewRemoteFetchCache(t.TempDir(), 1, store, nil)
+	if err != nil {
+		t.Fatalf("NewRemoteFetchCache failed: %v", err)
+	}
+	defer c.Close()
+
+	key := remote.SegmentKey{Topic: "test", BaseOffset: 0}
+	dir, release, err := c.Fetch(key)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	// Another segment and a remote delete both push it out while it is being opened
+	_, releaseOther, err := c.Fetch(remote.SegmentKey{Topic: "test", BaseOffset: 1})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	releaseOther()
+	c.Remove(key)
+
+	if _, err := os.Stat(filepath.Join(dir, "segment.log")); err != nil {
+		t.Errorf("Pinned files deleted: %v", err)
+	}
+	release()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Evicted files should go with the last release (err: %v)", err)
+	}
+
+	// A new fetch downloads again, into a fresh directory
+	newDir, release, err := c.Fetch(key)
+	if err != nil {
+		t.Fatalf("Fetch after eviction failed: %v", err)
+	}
+	release()
+	if newDir == dir {
+		t.Errorf("Fetch after eviction reused directory %s", dir)
+	}
+}
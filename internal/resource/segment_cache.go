@@ -9,6 +9,10 @@ import (
 
 // SegmentCache manages open read-only segments system-wide.
 // It limits the number of open file descriptors.
+//
+// The cache holds one reference on every segment it stores. Evicting or removing a
+// segment only releases that reference, so readers that acquired it keep a valid
+// mapping until they release it.
 type SegmentCache struct {
 	mu       sync.Mutex
 	capacity int
@@ -18,7 +22,7 @@ type SegmentCache struct {
 
 type cacheItem struct {
 	key string
-	seg *segment.Segment
+	seg segment.LogStore
 }
 
 func NewSegmentCache(capacity int) *SegmentCache {
@@ -32,11 +36,13 @@ func NewSegmentCache(capacity int) *SegmentCache {
 	}
 }
 
-/* GetOrLoad */
+// GetOrLoad returns the segment stored under key, loading it on a miss. The reference
+// returned by loader becomes the cache's. The returned segment is acquired on behalf of
+// the caller, who must Release it.
 func (c *SegmentCache) GetOrLoad(
 	key string,
-	loader func() (*segment.Segment, error),
-) (*segment.Segment, error) {
+	loader func() (segment.LogStore, error),
+) (segment.LogStore, error) {
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -44,7 +50,9 @@ func (c *SegmentCache) GetOrLoad(
 	// If the segment is in the cache, move it to the front of the list.
 	if elem, ok := c.items[key]; ok {
 		c.lruList.MoveToFront(elem)
-		return elem.Value.(*cacheItem).seg, nil
+		seg := elem.Value.(*cacheItem).seg
+		seg.Acquire() // Cannot fail: the cache still holds its own reference
+		return seg, nil
 	}
 
 	// If the segment is not in the cache, load it using the provided loader.
@@ -63,9 +71,27 @@ func (c *SegmentCache) GetOrLoad(
 	elem := c.lruList.PushFront(item)
 	c.items[key] = elem
 
+	seg.Acquire()
 	return seg, nil
 }
 
+// Remove drops the segment stored under key, if any, and releases the cache's
+// reference. The segment is closed once the last reader has released it.
+// Used when the segment's files are deleted (e.g. by retention).
+func (c *SegmentCache) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return
+	}
+	c.lruList.Remove(elem)
+	delete(c.items, key)
+
+	_ = elem.Value.(*cacheItem).seg.Release()
+}
+
 func (c *SegmentCache) evict() {
 	elem := c.lruList.Back()
 	if elem == nil {
@@ -75,8 +101,8 @@ func (c *SegmentCache) evict() {
 	item := elem.Value.(*cacheItem)
 	delete(c.items, item.key)
 
-	// Close the resource
-	_ = item.seg.Close()
+	// Release the resource (closed once in-flight readers release it)
+	_ = item.seg.Release()
 }
 
 func (c *SegmentCache) Close() error {
@@ -85,7 +111,7 @@ func (c *SegmentCache) Close() error {
 
 	for e := c.lruList.Front(); e != nil; e = e.Next() {
 		item := e.Value.(*cacheItem)
-		_ = item.seg.Close()
+		_ = item.seg.Release()
 	}
 	c.lruList.Init()
 	c.items = make(map[string]*list.Element)
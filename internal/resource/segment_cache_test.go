@@ -0,0 +1,106 @@
+package resource
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"testing"
+
+	"lightkafka/internal/client"
+	"lightkafka/internal/segment"
+)
+
+// newTestSegments writes n closed segments (one batch each) into dir.
+func newTestSegments(t *testing.T, dir string, n int, cfg segment.Config) [][]byte {
+	t.Helper()
+
+	batches := make([][]byte, n)
+	for i := range n {
+		builder := client.NewRecordBatchBuilder()
+		builder.Add([]byte(fmt.Sprintf("key-%d", i)), bytes.Repeat([]byte{byte('a' + i)}, 512))
+		batch := builder.Build()
+		binary.BigEndian.PutUint64(batch[0:8], uint64(i))
+
+		seg, err := segment.NewSegment(dir, int64(i), cfg)
+		if err != nil {
+			t.Fatalf("NewSegment failed: %v", err)
+		}
+		if _, err := seg.Append(batch); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+		stored, err := seg.Read(int64(i), 4096)
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		batches[i] = bytes.Clone(stored)
+		seg.Close()
+	}
+	return batches
+}
+
+// TestSegmentCache_EvictWhileReading reproduces the fetch path: a reader holds a
+// slice into a cached segment's mmap while other partitions push it out of the cache.
+// Without reference counting the eviction unmaps the slice and the reader faults.
+func TestSegmentCache_EvictWhileReading(t *testing.T) {
+	dir := t.TempDir()
+	cfg := segment.Config{SegmentMaxBytes: 4096, IndexMaxBytes: 1024, IndexIntervalBytes: 4096}
+
+	const segments = 4
+	want := newTestSegments(t, dir, segments, cfg)
+
+	cache := NewSegmentCache(1) // Every miss evicts whatever is cached
+	defer cache.Close()
+
+	load := func(base int64) (segment.LogStore, error) {
+		return cache.GetOrLoad(fmt.Sprintf("test-0-%d", base), func() (segment.LogStore, error) {
+			return segment.OpenReadOnly(dir, base, cfg, true)
+		})
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+
+	for r := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 500 {
+				base := int64((r + i) % segments)
+
+				seg, err := load(base)
+				if err != nil {
+					errs <- err
+					return
+				}
+				view, err := seg.ReadView(base, 4096)
+				seg.Release()
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				// Push the segment out of the cache before the data is "sent"
+				for j := int64(1); j < segments; j++ {
+					other, err := load((base + j) % segments)
+					if err != nil {
+						errs <- err
+						return
+					}
+					other.Release()
+				}
+
+				if !bytes.Equal(view.Data, want[base]) {
+					errs <- fmt.Errorf("segment %d: data changed under reader", base)
+				}
+				view.Release()
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
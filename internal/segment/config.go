@@ -1,8 +1,37 @@
 package segment
 
+import (
+	"fmt"
+	"math"
+)
+
 type Config struct {
 	SegmentMaxBytes    int64  // e.g., 1GB
-	IndexMaxBytes      int64  // e.g., 10MB
+	IndexMaxBytes      int64  // e.g., 10MB, per index file (excluding the offset index header)
 	BaseDir            string // e.g., "./data"
 	IndexIntervalBytes int64  // e.g., 4KB
+
+	// FlushIntervalMessages forces an msync after this many records (flush.messages).
+	// 1 flushes on every append, 0 leaves flushing to Flush()/Close().
+	FlushIntervalMessages int64
+
+	// Preallocate reserves SegmentMaxBytes of disk blocks for every new log file and maps it whole
+	// (file.preallocate). By default the log grows in chunks as it fills.
+	Preallocate bool
+}
+
+// Validate checks the sizes against what mmap and the on-disk formats can address.
+// Log positions are 64-bit, so a segment may exceed 2GiB on 64-bit platforms.
+func (c Config) Validate() error {
+	if c.SegmentMaxBytes <= 0 || c.SegmentMaxBytes > math.MaxInt {
+		return fmt.Errorf("%w: SegmentMaxBytes %d must be in (0, %d]", ErrInvalidConfig, c.SegmentMaxBytes, math.MaxInt)
+	}
+	if c.IndexMaxBytes < max(entryWidth, timeEntryWidth) || c.IndexMaxBytes > math.MaxInt-indexHeaderSize {
+		return fmt.Errorf("%w: IndexMaxBytes %d must hold at least one entry (%d bytes) and fit in memory",
+			ErrInvalidConfig, c.IndexMaxBytes, max(entryWidth, timeEntryWidth))
+	}
+	if c.IndexIntervalBytes < 0 || c.FlushIntervalMessages < 0 {
+		return fmt.Errorf("%w: IndexIntervalBytes and FlushIntervalMessages must not be negative", ErrInvalidConfig)
+	}
+	return nil
 }
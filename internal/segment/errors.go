@@ -8,4 +8,10 @@ var (
 	ErrOffsetOutOfRange = errors.New("offset out of range")
 	ErrInvalidConfig    = errors.New("invalid configuration")
 	ErrInsufficientData = errors.New("insufficient data to decode record batch")
+	ErrReadOnly         = errors.New("segment is read-only")
+	ErrSegmentClosed    = errors.New("segment is closed")
+
+	// ErrStorage wraps failures of the underlying files (disk full, I/O errors).
+	// The data on disk may no longer match what was acknowledged.
+	ErrStorage = errors.New("storage I/O error")
 )
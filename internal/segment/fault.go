@@ -0,0 +1,35 @@
+package segment
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// storageError wraps an I/O failure of op in ErrStorage.
+func storageError(op string, err error) error {
+	return fmt.Errorf("%w: %s: %w", ErrStorage, op, err)
+}
+
+// guardFault runs fn, which touches a shared file mapping. When the filesystem cannot
+// back a page (I/O error, a sparse file on a full disk, the file truncated behind our
+// back) the access raises SIGBUS; guardFault turns that into ErrStorage instead of
+// letting it crash the broker. Other panics are passed on.
+//
+// It guards every write through a mapping (log appends, index entries, truncation), the
+// scans that read a whole segment (recovery, ForEachBatch) and the Segment lookups
+// (Read, ReadView, OffsetForTimestamp), index lookups included. The slices that Read and
+// ReadView return outlive the guard: the fetch path sends them with sendfile, which
+// reports a page the disk cannot read as an ordinary error.
+func guardFault(op string, fn func()) (err error) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(interface{ Addr() uintptr }); !ok {
+				panic(r)
+			}
+			err = fmt.Errorf("%w: %s: %v", ErrStorage, op, r)
+		}
+	}()
+	fn()
+	return nil
+}
@@ -0,0 +1,79 @@
+package segment
+
+// Segments are reference counted so that a reader can keep the mmap alive after the
+// owner (the partition or the segment cache) has closed the segment.
+//
+// The owner holds the initial reference and gives it up with Close. Every other user
+// takes a reference with Acquire and gives it back with Release. The files are unmapped
+// and closed only when the last reference is released. MemoryStore follows the same rules.
+
+// Acquire takes a reference on the segment. It returns false if the segment has
+// already been closed, in which case the caller must not touch it.
+func (s *Segment) Acquire() bool {
+	for {
+		n := s.refs.Load()
+		if n <= 0 {
+			return false
+		}
+		if s.refs.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// Release gives back a reference taken by Acquire.
+func (s *Segment) Release() error {
+	switch n := s.refs.Add(-1); {
+	case n == 0:
+		return s.closeFiles()
+	case n < 0:
+		panic("segment: Release called more times than Acquire")
+	}
+	return nil
+}
+
+// View is a window into a segment's log. Data is the mapped bytes and FileSection
+// the same range in the log file (for sendfile). Both stay valid until Release.
+// Stores without files (MemoryStore) leave FileSection empty.
+type View struct {
+	Data []byte
+	FileSection
+
+	store LogStore
+}
+
+// ReadView is like Read, but pins the segment until the returned view is released.
+func (s *Segment) ReadView(targetOffset int64, maxBytes int32) (*View, error) {
+	if !s.Acquire() {
+		return nil, ErrSegmentClosed
+	}
+
+	s.mu.RLock()
+	var data []byte
+	var section FileSection
+	var err error
+	if faultErr := guardFault("read log", func() {
+		var pos int64
+		if pos, err = s.locate(targetOffset); err == nil {
+			data, section, err = s.log.ReadSection(pos, maxBytes)
+		}
+	}); faultErr != nil {
+		err = faultErr
+	}
+	s.mu.RUnlock()
+
+	if err != nil {
+		s.Release()
+		return nil, err
+	}
+	return &View{Data: data, FileSection: section, store: s}, nil
+}
+
+// Release unpins the segment. It is safe to call on a nil view and more than once.
+func (v *View) Release() {
+	if v == nil || v.store == nil {
+		return
+	}
+	v.store.Release()
+	v.store = nil
+}
@@ -2,21 +2,64 @@ package segment
 
 import (
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"sync"
 	"syscall"
+
+	"golang.org/x/sys/unix"
 )
 
-const entryWidth = 8 // Offset(4) + Position(4)
+// Offset index file format (version 1):
+//
+//	Header: Magic(4) "LKIX" + Version(2) + Reserved(2)
+//	Entry:  RelativeOffset(4) + Position(8)
+//
+// Files without the header use the legacy format (Offset(4) + Position(4)), which cannot
+// address segments beyond 2GiB. They are discarded on open and rebuilt from the log.
+const (
+	indexMagic      = "LKIX"
+	indexVersion    = 1
+	indexHeaderSize = 8
+	entryWidth      = 12 // Offset(4) + Position(8)
+)
 
 type Index struct {
-	mu   sync.RWMutex
-	file *os.File
-	data []byte // mmap
-	size int64  // used bytes
+	mu      sync.RWMutex
+	file    *os.File
+	data    []byte // mmap (header + entries)
+	entries []byte // data after the header
+	size    int64  // used bytes of entries
+
+	readOnly bool
 }
 
+// OpenIndexReadOnly maps an existing index file read-only. A missing file or one in an
+// unsupported format yields an empty index, so lookups fall back to scanning the log.
+func OpenIndexReadOnly(path string) (*Index, error) {
+	f, data, err := mmapReadOnly(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Index{readOnly: true}, nil
+		}
+		return nil, err
+	}
+	if !validIndexHeader(data) {
+		return &Index{file: f, data: data, readOnly: true}, nil
+	}
+
+	entries := data[indexHeaderSize:]
+	size := int64(len(entries)) / entryWidth * entryWidth
+	for size > entryWidth && isZero(entries[size-entryWidth:size]) {
+		size -= entryWidth
+	}
+
+	return &Index{file: f, data: data, entries: entries, size: size, readOnly: true}, nil
+}
+
+// NewIndex opens (or creates) an index with room for maxBytes of entries after the header.
 func NewIndex(path string, maxBytes int64) (*Index, error) {
 	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
 	if err != nil {
@@ -25,43 +68,92 @@ func NewIndex(path string, maxBytes int64) (*Index, error) {
 
 	fi, err := f.Stat()
 	if err != nil {
+		f.Close()
 		return nil, err
 	}
+	fileSize := fi.Size()
 
-	// Pre-allocation
-	if fi.Size() < maxBytes {
-		if err := f.Truncate(maxBytes); err != nil {
-			f.Close()
-			return nil, err
+	// Legacy or unknown format: start over, recovery rebuilds the entries from the log
+	if fileSize > 0 {
+		header := make([]byte, indexHeaderSize)
+		if _, err := f.ReadAt(header, 0); err != nil || !validIndexHeader(header) {
+			fmt.Printf("Rebuilding index %s: unsupported format\n", path)
+			if err := f.Truncate(0); err != nil {
+				f.Close()
+				return nil, err
+			}
+			fileSize = 0
 		}
 	}
 
+	// Entries written before the last Close (the file was trimmed to its used size)
+	size := min(max(fileSize-indexHeaderSize, 0), maxBytes) / entryWidth * entryWidth
+
+	// Pre-allocation with real blocks: entries are written through the mapping
+	mapSize := indexHeaderSize + maxBytes
+	if err := allocate(f, 0, mapSize); err != nil {
+		f.Close()
+		return nil, err
+	}
+
 	data, err := syscall.Mmap(
-		int(f.Fd()), 0, int(maxBytes),
+		int(f.Fd()), 0, int(mapSize),
 		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED,
 	)
 	if err != nil {
+		f.Close()
 		return nil, err
 	}
 
-	return &Index{file: f, data: data, size: 0}, nil
+	copy(data, indexMagic)
+	binary.BigEndian.PutUint16(data[4:], indexVersion)
+
+	// After a crash the file was never trimmed: drop the zero-filled tail.
+	// (0, 0) is only a valid entry in the first slot.
+	entries := data[indexHeaderSize:]
+	for size > entryWidth && isZero(entries[size-entryWidth:size]) {
+		size -= entryWidth
+	}
+
+	return &Index{file: f, data: data, entries: entries, size: size}, nil
+}
+
+// validIndexHeader reports whether data starts with a header this version can read.
+func validIndexHeader(data []byte) bool {
+	return len(data) >= indexHeaderSize &&
+		string(data[:4]) == indexMagic &&
+		binary.BigEndian.Uint16(data[4:]) == indexVersion
 }
 
 // Write appends (RelativeOffset, PhysicalPosition).
-func (i *Index) Write(off int32, pos int32) error {
+func (i *Index) Write(off int32, pos int64) error {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	if i.size+entryWidth > int64(len(i.data)) {
-		return io.EOF
+	if i.readOnly {
+		return ErrReadOnly
+	}
+	if i.size+entryWidth > int64(len(i.entries)) {
+		return ErrIndexFull
 	}
 
-	binary.BigEndian.PutUint32(i.data[i.size:], uint32(off))
-	binary.BigEndian.PutUint32(i.data[i.size+4:], uint32(pos))
+	if err := guardFault("write index", func() {
+		binary.BigEndian.PutUint32(i.entries[i.size:], uint32(off))
+		binary.BigEndian.PutUint64(i.entries[i.size+4:], uint64(pos))
+	}); err != nil {
+		return err
+	}
 	i.size += entryWidth
 	return nil
 }
 
+// IsFull reports whether another entry would exceed IndexMaxBytes.
+func (i *Index) IsFull() bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.size+entryWidth > int64(len(i.entries))
+}
+
 // Lookup performs binary search to find position <= relOff.
 func (i *Index) Lookup(relOff int32) (int64, error) {
 	i.mu.RLock()
@@ -71,7 +163,7 @@ func (i *Index) Lookup(relOff int32) (int64, error) {
 		return 0, nil
 	}
 
-	var outPos int32 = -1
+	var outPos int64 = -1
 	entries := int(i.size / entryWidth)
 	low, high := 0, entries-1
 
@@ -79,8 +171,8 @@ func (i *Index) Lookup(relOff int32) (int64, error) {
 		mid := (low + high) / 2
 		offsetPos := mid * entryWidth
 
-		midOff := int32(binary.BigEndian.Uint32(i.data[offsetPos:]))
-		midPos := int32(binary.BigEndian.Uint32(i.data[offsetPos+4:]))
+		midOff := int32(binary.BigEndian.Uint32(i.entries[offsetPos:]))
+		midPos := int64(binary.BigEndian.Uint64(i.entries[offsetPos+4:]))
 
 		if midOff <= relOff {
 			outPos = midPos
@@ -93,17 +185,66 @@ func (i *Index) Lookup(relOff int32) (int64, error) {
 	if outPos == -1 {
 		return 0, nil
 	}
-	return int64(outPos), nil
+	return outPos, nil
+}
+
+// Flush msyncs the used part of the index.
+func (i *Index) Flush() error {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	if i.size == 0 || i.readOnly {
+		return nil
+	}
+	if err := unix.Msync(i.data[:indexHeaderSize+i.size], unix.MS_SYNC); err != nil {
+		return storageError("flush index", err)
+	}
+	return nil
 }
 
 func (i *Index) Close() error {
-	syscall.Munmap(i.data)
-	i.file.Truncate(i.size) // Trim to actual size
-	return i.file.Close()
+	if i.readOnly {
+		if i.file == nil {
+			return nil
+		}
+		var errs []error
+		if i.data != nil {
+			errs = append(errs, syscall.Munmap(i.data))
+		}
+		return errors.Join(append(errs, i.file.Close())...)
+	}
+
+	err := errors.Join(
+		syscall.Munmap(i.data),
+		i.file.Truncate(indexHeaderSize+i.size), // Trim to actual size
+		i.file.Close(),
+	)
+	if err != nil {
+		return storageError("close index", err)
+	}
+	return nil
+}
+
+// entryCount returns the number of entries.
+func (i *Index) entryCount() int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return int(i.size / entryWidth)
+}
+
+// entry returns the n-th entry.
+func (i *Index) entry(n int) (off int32, pos int64) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	at := int64(n) * entryWidth
+	off = int32(binary.BigEndian.Uint32(i.entries[at : at+4]))
+	pos = int64(binary.BigEndian.Uint64(i.entries[at+4 : at+entryWidth]))
+	return off, pos
 }
 
 /* Last Entry */
-func (i *Index) LastEntry() (off int32, pos int32, err error) {
+func (i *Index) LastEntry() (off int32, pos int64, err error) {
 	i.mu.RLock()
 	defer i.mu.RUnlock()
 
@@ -112,8 +253,8 @@ func (i *Index) LastEntry() (off int32, pos int32, err error) {
 	}
 
 	lastOffset := i.size - entryWidth
-	off = int32(binary.BigEndian.Uint32(i.data[lastOffset : lastOffset+4]))
-	pos = int32(binary.BigEndian.Uint32(i.data[lastOffset+4 : lastOffset+8]))
+	off = int32(binary.BigEndian.Uint32(i.entries[lastOffset : lastOffset+4]))
+	pos = int64(binary.BigEndian.Uint64(i.entries[lastOffset+4 : lastOffset+entryWidth]))
 	return off, pos, nil
 }
 
@@ -122,10 +263,35 @@ func (i *Index) Truncate(size int64) error {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	if size > int64(len(i.data)) {
+	if size > int64(len(i.entries)) {
 		return io.ErrShortBuffer
 	}
 
 	i.size = size
 	return nil
 }
+
+// TruncateTo drops every entry whose relative offset is >= relOff.
+// The dropped entries are zeroed so that they are not reloaded after a crash.
+func (i *Index) TruncateTo(relOff int32) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.readOnly {
+		return ErrReadOnly
+	}
+
+	size := i.size
+	for size > 0 && int32(binary.BigEndian.Uint32(i.entries[size-entryWidth:])) >= relOff {
+		size -= entryWidth
+	}
+	if size == i.size {
+		return nil
+	}
+
+	if err := zeroAndSync(i.data, indexHeaderSize+size, indexHeaderSize+i.size); err != nil {
+		return err
+	}
+	i.size = size
+	return nil
+}
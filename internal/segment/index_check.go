@@ -0,0 +1,117 @@
+package segment
+
+import (
+	"fmt"
+
+	"lightkafka/internal/message"
+)
+
+// IndexRepair reports indexes that failed validation when their segment was opened.
+// Both indexes are then rebuilt from the log (read-only segments just drop them).
+type IndexRepair struct {
+	BaseOffset int64
+	File       string // Suffix of the file that failed: IndexFileSuffix or TimeIndexFileSuffix
+	Entry      int    // First invalid entry
+	Reason     string
+
+	EntriesBefore int // Offset index entries before the rebuild
+	EntriesAfter  int // and after it
+}
+
+func (r IndexRepair) String() string {
+	return fmt.Sprintf("segment %d: %s entry %d %s; rebuilt offset index %d -> %d entries",
+		r.BaseOffset, r.File, r.Entry, r.Reason, r.EntriesBefore, r.EntriesAfter)
+}
+
+// newIndexRepair reports entry of the file with the given suffix as invalid.
+// Callers must hold s.mu.
+func (s *Segment) newIndexRepair(file string, entry int, format string, args ...any) *IndexRepair {
+	return &IndexRepair{
+		BaseOffset:    s.baseOffset,
+		File:          file,
+		Entry:         entry,
+		Reason:        fmt.Sprintf(format, args...),
+		EntriesBefore: s.index.entryCount(),
+	}
+}
+
+// checkLastIndexEntry is the cheap sanity check of trusted segments: the last offset
+// index entry must point at a batch with the indexed BaseOffset within limit, and the
+// time index must not be ahead of it. It returns nil if both pass.
+// Callers must hold s.mu.
+func (s *Segment) checkLastIndexEntry(limit int64) *IndexRepair {
+	n := s.index.entryCount()
+	lastOff, lastPos, _ := s.index.LastEntry()
+	if n > 0 {
+		if lastPos+message.BATCH_HEADER_SIZE > limit {
+			return s.newIndexRepair(IndexFileSuffix, n-1, "position %d is past the end of the log", lastPos)
+		}
+		headerBytes, _ := s.log.ReadRaw(lastPos, message.BATCH_HEADER_SIZE)
+		header, err := message.DecodeHeader(headerBytes)
+		if err != nil || header.BaseOffset != s.baseOffset+int64(lastOff) {
+			return s.newIndexRepair(IndexFileSuffix, n-1, "position %d is not the start of batch %d", lastPos, s.baseOffset+int64(lastOff))
+		}
+	}
+
+	// The time index is written at offset index points, so it can never be ahead of it
+	if _, lastTimeOff, ok := s.timeIndex.LastEntry(); ok && (n == 0 || lastTimeOff > lastOff) {
+		return s.newIndexRepair(TimeIndexFileSuffix, s.timeIndex.entryCount()-1, "offset %d is past the offset index", s.baseOffset+int64(lastTimeOff))
+	}
+	return nil
+}
+
+// checkIndexes validates every index entry against the log, whose valid data ends at
+// most at limit. Offset index entries must have strictly increasing offsets and positions
+// and point at the start of a batch with the indexed BaseOffset. Time index entries are
+// written at offset index entries, so their offsets must match one, in order, with
+// timestamps that never decrease. It returns nil if both indexes pass.
+// Callers must hold s.mu.
+func (s *Segment) checkIndexes(limit int64) *IndexRepair {
+	fail := s.newIndexRepair
+
+	n := s.index.entryCount()
+	offsets := make([]int32, n)
+	prevOff, prevPos := int32(-1), int64(-1)
+	for i := range n {
+		off, pos := s.index.entry(i)
+		if off <= prevOff || pos <= prevPos {
+			return fail(IndexFileSuffix, i, "(%d, %d) is not after (%d, %d)", off, pos, prevOff, prevPos)
+		}
+		if pos+message.BATCH_HEADER_SIZE > limit {
+			return fail(IndexFileSuffix, i, "position %d is past the end of the log", pos)
+		}
+
+		headerBytes, _ := s.log.ReadRaw(pos, message.BATCH_HEADER_SIZE)
+		header, err := message.DecodeHeader(headerBytes)
+		if err != nil {
+			return fail(IndexFileSuffix, i, "position %d is not the start of a batch: %v", pos, err)
+		}
+		if header.BaseOffset != s.baseOffset+int64(off) {
+			return fail(IndexFileSuffix, i, "offset %d points at batch %d", s.baseOffset+int64(off), header.BaseOffset)
+		}
+		if pos+message.BATCH_LENTH_METADATA_SIZE+int64(header.BatchLength) > limit {
+			return fail(IndexFileSuffix, i, "batch at position %d runs past the end of the log", pos)
+		}
+
+		offsets[i] = off
+		prevOff, prevPos = off, pos
+	}
+
+	prevTs, prevOff := int64(-1), int32(-1)
+	j := 0 // Next offset index entry to match
+	for i := range s.timeIndex.entryCount() {
+		ts, off := s.timeIndex.entry(i)
+		if ts < prevTs || off <= prevOff {
+			return fail(TimeIndexFileSuffix, i, "(%d, %d) is not after (%d, %d)", ts, off, prevTs, prevOff)
+		}
+		for j < n && offsets[j] < off {
+			j++
+		}
+		if j == n || offsets[j] != off {
+			return fail(TimeIndexFileSuffix, i, "offset %d has no offset index entry", s.baseOffset+int64(off))
+		}
+		prevTs, prevOff = ts, off
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package segment
 
 import (
+	"errors"
 	"os"
 	"sync"
 	"syscall"
@@ -10,14 +11,34 @@ import (
 	"golang.org/x/sys/unix"
 )
 
+// Grow-on-demand logs start with a small mapping and extend it by the mapped size,
+// within these bounds, whenever an append reaches its end.
+const (
+	logGrowMinBytes     = 1024 * 1024
+	logGrowMaxStepBytes = 64 * 1024 * 1024
+)
+
 type Log struct {
 	mu   sync.RWMutex
 	file *os.File
-	data []byte // mmap region
+	data []byte // mmap region, shorter than maxBytes until the log has grown
 	size int64  // logical size (valid data limit)
+
+	maxBytes int64 // SegmentMaxBytes, Append fails with ErrSegmentFull beyond it
+	// retired holds mappings replaced by grow. Readers may still hold slices into
+	// them, so they are unmapped only on Close.
+	retired [][]byte
+
+	flushedSize int64 // bytes known to be synced to disk
+
+	// readOnly logs map only the file's length with PROT_READ and never modify the file.
+	readOnly bool
 }
 
-func NewLog(path string, maxBytes int64) (*Log, error) {
+// NewLog opens (or creates) a writable log of up to maxBytes. With preallocate the file
+// is extended to maxBytes and mapped whole up front; otherwise only the existing data
+// (at least logGrowMinBytes) is mapped and Append grows the file and mapping as needed.
+func NewLog(path string, maxBytes int64, preallocate bool) (*Log, error) {
 	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
 	if err != nil {
 		return nil, err
@@ -25,27 +46,73 @@ func NewLog(path string, maxBytes int64) (*Log, error) {
 
 	fi, err := f.Stat()
 	if err != nil {
+		f.Close()
 		return nil, err
 	}
 
-	// Pre-allocation
-	if fi.Size() < maxBytes {
-		if err := f.Truncate(maxBytes); err != nil {
+	mapSize := maxBytes
+	if preallocate {
+		// Reserve real blocks for the whole file (not a sparse Truncate), so running out
+		// of disk fails here rather than as SIGBUS on a later write through the mapping
+		if err := allocate(f, 0, maxBytes); err != nil {
 			f.Close()
 			return nil, err
 		}
+	} else {
+		mapSize = min(maxBytes, max(fi.Size(), logGrowMinBytes))
+		if fi.Size() < mapSize {
+			if err := allocate(f, fi.Size(), mapSize); err != nil {
+				f.Close()
+				return nil, err
+			}
+		}
 	}
 
-	data, err := syscall.Mmap(
-		int(f.Fd()), 0, int(maxBytes),
-		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED,
+	// unix.Mmap (not syscall.Mmap): grow resizes the mapping with unix.Mremap
+	data, err := unix.Mmap(
+		int(f.Fd()), 0, int(mapSize),
+		unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED,
 	)
 	if err != nil {
 		f.Close()
 		return nil, err
 	}
 
-	return &Log{file: f, data: data, size: 0}, nil
+	return &Log{file: f, data: data, size: 0, maxBytes: maxBytes}, nil
+}
+
+// OpenLogReadOnly maps an existing log file read-only, exactly at its current length.
+func OpenLogReadOnly(path string) (*Log, error) {
+	f, data, err := mmapReadOnly(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{file: f, data: data, size: 0, readOnly: true}, nil
+}
+
+// mmapReadOnly opens path and maps its whole length PROT_READ.
+// An empty file is not mapped (mmap rejects zero length).
+func mmapReadOnly(path string) (*os.File, []byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if fi.Size() == 0 {
+		return f, nil, nil
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(fi.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, data, nil
 }
 
 // Size returns the logical size of the log.
@@ -60,18 +127,65 @@ func (l *Log) SetSize(size int64) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	l.size = size
+	l.flushedSize = min(l.flushedSize, size)
+}
+
+// TruncateTo cuts the log back to size bytes. The removed bytes are zeroed and synced,
+// so recovery after a crash cannot pick the old batches up again.
+func (l *Log) TruncateTo(size int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.readOnly {
+		return ErrReadOnly
+	}
+	if size >= l.size {
+		return nil
+	}
+
+	if err := zeroAndSync(l.data, size, l.size); err != nil {
+		return err
+	}
+	l.size = size
+	l.flushedSize = min(l.flushedSize, size)
+	return nil
+}
+
+// zeroAndSync clears data[from:to] and msyncs it to disk.
+func zeroAndSync(data []byte, from, to int64) error {
+	if err := guardFault("truncate", func() { clear(data[from:to]) }); err != nil {
+		return err
+	}
+
+	// msync requires a page-aligned start address
+	start := from &^ int64(os.Getpagesize()-1)
+	if err := unix.Msync(data[start:to], unix.MS_SYNC); err != nil {
+		return storageError("truncate", err)
+	}
+	return nil
 }
 
 func (l *Log) Append(b []byte) (int, int64, error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	if l.readOnly {
+		return 0, 0, ErrReadOnly
+	}
+
 	n := len(b)
-	if l.size+int64(n) > int64(len(l.data)) {
+	if l.size+int64(n) > l.maxBytes {
 		return 0, 0, ErrSegmentFull
 	}
+	if l.size+int64(n) > int64(len(l.data)) {
+		if err := l.grow(l.size + int64(n)); err != nil {
+			return 0, 0, storageError("grow log", err)
+		}
+	}
 
-	copy(l.data[l.size:], b)
+	if err := guardFault("append to log", func() { copy(l.data[l.size:], b) }); err != nil {
+		return 0, 0, err
+	}
 	pos := l.size
 	l.size += int64(n)
 
@@ -128,6 +242,23 @@ func (l *Log) ReadAt(pos int64, maxBytes int32) ([]byte, error) {
 	return l.data[pos : pos+totalBytes], nil
 }
 
+// FileSection is a byte range of the log file. The fetch path hands it to
+// sendfile instead of copying the bytes out of the mmap.
+type FileSection struct {
+	File     *os.File
+	Position int64
+	Length   int64
+}
+
+// ReadSection selects the same batches as ReadAt and also returns them as a file range.
+func (l *Log) ReadSection(pos int64, maxBytes int32) ([]byte, FileSection, error) {
+	data, err := l.ReadAt(pos, maxBytes)
+	if err != nil || data == nil {
+		return nil, FileSection{}, err
+	}
+	return data, FileSection{File: l.file, Position: pos, Length: int64(len(data))}, nil
+}
+
 // ReadRaw reads exactly `size` bytes. Used for header scanning.
 func (l *Log) ReadRaw(pos int64, size int) ([]byte, error) {
 	l.mu.RLock()
@@ -139,16 +270,97 @@ func (l *Log) ReadRaw(pos int64, size int) ([]byte, error) {
 	return l.data[pos : pos+int64(size)], nil
 }
 
+// Flush msyncs the bytes written since the last flush.
+// Appends and reads are not blocked while the sync is in progress.
+func (l *Log) Flush() error {
+	if l.readOnly {
+		return nil
+	}
+
+	l.mu.RLock()
+	data, start, end := l.data, l.flushedSize, l.size
+	l.mu.RUnlock()
+
+	if end <= start {
+		return nil
+	}
+
+	// msync requires a page-aligned start address
+	start &^= int64(os.Getpagesize() - 1)
+	if err := unix.Msync(data[start:end], unix.MS_SYNC); err != nil {
+		return storageError("flush log", err)
+	}
+
+	l.mu.Lock()
+	if end > l.flushedSize {
+		l.flushedSize = end
+	}
+	l.mu.Unlock()
+	return nil
+}
+
+// grow extends the file and the mapping to hold at least needed bytes. The mapping is
+// resized in place when possible; otherwise a new one replaces it and the old one is
+// retired until Close. Callers must hold l.mu.
+func (l *Log) grow(needed int64) error {
+	mapped := int64(len(l.data))
+	step := min(max(mapped, logGrowMinBytes), logGrowMaxStepBytes)
+	newSize := min(l.maxBytes, max(needed, mapped+step))
+
+	if err := allocate(l.file, mapped, newSize); err != nil {
+		return err
+	}
+
+	if data, err := remapInPlace(l.data, int(newSize)); err == nil {
+		l.data = data
+		return nil
+	}
+
+	data, err := unix.Mmap(
+		int(l.file.Fd()), 0, int(newSize),
+		unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED,
+	)
+	if err != nil {
+		return err
+	}
+	l.retired = append(l.retired, l.data)
+	l.data = data
+	return nil
+}
+
+// configSize returns the mapped size, the limit for recovery scans.
 func (l *Log) configSize() int64 {
 	return int64(len(l.data))
 }
 
+// Close unmaps and closes the file. Every step runs even if an earlier one fails;
+// the failures are joined so a lost msync or trim is reported, not hidden.
 func (l *Log) Close() error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	_ = unix.Msync(l.data, unix.MS_SYNC)
-	_ = syscall.Munmap(l.data)
-	_ = l.file.Truncate(l.size) // Trim to actual data size
-	return l.file.Close()
+	if l.readOnly {
+		var errs []error
+		if l.data != nil {
+			errs = append(errs, syscall.Munmap(l.data))
+		}
+		return errors.Join(append(errs, l.file.Close())...)
+	}
+
+	errs := []error{
+		unix.Msync(l.data, unix.MS_SYNC),
+		unix.Munmap(l.data),
+	}
+	for _, data := range l.retired {
+		errs = append(errs, unix.Munmap(data))
+	}
+	l.retired = nil
+	errs = append(errs,
+		l.file.Truncate(l.size), // Trim to actual data size
+		l.file.Close(),
+	)
+	if err := errors.Join(errs...); err != nil {
+		return storageError("close log", err)
+	}
+	return nil
 }
@@ -0,0 +1,25 @@
+//go:build linux
+
+package segment
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// allocate reserves disk blocks for [from, to) and extends the file to `to`, so a full
+// disk fails the append instead of raising SIGBUS on a write through the mapping.
+func allocate(f *os.File, from, to int64) error {
+	err := unix.Fallocate(int(f.Fd()), 0, from, to-from)
+	if err == unix.EOPNOTSUPP || err == unix.ENOSYS {
+		return f.Truncate(to) // Filesystem without fallocate: fall back to a sparse extension
+	}
+	return err
+}
+
+// remapInPlace grows a mapping created with unix.Mmap without moving it, so slices
+// handed out to readers stay valid. It fails if the adjacent address space is taken.
+func remapInPlace(data []byte, size int) ([]byte, error) {
+	return unix.Mremap(data, size, 0)
+}
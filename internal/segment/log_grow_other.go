@@ -0,0 +1,18 @@
+//go:build !linux
+
+package segment
+
+import (
+	"errors"
+	"os"
+)
+
+// allocate extends the file to `to`. Blocks are not reserved without fallocate.
+func allocate(f *os.File, from, to int64) error {
+	return f.Truncate(to)
+}
+
+// remapInPlace is not available without mremap; the caller maps the file again.
+func remapInPlace(data []byte, size int) ([]byte, error) {
+	return nil, errors.ErrUnsupported
+}
@@ -0,0 +1,123 @@
+package segment
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"lightkafka/internal/message"
+)
+
+func TestLog_GrowOnDemand(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "grow.log")
+	const maxBytes = 8 * 1024 * 1024
+
+	l, err := NewLog(path, maxBytes, false)
+	if err != nil {
+		t.Fatalf("Failed to create log: %v", err)
+	}
+	if fi, _ := os.Stat(path); fi.Size() != logGrowMinBytes {
+		t.Errorf("Initial file size mismatch. Want %d, Got %d", logGrowMinBytes, fi.Size())
+	}
+
+	chunk := bytes.Repeat([]byte{0xAB}, 64*1024)
+	if _, _, err := l.Append(chunk); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	// A reader keeps a slice into the first mapping while the log grows
+	first, _ := l.ReadRaw(0, len(chunk))
+
+	for l.Size()+int64(len(chunk)) <= maxBytes {
+		if _, _, err := l.Append(chunk); err != nil {
+			t.Fatalf("Append at %d failed: %v", l.Size(), err)
+		}
+	}
+	if _, _, err := l.Append(chunk); !errors.Is(err, ErrSegmentFull) {
+		t.Errorf("Expected ErrSegmentFull at SegmentMaxBytes, got %v", err)
+	}
+	if !bytes.Equal(first, chunk) {
+		t.Errorf("Slice from before the log grew no longer holds the data")
+	}
+	if last, _ := l.ReadRaw(l.Size()-int64(len(chunk)), len(chunk)); !bytes.Equal(last, chunk) {
+		t.Errorf("Data appended after growing mismatch")
+	}
+
+	size := l.Size()
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if fi, _ := os.Stat(path); fi.Size() != size {
+		t.Errorf("File not trimmed on Close. Want %d, Got %d", size, fi.Size())
+	}
+
+	// Preallocate keeps the old behavior: the whole segment up front
+	l, err = NewLog(filepath.Join(dir, "prealloc.log"), maxBytes, true)
+	if err != nil {
+		t.Fatalf("Failed to create preallocated log: %v", err)
+	}
+	defer l.Close()
+	if fi, _ := os.Stat(filepath.Join(dir, "prealloc.log")); fi.Size() != maxBytes {
+		t.Errorf("Preallocated file size mismatch. Want %d, Got %d", maxBytes, fi.Size())
+	}
+}
+
+func TestLog_AppendFaultReturnsStorageError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fault.log")
+
+	l, err := NewLog(path, 8*1024*1024, false)
+	if err != nil {
+		t.Fatalf("Failed to create log: %v", err)
+	}
+	defer l.Close()
+
+	// Pull the pages out from under the mapping: writing to them raises SIGBUS
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatalf("Failed to truncate log file: %v", err)
+	}
+
+	if _, _, err := l.Append(bytes.Repeat([]byte{0xAB}, 4096)); !errors.Is(err, ErrStorage) {
+		t.Fatalf("Expected ErrStorage, got %v", err)
+	}
+	if l.Size() != 0 {
+		t.Errorf("Failed append must not advance the log. Got size %d", l.Size())
+	}
+}
+
+func TestSegment_ReadFaultReturnsStorageError(t *testing.T) {
+	dir := t.TempDir()
+	seg, err := NewSegment(dir, 0, Config{SegmentMaxBytes: 1024 * 1024, IndexMaxBytes: 1024, IndexIntervalBytes: 1})
+	if err != nil {
+		t.Fatalf("Failed to create segment: %v", err)
+	}
+	defer seg.Close()
+	if _, err := seg.Append(createValidBatchBytes(0, 10, []byte("payload"))); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	// Pull the pages out from under the mappings: touching them raises SIGBUS
+	for _, suffix := range []string{LogFileSuffix, IndexFileSuffix, TimeIndexFileSuffix} {
+		if err := os.Truncate(FilePath(dir, 0, suffix), 0); err != nil {
+			t.Fatalf("Failed to truncate %s: %v", suffix, err)
+		}
+	}
+
+	if _, err := seg.Read(0, 1024); !errors.Is(err, ErrStorage) {
+		t.Errorf("Read: expected ErrStorage, got %v", err)
+	}
+	if _, err := seg.ReadView(0, 1024); !errors.Is(err, ErrStorage) {
+		t.Errorf("ReadView: expected ErrStorage, got %v", err)
+	}
+	err = seg.ForEachBatch(func(*message.RecordBatch) error { return nil })
+	if !errors.Is(err, ErrStorage) {
+		t.Errorf("ForEachBatch: expected ErrStorage, got %v", err)
+	}
+	if err := seg.index.Write(10, 100); !errors.Is(err, ErrStorage) {
+		t.Errorf("Index write: expected ErrStorage, got %v", err)
+	}
+	if err := seg.timeIndex.Write(1000, 10); !errors.Is(err, ErrStorage) {
+		t.Errorf("Time index write: expected ErrStorage, got %v", err)
+	}
+}
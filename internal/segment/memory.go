@@ -0,0 +1,302 @@
+package segment
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"lightkafka/internal/message"
+)
+
+// MemoryStore is a LogStore that keeps its batches on the heap. Nothing is written
+// to disk and nothing survives Close, so it suits tests and throwaway brokers.
+//
+// Appended bytes are never modified in place: views keep pointing at the bytes they
+// were given, even after TruncateTo.
+type MemoryStore struct {
+	mu         sync.RWMutex
+	baseOffset int64
+	nextOffset int64
+
+	maxTimestamp   int64 // -1 if empty
+	firstTimestamp int64 // -1 if empty
+	modTime        int64 // Unix ms of the last change
+
+	data    []byte        // Batches back to back
+	batches []memoryBatch // One entry per batch, in offset order
+	config  Config
+
+	refs   atomic.Int32
+	closed atomic.Bool
+}
+
+// memoryBatch locates a batch in MemoryStore.data.
+type memoryBatch struct {
+	pos, size    int64
+	lastOffset   int64
+	maxTimestamp int64
+}
+
+// NewMemoryStore creates an empty store whose first record gets baseOffset.
+// SegmentMaxBytes bounds its size; the index settings do not apply.
+func NewMemoryStore(baseOffset int64, c Config) (*MemoryStore, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	m := &MemoryStore{
+		baseOffset:     baseOffset,
+		nextOffset:     baseOffset,
+		maxTimestamp:   -1,
+		firstTimestamp: -1,
+		modTime:        time.Now().UnixMilli(),
+		config:         c,
+	}
+	m.refs.Store(1)
+	return m, nil
+}
+
+func (m *MemoryStore) BaseOffset() int64 {
+	return m.baseOffset
+}
+
+func (m *MemoryStore) NextOffset() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.nextOffset
+}
+
+func (m *MemoryStore) Size() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return int64(len(m.data))
+}
+
+// ModTime returns when the store was last appended to or truncated (Unix ms).
+func (m *MemoryStore) ModTime() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.modTime
+}
+
+func (m *MemoryStore) Append(batchBytes []byte) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed.Load() {
+		return 0, ErrSegmentClosed
+	}
+
+	h, err := message.DecodeHeader(batchBytes)
+	if err != nil {
+		return 0, err
+	}
+	if int64(len(batchBytes)) != message.BATCH_LENTH_METADATA_SIZE+int64(h.BatchLength) {
+		return 0, message.ErrInsufficientData
+	}
+	if int64(len(m.data)+len(batchBytes)) > m.config.SegmentMaxBytes {
+		return 0, ErrSegmentFull
+	}
+
+	pos := int64(len(m.data))
+	m.data = append(m.data, batchBytes...)
+	m.batches = append(m.batches, memoryBatch{
+		pos:          pos,
+		size:         int64(len(batchBytes)),
+		lastOffset:   h.BaseOffset + int64(h.LastOffsetDelta),
+		maxTimestamp: h.MaxTimestamp,
+	})
+
+	if pos == 0 {
+		m.firstTimestamp = h.BaseTimestamp
+	}
+	m.maxTimestamp = max(m.maxTimestamp, h.MaxTimestamp)
+	m.nextOffset = h.BaseOffset + int64(h.LastOffsetDelta) + 1
+	m.modTime = time.Now().UnixMilli()
+
+	return h.BaseOffset, nil
+}
+
+// locate returns the index of the batch holding offset (or the first one after it).
+// Callers must hold m.mu.
+func (m *MemoryStore) locate(offset int64) (int, error) {
+	if offset < m.baseOffset || offset >= m.nextOffset {
+		return 0, ErrOffsetOutOfRange
+	}
+	i := sort.Search(len(m.batches), func(i int) bool {
+		return m.batches[i].lastOffset >= offset
+	})
+	if i == len(m.batches) {
+		return 0, ErrOffsetOutOfRange
+	}
+	return i, nil
+}
+
+func (m *MemoryStore) ReadView(offset int64, maxBytes int32) (*View, error) {
+	if !m.Acquire() {
+		return nil, ErrSegmentClosed
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i, err := m.locate(offset)
+	if err != nil {
+		m.Release()
+		return nil, err
+	}
+
+	// Same selection as Log.ReadAt: whole batches up to maxBytes, at least one
+	start := m.batches[i].pos
+	end := start + m.batches[i].size
+	for i++; i < len(m.batches) && end+m.batches[i].size-start <= int64(maxBytes); i++ {
+		end += m.batches[i].size
+	}
+
+	return &View{Data: m.data[start:end:end], store: m}, nil
+}
+
+func (m *MemoryStore) TruncateTo(offset int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if offset >= m.nextOffset {
+		return nil
+	}
+
+	keep := 0
+	if offset > m.baseOffset {
+		var err error
+		if keep, err = m.locate(offset); err != nil {
+			return err
+		}
+	}
+
+	// Copy instead of reslicing, so later appends cannot overwrite bytes a view still holds
+	var end int64
+	if keep > 0 {
+		end = m.batches[keep-1].pos + m.batches[keep-1].size
+	}
+	m.data = slices.Clone(m.data[:end])
+	m.batches = slices.Clone(m.batches[:keep])
+
+	m.nextOffset = m.baseOffset
+	m.maxTimestamp = -1
+	m.firstTimestamp = -1
+	if keep > 0 {
+		first, _ := message.DecodeHeader(m.data)
+		m.firstTimestamp = first.BaseTimestamp
+		m.nextOffset = m.batches[keep-1].lastOffset + 1
+	}
+	for _, b := range m.batches {
+		m.maxTimestamp = max(m.maxTimestamp, b.maxTimestamp)
+	}
+	m.modTime = time.Now().UnixMilli()
+	return nil
+}
+
+// Flush is a no-op: there is nothing to sync.
+func (m *MemoryStore) Flush() error {
+	return nil
+}
+
+// FlushedOffset returns NextOffset, since there is nothing left to sync.
+func (m *MemoryStore) FlushedOffset() int64 {
+	return m.NextOffset()
+}
+
+func (m *MemoryStore) FirstTimestamp() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.firstTimestamp
+}
+
+func (m *MemoryStore) MaxTimestamp() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.maxTimestamp
+}
+
+func (m *MemoryStore) OffsetForTimestamp(ts int64) (int64, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, b := range m.batches {
+		if b.maxTimestamp < ts {
+			continue
+		}
+
+		batch, err := message.DecodeBatch(m.data[b.pos : b.pos+b.size])
+		if err != nil {
+			return 0, false, err
+		}
+
+		var rec message.Record
+		it := batch.NewIterator()
+		for it.Next(&rec) {
+			if rec.Timestamp >= ts {
+				return rec.Offset, true, nil
+			}
+		}
+		if err := it.Err(); err != nil {
+			return 0, false, err
+		}
+		// MaxTimestamp qualifies but no record does (e.g. LogAppendTime batches)
+		return batch.Header.BaseOffset, true, nil
+	}
+
+	return 0, false, nil
+}
+
+func (m *MemoryStore) ForEachBatch(fn func(batch *message.RecordBatch) error) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, b := range m.batches {
+		batch, err := message.DecodeBatch(m.data[b.pos : b.pos+b.size])
+		if err != nil {
+			return err
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Acquire takes a reference on the store. It returns false once the last reference is gone.
+func (m *MemoryStore) Acquire() bool {
+	for {
+		n := m.refs.Load()
+		if n <= 0 {
+			return false
+		}
+		if m.refs.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// Release gives back a reference. The batches are dropped with the last one.
+func (m *MemoryStore) Release() error {
+	switch n := m.refs.Add(-1); {
+	case n == 0:
+		m.mu.Lock()
+		m.data = nil
+		m.batches = nil
+		m.mu.Unlock()
+	case n < 0:
+		panic("segment: Release called more times than Acquire")
+	}
+	return nil
+}
+
+// Close drops the owner's reference. Calling Close again is a no-op.
+func (m *MemoryStore) Close() error {
+	if !m.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+	return m.Release()
+}
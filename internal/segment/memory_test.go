@@ -0,0 +1,53 @@
+package segment
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store, err := NewMemoryStore(100, Config{SegmentMaxBytes: 1024, IndexMaxBytes: 1024})
+	if err != nil {
+		t.Fatalf("NewMemoryStore failed: %v", err)
+	}
+	defer store.Close()
+
+	first := createValidBatchBytes(100, 10, []byte("payload-1"))
+	store.Append(first)
+	store.Append(createValidBatchBytes(110, 10, []byte("payload-2")))
+	store.Append(createValidBatchBytes(120, 5, []byte("payload-3")))
+
+	if store.NextOffset() != 125 {
+		t.Errorf("NextOffset mismatch. Want 125, Got %d", store.NextOffset())
+	}
+
+	// maxBytes of a single batch returns exactly the batch holding the offset
+	view, err := store.ReadView(105, int32(len(first)))
+	if err != nil {
+		t.Fatalf("ReadView failed: %v", err)
+	}
+	if !bytes.Equal(view.Data, first) || view.File != nil {
+		t.Errorf("View mismatch. Len: %d, File: %v", len(view.Data), view.File)
+	}
+
+	// Truncation must not touch the bytes an outstanding view points at
+	if err := store.TruncateTo(115); err != nil {
+		t.Fatalf("TruncateTo failed: %v", err)
+	}
+	store.Append(createValidBatchBytes(110, 3, []byte("replaced")))
+	if !bytes.Equal(view.Data, first) {
+		t.Errorf("View changed by truncate and append")
+	}
+	view.Release()
+
+	if store.NextOffset() != 113 {
+		t.Errorf("NextOffset after truncate mismatch. Want 113, Got %d", store.NextOffset())
+	}
+	if _, err := store.ReadView(125, 1024); !errors.Is(err, ErrOffsetOutOfRange) {
+		t.Errorf("Expected ErrOffsetOutOfRange, got %v", err)
+	}
+	if _, err := store.Append(createValidBatchBytes(113, 1, make([]byte, 1024))); !errors.Is(err, ErrSegmentFull) {
+		t.Errorf("Expected ErrSegmentFull, got %v", err)
+	}
+}
@@ -1,9 +1,14 @@
 package segment
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"os"
 	"path/filepath"
+	"slices"
 	"sync"
+	"sync/atomic"
 
 	"lightkafka/internal/message"
 	"lightkafka/pkg"
@@ -11,36 +16,163 @@ import (
 
 type Segment struct {
 	mu         sync.RWMutex
-	BaseOffset int64
-	NextOffset int64
+	baseOffset int64
+	nextOffset int64
+
+	// maxTimestamp is the largest batch MaxTimestamp appended so far (-1 if empty).
+	maxTimestamp int64
+	// firstTimestamp is the BaseTimestamp of the first batch (-1 if empty).
+	firstTimestamp int64
+
+	// flushedOffset is the offset below which all data has been synced to disk.
+	flushedOffset     int64
+	unflushedMessages int64
+
+	log       *Log
+	index     *Index
+	timeIndex *TimeIndex
+	config    Config
+
+	// readOnly segments never modify their files (see OpenReadOnly).
+	readOnly bool
+
+	// indexRepair is set if the indexes failed validation when the segment was opened
+	// (also printed to the log).
+	indexRepair *IndexRepair
+	// truncated is set if recovery cut invalid data off the end of the log.
+	truncated bool
+
+	// refs counts the owner plus every Acquire (see handle.go).
+	refs   atomic.Int32
+	closed atomic.Bool
+}
+
+// File extensions of the files that make up a segment.
+const (
+	LogFileSuffix       = ".log"
+	IndexFileSuffix     = ".index"
+	TimeIndexFileSuffix = ".timeindex"
+)
 
-	log    *Log
-	index  *Index
-	config Config
+// FilePath returns the path of a segment file: {dir}/{baseOffset:020d}{suffix}.
+func FilePath(dir string, baseOffset int64, suffix string) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", baseOffset, suffix))
 }
 
+// RemoveFiles deletes every file of a closed segment. Missing files are ignored.
+func RemoveFiles(dir string, baseOffset int64) error {
+	for _, suffix := range []string{LogFileSuffix, IndexFileSuffix, TimeIndexFileSuffix} {
+		if err := os.Remove(FilePath(dir, baseOffset, suffix)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewSegment opens (or creates) a segment and validates the CRC of every batch,
+// truncating the log at the first invalid one.
 func NewSegment(dir string, baseOffset int64, c Config) (*Segment, error) {
-	logPath := filepath.Join(dir, fmt.Sprintf("%020d.log", baseOffset))
-	l, err := NewLog(logPath, c.SegmentMaxBytes)
+	return openSegment(dir, baseOffset, c, baseOffset)
+}
+
+// RecoverSegment opens a segment that is durable up to recoveryPoint, e.g. the active
+// segment after a crash. Like NewSegment it truncates the log at the first invalid
+// batch, but only batches holding offsets at or after recoveryPoint are CRC-checked.
+func RecoverSegment(dir string, baseOffset int64, c Config, recoveryPoint int64) (*Segment, error) {
+	return openSegment(dir, baseOffset, c, max(recoveryPoint, baseOffset))
+}
+
+// LoadSegment opens a segment whose data is known to be durable and intact
+// (below the recovery point, or after a clean shutdown). Batches after the last
+// index entry are walked by header only, without CRC validation.
+func LoadSegment(dir string, baseOffset int64, c Config) (*Segment, error) {
+	return openSegment(dir, baseOffset, c, noVerify)
+}
+
+// OpenReadOnly opens a closed segment for reading only. Files are mapped PROT_READ at
+// their actual length and are never preallocated, truncated or rewritten. A sealed
+// segment (fully durable) is trusted as-is; otherwise every batch is CRC-checked in
+// memory. Indexes that fail the sanity check are ignored, not rebuilt.
+func OpenReadOnly(dir string, baseOffset int64, c Config, sealed bool) (*Segment, error) {
+	l, err := OpenLogReadOnly(FilePath(dir, baseOffset, LogFileSuffix))
 	if err != nil {
 		return nil, err
 	}
 
-	idxPath := filepath.Join(dir, fmt.Sprintf("%020d.index", baseOffset))
-	idx, err := NewIndex(idxPath, c.IndexMaxBytes)
+	idx, err := OpenIndexReadOnly(FilePath(dir, baseOffset, IndexFileSuffix))
 	if err != nil {
 		l.Close()
 		return nil, err
 	}
 
+	timeIdx, err := OpenTimeIndexReadOnly(FilePath(dir, baseOffset, TimeIndexFileSuffix))
+	if err != nil {
+		idx.Close()
+		l.Close()
+		return nil, err
+	}
+
 	s := &Segment{
-		BaseOffset: baseOffset,
-		log:        l,
-		index:      idx,
-		config:     c,
+		baseOffset:     baseOffset,
+		maxTimestamp:   -1,
+		firstTimestamp: -1,
+		log:            l,
+		index:          idx,
+		timeIndex:      timeIdx,
+		config:         c,
+		readOnly:       true,
 	}
 
-	if err := s.recover(); err != nil {
+	s.refs.Store(1)
+
+	verifyFrom := baseOffset
+	if sealed {
+		verifyFrom = noVerify
+	}
+	if err := s.recover(verifyFrom); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func openSegment(dir string, baseOffset int64, c Config, verifyFrom int64) (*Segment, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	l, err := NewLog(FilePath(dir, baseOffset, LogFileSuffix), c.SegmentMaxBytes, c.Preallocate)
+	if err != nil {
+		return nil, storageError("open log", err)
+	}
+
+	idx, err := NewIndex(FilePath(dir, baseOffset, IndexFileSuffix), c.IndexMaxBytes)
+	if err != nil {
+		l.Close()
+		return nil, storageError("open index", err)
+	}
+
+	timeIdx, err := NewTimeIndex(FilePath(dir, baseOffset, TimeIndexFileSuffix), c.IndexMaxBytes)
+	if err != nil {
+		idx.Close()
+		l.Close()
+		return nil, storageError("open time index", err)
+	}
+
+	s := &Segment{
+		baseOffset:     baseOffset,
+		maxTimestamp:   -1,
+		firstTimestamp: -1,
+		log:            l,
+		index:          idx,
+		timeIndex:      timeIdx,
+		config:         c,
+	}
+
+	s.refs.Store(1)
+
+	if err := s.recover(verifyFrom); err != nil {
 		s.Close()
 		return nil, err
 	}
@@ -52,29 +184,110 @@ func (s *Segment) Append(batchBytes []byte) (int64, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	batch, err := message.DecodeBatch(batchBytes)
-	if err != nil {
-		return 0, err
+	if s.readOnly {
+		return 0, ErrReadOnly
 	}
 
-	n, pos, err := s.log.Append(batchBytes)
+	h, err := message.DecodeHeader(batchBytes)
 	if err != nil {
 		return 0, err
 	}
+	if int64(len(batchBytes)) != message.BATCH_LENTH_METADATA_SIZE+int64(h.BatchLength) {
+		return 0, message.ErrInsufficientData
+	}
 
 	// Sparse Indexing: Index first message or at intervals
 	// Always index the first message in the segment for quick access
-	if n > 0 && s.config.IndexIntervalBytes > 0 {
+	needIndex := false
+	if s.config.IndexIntervalBytes > 0 {
 		_, lastPos, _ := s.index.LastEntry()
-		if s.log.Size() == int64(n) || int64(pos)-int64(lastPos) >= s.config.IndexIntervalBytes {
-			relOffset := int32(batch.Header.BaseOffset - s.BaseOffset)
-			_ = s.index.Write(relOffset, int32(pos))
+		logSize := s.log.Size()
+		needIndex = logSize == 0 || logSize-lastPos >= s.config.IndexIntervalBytes
+	}
+
+	// Relative offsets are stored as int32: a batch past that range needs a new segment
+	if h.BaseOffset+int64(h.LastOffsetDelta)-s.baseOffset > math.MaxInt32 {
+		return 0, ErrSegmentFull
+	}
+
+	// A full index is a roll condition just like a full log:
+	// refuse the batch before writing anything so the caller can roll.
+	if needIndex && (s.index.IsFull() || s.timeIndex.IsFull()) {
+		return 0, ErrIndexFull
+	}
+
+	_, pos, err := s.log.Append(batchBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	if h.MaxTimestamp > s.maxTimestamp {
+		s.maxTimestamp = h.MaxTimestamp
+	}
+	if pos == 0 {
+		s.firstTimestamp = h.BaseTimestamp
+	}
+
+	if needIndex {
+		relOffset := int32(h.BaseOffset - s.baseOffset)
+		if err := s.index.Write(relOffset, pos); err != nil {
+			return 0, err
 		}
+		s.maybeWriteTimeIndex(relOffset)
 	}
 
-	curr := s.NextOffset
-	s.NextOffset += int64(batch.Header.RecordsCount)
-	return curr, nil
+	// LastOffsetDelta (not RecordsCount) covers the batch's offset range,
+	// so batches thinned out by compaction still advance NextOffset correctly.
+	s.nextOffset = h.BaseOffset + int64(h.LastOffsetDelta) + 1
+
+	// Flush Policy: flush.messages
+	s.unflushedMessages += int64(h.RecordsCount)
+	if s.config.FlushIntervalMessages > 0 && s.unflushedMessages >= s.config.FlushIntervalMessages {
+		if err := s.flushFiles(); err != nil {
+			return 0, err
+		}
+		s.flushedOffset = s.nextOffset
+		s.unflushedMessages = 0
+	}
+
+	return h.BaseOffset, nil
+}
+
+// Flush syncs the log and indexes to disk. Appends may continue while it runs;
+// only data appended before the call is guaranteed to be durable.
+func (s *Segment) Flush() error {
+	s.mu.RLock()
+	nextOffset := s.nextOffset
+	s.mu.RUnlock()
+
+	if err := s.flushFiles(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if nextOffset > s.flushedOffset {
+		s.flushedOffset = nextOffset
+		s.unflushedMessages = 0
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// FlushedOffset returns the offset below which all data is durable.
+func (s *Segment) FlushedOffset() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.flushedOffset
+}
+
+func (s *Segment) flushFiles() error {
+	if err := s.log.Flush(); err != nil {
+		return err
+	}
+	if err := s.index.Flush(); err != nil {
+		return err
+	}
+	return s.timeIndex.Flush()
 }
 
 // Read finds the exact batch and returns a chunk filled with batches.
@@ -82,15 +295,34 @@ func (s *Segment) Read(targetOffset int64, maxBytes int32) ([]byte, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	if targetOffset < s.BaseOffset || targetOffset >= s.NextOffset {
-		return nil, ErrOffsetOutOfRange
+	var data []byte
+	var err error
+	if faultErr := guardFault("read log", func() {
+		var pos int64
+		if pos, err = s.locate(targetOffset); err != nil {
+			return
+		}
+
+		// 3. Fetch Data
+		data, err = s.log.ReadAt(pos, maxBytes)
+	}); faultErr != nil {
+		return nil, faultErr
+	}
+	return data, err
+}
+
+// locate returns the log position of the batch containing targetOffset (or the
+// first batch after it). Callers must hold s.mu.
+func (s *Segment) locate(targetOffset int64) (int64, error) {
+	if targetOffset < s.baseOffset || targetOffset >= s.nextOffset {
+		return 0, ErrOffsetOutOfRange
 	}
 
 	// 1. Index Lookup
-	rel := int32(targetOffset - s.BaseOffset)
+	rel := int32(targetOffset - s.baseOffset)
 	startPos, err := s.index.Lookup(rel)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
 	// 2. Linear Scan (Correct Position)
@@ -123,44 +355,291 @@ func (s *Segment) Read(targetOffset int64, maxBytes int32) ([]byte, error) {
 	}
 
 	if !found {
-		return nil, ErrOffsetOutOfRange
+		return 0, ErrOffsetOutOfRange
 	}
 
-	// 3. Fetch Data
-	return s.log.ReadAt(currentPos, maxBytes)
+	return currentPos, nil
 }
 
-// recover rebuilds state (NextOffset, Log Size) by scanning the log and reconstructing the index.
-func (s *Segment) recover() error {
+// TruncateTo removes every batch that holds an offset >= offset. Truncation happens
+// on batch boundaries, so NextOffset may end up below offset when offset falls inside
+// a batch. The log and both indexes are cut back and the removed bytes synced away.
+func (s *Segment) TruncateTo(offset int64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	if offset >= s.nextOffset {
+		return nil
+	}
+
+	// 1. Find the first batch to drop
+	var pos int64
+	nextOffset := s.baseOffset
+	if offset > s.baseOffset {
+		var err error
+		if pos, err = s.locate(offset); err != nil {
+			return err
+		}
+		headerBytes, _ := s.log.ReadRaw(pos, message.BATCH_HEADER_SIZE)
+		header, err := message.DecodeHeader(headerBytes)
+		if err != nil {
+			return err
+		}
+		nextOffset = header.BaseOffset
+	}
+
+	// 2. Cut the indexes before the log so no entry ever points past the log end
+	relOffset := int32(nextOffset - s.baseOffset)
+	if err := s.timeIndex.TruncateTo(relOffset); err != nil {
+		return err
+	}
+	if err := s.index.TruncateTo(relOffset); err != nil {
+		return err
+	}
+	if err := s.log.TruncateTo(pos); err != nil {
+		return err
+	}
+
+	// 3. Rebuild the in-memory state from the remaining batches
+	s.nextOffset = nextOffset
+	s.flushedOffset = min(s.flushedOffset, nextOffset)
+	s.maxTimestamp = -1
+	s.firstTimestamp = -1
+	for p := int64(0); p < pos; {
+		headerBytes, _ := s.log.ReadRaw(p, message.BATCH_HEADER_SIZE)
+		header, err := message.DecodeHeader(headerBytes)
+		if err != nil {
+			return err
+		}
+		if p == 0 {
+			s.firstTimestamp = header.BaseTimestamp
+		}
+		s.maxTimestamp = max(s.maxTimestamp, header.MaxTimestamp)
+		p += 12 + int64(header.BatchLength)
+	}
+
+	return nil
+}
+
+// BaseOffset returns the offset of the segment's first record.
+func (s *Segment) BaseOffset() int64 {
+	return s.baseOffset
+}
+
+// NextOffset returns the offset the next appended record will receive.
+func (s *Segment) NextOffset() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.nextOffset
+}
+
+// Size returns the number of valid bytes in the segment's log.
+func (s *Segment) Size() int64 {
+	return s.log.Size()
+}
+
+// MaxTimestamp returns the largest batch timestamp in the segment, or -1 if it is empty.
+func (s *Segment) MaxTimestamp() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.maxTimestamp
+}
+
+// FirstTimestamp returns the BaseTimestamp of the segment's first batch, or -1 if it is empty.
+func (s *Segment) FirstTimestamp() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.firstTimestamp
+}
+
+// Truncated reports whether opening the segment cut invalid data off the end of its log.
+func (s *Segment) Truncated() bool {
+	return s.truncated
+}
+
+// OffsetForTimestamp returns the offset of the first record whose timestamp is >= ts.
+// The boolean is false if every record in the segment is older than ts.
+func (s *Segment) OffsetForTimestamp(ts int64) (int64, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var offset int64
+	var found bool
+	var err error
+	if faultErr := guardFault("look up timestamp", func() { offset, found, err = s.offsetForTimestamp(ts) }); faultErr != nil {
+		return 0, false, faultErr
+	}
+	return offset, found, err
+}
+
+// offsetForTimestamp is OffsetForTimestamp without the fault guard. Callers must hold s.mu.
+func (s *Segment) offsetForTimestamp(ts int64) (int64, bool, error) {
+	if s.maxTimestamp < ts {
+		return 0, false, nil
+	}
+
+	// 1. Time Index Lookup: every batch up to relOff is older than ts.
+	startPos := int64(0)
+	if relOff := s.timeIndex.Lookup(ts); relOff >= 0 {
+		pos, err := s.index.Lookup(relOff)
+		if err != nil {
+			return 0, false, err
+		}
+		startPos = pos
+	}
+
+	// 2. Linear Scan: find the first batch whose MaxTimestamp reaches ts
+	currentPos := startPos
+	for currentPos < s.log.Size() {
+		headerBytes, _ := s.log.ReadRaw(currentPos, message.BATCH_HEADER_SIZE)
+		if headerBytes == nil {
+			break
+		}
+
+		batchLen := int32(pkg.Encod.Uint32(headerBytes[8:12]))
+		maxTimestamp := int64(pkg.Encod.Uint64(headerBytes[35:43]))
+		totalSize := 12 + int64(batchLen)
+
+		if maxTimestamp < ts {
+			currentPos += totalSize
+			continue
+		}
+
+		// 3. Record Scan: pick the exact record inside the batch
+		batchData, _ := s.log.ReadRaw(currentPos, int(totalSize))
+		batch, err := message.DecodeBatch(batchData)
+		if err != nil {
+			return 0, false, err
+		}
+
+		var rec message.Record
+		it := batch.NewIterator()
+		for it.Next(&rec) {
+			if rec.Timestamp >= ts {
+				return rec.Offset, true, nil
+			}
+		}
+		if err := it.Err(); err != nil {
+			return 0, false, err
+		}
+		// MaxTimestamp qualifies but no record does (e.g. LogAppendTime batches)
+		return batch.Header.BaseOffset, true, nil
+	}
+
+	return 0, false, nil
+}
+
+// ForEachBatch calls fn for every batch in the segment, in offset order.
+// Batches point into the mmap region and are only valid until the segment is closed.
+func (s *Segment) ForEachBatch(fn func(batch *message.RecordBatch) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var err error
+	if faultErr := guardFault("scan log", func() { err = s.forEachBatch(fn) }); faultErr != nil {
+		return faultErr
+	}
+	return err
+}
+
+// forEachBatch is ForEachBatch without the fault guard. Callers must hold s.mu.
+func (s *Segment) forEachBatch(fn func(batch *message.RecordBatch) error) error {
+	currentPos := int64(0)
+	for currentPos < s.log.Size() {
+		lenBytes, _ := s.log.ReadRaw(currentPos, message.BATCH_LENTH_METADATA_SIZE)
+		if lenBytes == nil {
+			break
+		}
+		totalSize := message.BATCH_LENTH_METADATA_SIZE + int64(pkg.Encod.Uint32(lenBytes[8:12]))
+
+		batchData, _ := s.log.ReadRaw(currentPos, int(totalSize))
+		batch, err := message.DecodeBatch(batchData)
+		if err != nil {
+			return err
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		currentPos += totalSize
+	}
+	return nil
+}
+
+// maybeWriteTimeIndex records the current max timestamp at relOffset if it grew
+// since the last time index entry. Callers must hold s.mu.
+func (s *Segment) maybeWriteTimeIndex(relOffset int32) {
+	if s.maxTimestamp < 0 {
+		return
+	}
+	if lastTs, _, ok := s.timeIndex.LastEntry(); ok && s.maxTimestamp <= lastTs {
+		return
+	}
+	_ = s.timeIndex.Write(s.maxTimestamp, relOffset)
+}
+
+// noVerify is the verifyFrom of segments that are durable as a whole: recovery reads
+// only batch headers.
+const noVerify = math.MaxInt64
+
+// recover rebuilds state (NextOffset, Log Size) by scanning the log from an index entry
+// and reconstructing the index after it. Every batch holding an offset at or after
+// verifyFrom is CRC-checked; the scan starts at the last index entry before verifyFrom
+// so that none of them is skipped.
+func (s *Segment) recover(verifyFrom int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	if faultErr := guardFault("recover segment", func() { err = s.recoverLocked(verifyFrom) }); faultErr != nil {
+		return faultErr
+	}
+	return err
+}
+
+// recoverLocked is recover without the lock and the fault guard. Callers must hold s.mu.
+func (s *Segment) recoverLocked(verifyFrom int64) error {
 	s.log.SetSize(s.log.configSize())
 
-	// 1. Index file integrity check (Sanity Check)
-	validIndex := true
-	lastIdxOff, lastIdxPos, err := s.index.LastEntry()
-	if err != nil || int64(lastIdxPos) > s.log.Size() {
-		validIndex = false
+	// 1. Index file integrity check: every entry must agree with the log. Sealed
+	// read-only segments are opened on every cache miss; their indexes were checked
+	// when they were written, so only the last entry is sanity-checked.
+	var repair *IndexRepair
+	if s.readOnly && verifyFrom == noVerify {
+		repair = s.checkLastIndexEntry(s.log.Size())
+	} else {
+		repair = s.checkIndexes(s.log.Size())
 	}
 
 	// 2. Determine recovery starting position
+	var startOff int32
 	var currentPos int64 = 0
-	if validIndex && lastIdxPos > 0 {
-		currentPos = int64(lastIdxPos)
+	if repair == nil {
+		startOff, currentPos = s.scanStart(verifyFrom)
+	}
+	if currentPos > 0 {
+		if lastTs, _, ok := s.timeIndex.LastEntry(); ok {
+			s.maxTimestamp = lastTs
+		}
 	} else {
 		if err := s.index.Truncate(0); err != nil {
 			return err
 		}
+		if err := s.timeIndex.Truncate(0); err != nil {
+			return err
+		}
 	}
 
 	// 3. Log scanning
-	var lastNextOffset int64 = s.BaseOffset
+	var lastNextOffset int64 = s.baseOffset
 
 	var lastIndexedPos int64 = -1
 	// If we started from a valid index position, set it as last indexed
-	if validIndex && lastIdxPos > 0 {
-		lastIndexedPos = int64(lastIdxPos)
-		lastNextOffset = s.BaseOffset + int64(lastIdxOff)
+	if currentPos > 0 {
+		lastIndexedPos = currentPos
+		lastNextOffset = s.baseOffset + int64(startOff)
 	}
 
 	for currentPos < s.log.configSize() {
@@ -179,15 +658,20 @@ func (s *Segment) recover() error {
 		totalBatchSize := 12 + int64(batchLen)
 
 		batchData, err := s.log.ReadRaw(currentPos, int(totalBatchSize))
-		if err != nil {
+		if err != nil || batchData == nil {
 			break
 		}
 
-		batch, err := message.DecodeBatch(batchData)
+		header, err := message.DecodeHeader(batchData)
 		if err != nil {
-			// CRC mismatch or format error - this is the end of valid data
 			break
 		}
+		if header.BaseOffset+int64(header.LastOffsetDelta) >= verifyFrom {
+			if _, err := message.DecodeBatch(batchData); err != nil {
+				// CRC mismatch or format error - this is the end of valid data
+				break
+			}
+		}
 
 		// Sparse indexing: index first batch or when interval exceeded
 		// Always index the first batch for quick segment access
@@ -201,38 +685,98 @@ func (s *Segment) recover() error {
 			}
 		}
 
+		if header.MaxTimestamp > s.maxTimestamp {
+			s.maxTimestamp = header.MaxTimestamp
+		}
 		if reachedIndexThreshold {
-			relOffset := int32(batch.Header.BaseOffset - s.BaseOffset)
-			if err := s.index.Write(relOffset, int32(currentPos)); err != nil {
+			relOffset := int32(header.BaseOffset - s.baseOffset)
+			err := s.index.Write(relOffset, currentPos)
+			if err != nil && err != ErrIndexFull && err != ErrReadOnly {
 				return err
 			}
-			lastIndexedPos = currentPos
+			// A full index (e.g. IndexMaxBytes was lowered) or a read-only one
+			// only degrades lookups of the tail
+			if err == nil {
+				s.maybeWriteTimeIndex(relOffset)
+				lastIndexedPos = currentPos
+			}
 		}
 
-		lastNextOffset = batch.Header.BaseOffset + int64(batch.Header.RecordsCount)
+		lastNextOffset = header.BaseOffset + int64(header.LastOffsetDelta) + 1
 		currentPos += totalBatchSize
 	}
 
 	// 4. Truncate log to valid size
-	// Remove invalid data (partially written data, zero-filled regions)
+	// Remove invalid data (partially written data, zero-filled regions). Only the
+	// former is lost data: a zero-filled tail is unused preallocated space.
+	if tail, _ := s.log.ReadRaw(currentPos, int(min(s.log.configSize()-currentPos, 12))); len(tail) > 0 {
+		s.truncated = slices.ContainsFunc(tail, func(b byte) bool { return b != 0 })
+	}
 	s.log.SetSize(currentPos)
-	s.NextOffset = lastNextOffset
+	s.nextOffset = lastNextOffset
+	s.flushedOffset = lastNextOffset // Recovered data came from disk
+
+	// The scan may have resumed mid-segment: take the first timestamp from the first batch
+	if headerBytes, _ := s.log.ReadRaw(0, message.BATCH_HEADER_SIZE); headerBytes != nil {
+		s.firstTimestamp = int64(pkg.Encod.Uint64(headerBytes[27:35]))
+	}
 
-	indexEntries := int64(0)
-	if s.index.size > 0 {
-		indexEntries = s.index.size / 8
+	indexEntries := s.index.entryCount()
+	if repair != nil {
+		repair.EntriesAfter = indexEntries
+		s.indexRepair = repair
+		fmt.Printf("Repaired index of %s\n", repair)
 	}
 
-	fmt.Printf("Recovered Segment %d: NextOffset=%d, ValidBytes=%d, IndexEntries=%d\n",
-		s.BaseOffset, s.NextOffset, currentPos, indexEntries)
+	fmt.Printf("Recovered Segment %d: NextOffset=%d, ValidBytes=%d, IndexEntries=%d, Verified=%v\n",
+		s.baseOffset, s.nextOffset, currentPos, indexEntries, verifyFrom != noVerify)
 
 	return nil
 }
 
+// scanStart returns the index entry recovery resumes from: the last one at or before
+// verifyFrom. The entries after it are dropped, the scan writes them again.
+// Callers must hold s.mu.
+func (s *Segment) scanStart(verifyFrom int64) (int32, int64) {
+	n := s.index.entryCount()
+	for n > 0 {
+		if off, _ := s.index.entry(n - 1); s.baseOffset+int64(off) <= verifyFrom {
+			break
+		}
+		n--
+	}
+	if n == 0 {
+		return 0, 0
+	}
+	off, pos := s.index.entry(n - 1)
+
+	m := s.timeIndex.entryCount()
+	for m > 0 {
+		if _, timeOff := s.timeIndex.entry(m - 1); timeOff <= off {
+			break
+		}
+		m--
+	}
+	s.index.Truncate(int64(n) * entryWidth)
+	s.timeIndex.Truncate(int64(m) * timeEntryWidth)
+	return off, pos
+}
+
+// Close drops the owner's reference. The files stay mapped until every reader
+// that acquired the segment has released it. Calling Close again is a no-op.
 func (s *Segment) Close() error {
+	if !s.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+	return s.Release()
+}
+
+func (s *Segment) closeFiles() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	_ = s.index.Close()
-	_ = s.log.Close()
-	return nil
+	return errors.Join(
+		s.timeIndex.Close(),
+		s.index.Close(),
+		s.log.Close(),
+	)
 }
@@ -0,0 +1,197 @@
+package segment
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"lightkafka/internal/message"
+)
+
+func TestIndex_PositionsBeyond2GiB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "00000000000000000000.index")
+
+	idx, err := NewIndex(path, 1024)
+	if err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	positions := []int64{0, 3 << 30, 5 << 30} // Past the old int32 limit
+	for i, pos := range positions {
+		if err := idx.Write(int32(i*10), pos); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	idx.Close()
+
+	// Reopen: entries survive the trim and are read back as 64-bit positions
+	idx, err = NewIndex(path, 1024)
+	if err != nil {
+		t.Fatalf("Failed to reopen index: %v", err)
+	}
+	defer idx.Close()
+
+	for i, pos := range positions {
+		if got, _ := idx.Lookup(int32(i*10 + 5)); got != pos {
+			t.Errorf("Lookup(%d) mismatch. Want %d, Got %d", i*10+5, pos, got)
+		}
+	}
+	if off, pos, _ := idx.LastEntry(); off != 20 || pos != 5<<30 {
+		t.Errorf("LastEntry mismatch. Got (%d, %d)", off, pos)
+	}
+}
+
+func TestSegment_LegacyIndexRebuilt(t *testing.T) {
+	dir := t.TempDir()
+	cfg := Config{
+		SegmentMaxBytes:    1024 * 1024,
+		IndexMaxBytes:      1024 * 1024,
+		IndexIntervalBytes: 10,
+	}
+
+	seg, err := NewSegment(dir, 0, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create segment: %v", err)
+	}
+	seg.Append(createValidBatchBytes(0, 10, []byte("payload-1")))
+	seg.Append(createValidBatchBytes(10, 10, []byte("payload-2")))
+	secondPos, _ := seg.index.Lookup(10)
+	seg.Close()
+
+	// Replace the index with the legacy headerless format: (0, 0), (10, secondPos)
+	legacy := make([]byte, 16)
+	binary.BigEndian.PutUint32(legacy[8:], 10)
+	binary.BigEndian.PutUint32(legacy[12:], uint32(secondPos))
+	if err := os.WriteFile(FilePath(dir, 0, IndexFileSuffix), legacy, 0644); err != nil {
+		t.Fatalf("Failed to write legacy index: %v", err)
+	}
+
+	seg, err = NewSegment(dir, 0, cfg)
+	if err != nil {
+		t.Fatalf("Failed to reopen segment: %v", err)
+	}
+	defer seg.Close()
+
+	if seg.NextOffset() != 20 {
+		t.Errorf("NextOffset mismatch. Want 20, Got %d", seg.NextOffset())
+	}
+	if pos, _ := seg.index.Lookup(10); pos != secondPos {
+		t.Errorf("Rebuilt index mismatch. Want %d, Got %d", secondPos, pos)
+	}
+}
+
+func TestNewSegment_InvalidConfig(t *testing.T) {
+	for name, cfg := range map[string]Config{
+		"zero segment size": {SegmentMaxBytes: 0, IndexMaxBytes: 1024},
+		"index too small":   {SegmentMaxBytes: 1024, IndexMaxBytes: 4},
+		"negative interval": {SegmentMaxBytes: 1024, IndexMaxBytes: 1024, IndexIntervalBytes: -1},
+	} {
+		if _, err := NewSegment(t.TempDir(), 0, cfg); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: expected ErrInvalidConfig, got %v", name, err)
+		}
+	}
+}
+
+func TestSegment_CorruptIndexRebuilt(t *testing.T) {
+	cfg := Config{
+		SegmentMaxBytes:    1024 * 1024,
+		IndexMaxBytes:      1024,
+		IndexIntervalBytes: 1, // Index every batch
+	}
+
+	for name, tc := range map[string]struct {
+		suffix  string
+		corrupt func(data []byte)
+		entry   int
+	}{
+		"position mid-batch": {IndexFileSuffix, func(data []byte) {
+			pos := binary.BigEndian.Uint64(data[indexHeaderSize+entryWidth+4:])
+			binary.BigEndian.PutUint64(data[indexHeaderSize+entryWidth+4:], pos+1)
+		}, 1},
+		"offsets out of order": {IndexFileSuffix, func(data []byte) {
+			binary.BigEndian.PutUint32(data[indexHeaderSize+2*entryWidth:], 5)
+		}, 2},
+		"time entry off the offset index": {TimeIndexFileSuffix, func(data []byte) {
+			binary.BigEndian.PutUint32(data[timeEntryWidth+8:], 15)
+		}, 1},
+	} {
+		dir := t.TempDir()
+		seg, err := NewSegment(dir, 0, cfg)
+		if err != nil {
+			t.Fatalf("%s: failed to create segment: %v", name, err)
+		}
+		for i := int64(0); i < 4; i++ {
+			// Real records: OffsetForTimestamp scans them
+			var records []byte
+			for d := range int32(10) {
+				records = message.AppendRecord(records, &message.Record{OffsetDelta: d, Value: []byte("payload")})
+			}
+			batch := message.EncodeBatch(message.BatchHeader{
+				BaseOffset:      i * 10,
+				LastOffsetDelta: 9,
+				BaseTimestamp:   1000 + i,
+				MaxTimestamp:    1000 + i,
+				RecordsCount:    10,
+			}, records)
+			if _, err := seg.Append(batch); err != nil {
+				t.Fatalf("%s: append failed: %v", name, err)
+			}
+		}
+		positions := make([]int64, 4)
+		for i := range positions {
+			positions[i], _ = seg.index.Lookup(int32(i * 10))
+		}
+		seg.Close()
+
+		path := FilePath(dir, 0, tc.suffix)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("%s: failed to read index: %v", name, err)
+		}
+		tc.corrupt(data)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("%s: failed to write index: %v", name, err)
+		}
+
+		// Sealed read-only opens (every cache miss) only sanity-check the last entry
+		for _, sealed := range []bool{true, false} {
+			ro, err := OpenReadOnly(dir, 0, cfg, sealed)
+			if err != nil {
+				t.Fatalf("%s: failed to open read-only: %v", name, err)
+			}
+			if detected := ro.indexRepair != nil; detected == sealed {
+				t.Errorf("%s: read-only open (sealed: %v) detected corruption: %v", name, sealed, detected)
+			}
+			ro.Close()
+		}
+
+		seg, err = NewSegment(dir, 0, cfg)
+		if err != nil {
+			t.Fatalf("%s: failed to reopen segment: %v", name, err)
+		}
+		repair := seg.indexRepair
+		if repair == nil {
+			t.Fatalf("%s: corruption not detected", name)
+		}
+		if repair.File != tc.suffix || repair.Entry != tc.entry || repair.EntriesAfter != 4 {
+			t.Errorf("%s: unexpected report: %s", name, repair)
+		}
+		for i, want := range positions {
+			if pos, _ := seg.index.Lookup(int32(i * 10)); pos != want {
+				t.Errorf("%s: Lookup(%d) after rebuild. Want %d, Got %d", name, i*10, want, pos)
+			}
+		}
+		if off, _, _ := seg.OffsetForTimestamp(1002); off != 20 {
+			t.Errorf("%s: OffsetForTimestamp after rebuild. Want 20, Got %d", name, off)
+		}
+		seg.Close()
+
+		// The rebuilt indexes pass validation
+		seg, _ = NewSegment(dir, 0, cfg)
+		if repair := seg.indexRepair; repair != nil {
+			t.Errorf("%s: rebuilt index failed validation: %s", name, repair)
+		}
+		seg.Close()
+	}
+}
@@ -0,0 +1,63 @@
+package segment
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestSegment_OpenReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	cfg := Config{
+		SegmentMaxBytes:    1024 * 1024,
+		IndexMaxBytes:      1024 * 1024,
+		IndexIntervalBytes: 10,
+	}
+
+	seg, err := NewSegment(dir, 0, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create segment: %v", err)
+	}
+	seg.Append(createValidBatchBytes(0, 10, []byte("payload-1")))
+	seg.Append(createValidBatchBytes(10, 10, []byte("payload-2")))
+	seg.Close()
+
+	sizes := make(map[string]int64)
+	for _, suffix := range []string{LogFileSuffix, IndexFileSuffix, TimeIndexFileSuffix} {
+		fi, err := os.Stat(FilePath(dir, 0, suffix))
+		if err != nil {
+			t.Fatalf("Stat %s: %v", suffix, err)
+		}
+		sizes[suffix] = fi.Size()
+	}
+
+	ro, err := OpenReadOnly(dir, 0, cfg, false)
+	if err != nil {
+		t.Fatalf("OpenReadOnly failed: %v", err)
+	}
+
+	if ro.NextOffset() != 20 {
+		t.Errorf("Expected NextOffset 20, got %d", ro.NextOffset())
+	}
+	if _, err := ro.Append(createValidBatchBytes(20, 1, []byte("x"))); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly, got %v", err)
+	}
+	data, err := ro.Read(10, 1024)
+	if err != nil || len(data) == 0 {
+		t.Fatalf("Read from read-only segment failed: %v", err)
+	}
+	if err := ro.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Opening read-only must never preallocate or trim the files
+	for suffix, want := range sizes {
+		fi, err := os.Stat(FilePath(dir, 0, suffix))
+		if err != nil {
+			t.Fatalf("Stat %s: %v", suffix, err)
+		}
+		if fi.Size() != want {
+			t.Errorf("%s size changed: %d -> %d", suffix, want, fi.Size())
+		}
+	}
+}
@@ -74,8 +74,8 @@ func TestSegment_Recovery_RebuildIndex(t *testing.T) {
 	seg.Append(createValidBatchBytes(20, 5, []byte("payload-3")))
 
 	expectedNextOffset := int64(25)
-	if seg.NextOffset != expectedNextOffset {
-		t.Errorf("Expected NextOffset %d, got %d", expectedNextOffset, seg.NextOffset)
+	if seg.NextOffset() != expectedNextOffset {
+		t.Errorf("Expected NextOffset %d, got %d", expectedNextOffset, seg.NextOffset())
 	}
 	seg.Close()
 
@@ -94,8 +94,8 @@ func TestSegment_Recovery_RebuildIndex(t *testing.T) {
 
 	// 5. Verify
 	// Check NextOffset recovery
-	if recoveredSeg.NextOffset != expectedNextOffset {
-		t.Errorf("Recovered NextOffset mismatch. Want %d, Got %d", expectedNextOffset, recoveredSeg.NextOffset)
+	if recoveredSeg.NextOffset() != expectedNextOffset {
+		t.Errorf("Recovered NextOffset mismatch. Want %d, Got %d", expectedNextOffset, recoveredSeg.NextOffset())
 	}
 
 	// Check Index regeneration (Lookup test)
@@ -155,7 +155,57 @@ func TestSegment_Recovery_TruncateCorruptLog(t *testing.T) {
 	}
 
 	// NextOffset should be correct (100 + 5 = 105)
-	if recoveredSeg.NextOffset != 105 {
-		t.Errorf("NextOffset mismatch. Expected 105, Got %d", recoveredSeg.NextOffset)
+	if recoveredSeg.NextOffset() != 105 {
+		t.Errorf("NextOffset mismatch. Expected 105, Got %d", recoveredSeg.NextOffset())
+	}
+}
+
+func TestSegment_Recovery_VerifiesFromRecoveryPoint(t *testing.T) {
+	dir := t.TempDir()
+	cfg := Config{
+		SegmentMaxBytes:    1024 * 1024,
+		IndexMaxBytes:      1024 * 1024,
+		IndexIntervalBytes: 1, // Index every batch
+	}
+
+	seg, err := NewSegment(dir, 0, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create segment: %v", err)
+	}
+	seg.Append(createValidBatchBytes(0, 10, []byte("payload-1")))
+	seg.Append(createValidBatchBytes(10, 10, []byte("payload-2")))
+	seg.Append(createValidBatchBytes(20, 5, []byte("payload-3")))
+	seg.Close()
+
+	// Sabotage: flip a payload byte of the middle batch, behind the last index entry
+	f, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf("%020d.log", 0)), os.O_WRONLY, 0666)
+	if err != nil {
+		t.Fatalf("Failed to open log for corruption: %v", err)
+	}
+	if _, err := f.WriteAt([]byte{'X'}, 70+61); err != nil {
+		t.Fatalf("Failed to corrupt log: %v", err)
+	}
+	f.Close()
+
+	tests := []struct {
+		name          string
+		recoveryPoint int64
+		wantNext      int64
+	}{
+		{"durable past the corruption", 20, 25},
+		{"corruption after the recovery point", 10, 10},
+	}
+	for _, tt := range tests {
+		recovered, err := RecoverSegment(dir, 0, cfg, tt.recoveryPoint)
+		if err != nil {
+			t.Fatalf("%s: Failed to recover segment: %v", tt.name, err)
+		}
+		if recovered.NextOffset() != tt.wantNext {
+			t.Errorf("%s: NextOffset mismatch. Want %d, Got %d", tt.name, tt.wantNext, recovered.NextOffset())
+		}
+		if _, err := recovered.Read(tt.wantNext-1, 1024); err != nil {
+			t.Errorf("%s: Read(%d) failed: %v", tt.name, tt.wantNext-1, err)
+		}
+		recovered.Close()
 	}
 }
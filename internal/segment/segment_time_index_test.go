@@ -0,0 +1,108 @@
+package segment
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+)
+
+// createTimedBatchBytes generates a valid batch whose records all carry the timestamp ts.
+func createTimedBatchBytes(baseOffset int64, recordsCount int32, ts int64) []byte {
+	var records []byte
+	var varBuf [binary.MaxVarintLen64]byte
+	for i := int32(0); i < recordsCount; i++ {
+		var body []byte
+		body = append(body, 0)                                                 // Attributes
+		body = append(body, varBuf[:binary.PutVarint(varBuf[:], 0)]...)        // TimestampDelta
+		body = append(body, varBuf[:binary.PutVarint(varBuf[:], int64(i))]...) // OffsetDelta
+		body = append(body, varBuf[:binary.PutVarint(varBuf[:], -1)]...)       // Key (null)
+		body = append(body, varBuf[:binary.PutVarint(varBuf[:], 1)]...)        // Value Length
+		body = append(body, 'v')                                               // Value
+		body = append(body, varBuf[:binary.PutVarint(varBuf[:], 0)]...)        // Headers Count
+
+		records = append(records, varBuf[:binary.PutVarint(varBuf[:], int64(len(body)))]...)
+		records = append(records, body...)
+	}
+
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.BigEndian, baseOffset)
+	binary.Write(buf, binary.BigEndian, int32(49+len(records)))
+	binary.Write(buf, binary.BigEndian, int32(0))
+	binary.Write(buf, binary.BigEndian, int8(2))
+
+	crcBuf := new(bytes.Buffer)
+	binary.Write(crcBuf, binary.BigEndian, int16(0))
+	binary.Write(crcBuf, binary.BigEndian, recordsCount-1)
+	binary.Write(crcBuf, binary.BigEndian, ts)
+	binary.Write(crcBuf, binary.BigEndian, ts)
+	binary.Write(crcBuf, binary.BigEndian, int64(-1))
+	binary.Write(crcBuf, binary.BigEndian, int16(-1))
+	binary.Write(crcBuf, binary.BigEndian, int32(-1))
+	binary.Write(crcBuf, binary.BigEndian, recordsCount)
+	crcBuf.Write(records)
+
+	binary.Write(buf, binary.BigEndian, crc32.Checksum(crcBuf.Bytes(), crc32.MakeTable(crc32.Castagnoli)))
+	buf.Write(crcBuf.Bytes())
+
+	return buf.Bytes()
+}
+
+func TestSegment_OffsetForTimestamp(t *testing.T) {
+	dir := t.TempDir()
+	cfg := Config{
+		SegmentMaxBytes:    1024 * 1024,
+		IndexMaxBytes:      1024 * 1024,
+		IndexIntervalBytes: 10, // Index every batch
+	}
+
+	seg, err := NewSegment(dir, 0, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create segment: %v", err)
+	}
+
+	// Offsets 0~4 @1000, 5~9 @2000, 10~14 @3000
+	seg.Append(createTimedBatchBytes(0, 5, 1000))
+	seg.Append(createTimedBatchBytes(5, 5, 2000))
+	seg.Append(createTimedBatchBytes(10, 5, 3000))
+
+	cases := []struct {
+		ts     int64
+		offset int64
+		found  bool
+	}{
+		{ts: 0, offset: 0, found: true},
+		{ts: 1000, offset: 0, found: true},
+		{ts: 1500, offset: 5, found: true},
+		{ts: 3000, offset: 10, found: true},
+		{ts: 3001, found: false},
+	}
+
+	check := func(s *Segment) {
+		t.Helper()
+		for _, tc := range cases {
+			offset, found, err := s.OffsetForTimestamp(tc.ts)
+			if err != nil {
+				t.Fatalf("OffsetForTimestamp(%d) failed: %v", tc.ts, err)
+			}
+			if found != tc.found || (found && offset != tc.offset) {
+				t.Errorf("OffsetForTimestamp(%d) = (%d, %v), want (%d, %v)", tc.ts, offset, found, tc.offset, tc.found)
+			}
+		}
+	}
+
+	check(seg)
+	seg.Close()
+
+	// The time index must be rebuilt on recovery
+	recoveredSeg, err := NewSegment(dir, 0, cfg)
+	if err != nil {
+		t.Fatalf("Failed to recover segment: %v", err)
+	}
+	defer recoveredSeg.Close()
+
+	if recoveredSeg.MaxTimestamp() != 3000 {
+		t.Errorf("Recovered MaxTimestamp mismatch. Want 3000, Got %d", recoveredSeg.MaxTimestamp())
+	}
+	check(recoveredSeg)
+}
@@ -0,0 +1,48 @@
+package segment
+
+import "testing"
+
+func TestSegment_TruncateTo(t *testing.T) {
+	dir := t.TempDir()
+	cfg := Config{
+		SegmentMaxBytes:    1024 * 1024,
+		IndexMaxBytes:      1024 * 1024,
+		IndexIntervalBytes: 10, // Index every batch
+	}
+
+	seg, err := NewSegment(dir, 0, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create segment: %v", err)
+	}
+	seg.Append(createValidBatchBytes(0, 10, []byte("payload-1")))
+	firstSize := seg.Size()
+	seg.Append(createValidBatchBytes(10, 10, []byte("payload-2")))
+	seg.Append(createValidBatchBytes(20, 5, []byte("payload-3")))
+
+	// 15 is inside batch [10, 19]: truncation stops at its start
+	if err := seg.TruncateTo(15); err != nil {
+		t.Fatalf("TruncateTo failed: %v", err)
+	}
+	if seg.NextOffset() != 10 || seg.Size() != firstSize {
+		t.Errorf("After truncate: NextOffset %d (want 10), Size %d (want %d)", seg.NextOffset(), seg.Size(), firstSize)
+	}
+	if _, err := seg.Read(10, 1024); err != ErrOffsetOutOfRange {
+		t.Errorf("Read of truncated offset should be out of range, got %v", err)
+	}
+
+	// Simulate a crash: seg is never closed, so its files are not trimmed and
+	// recovery must not find the old batches in the preallocated tail.
+
+	recovered, err := NewSegment(dir, 0, cfg)
+	if err != nil {
+		t.Fatalf("Failed to reopen segment: %v", err)
+	}
+	defer recovered.Close()
+
+	if recovered.NextOffset() != 10 {
+		t.Errorf("Recovered NextOffset mismatch. Want 10, Got %d", recovered.NextOffset())
+	}
+	if _, err := recovered.Append(createValidBatchBytes(10, 1, []byte("payload-4"))); err != nil {
+		t.Errorf("Append after truncate failed: %v", err)
+	}
+}
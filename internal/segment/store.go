@@ -0,0 +1,43 @@
+package segment
+
+import "lightkafka/internal/message"
+
+// LogStore is the storage behind one segment of a partition's log. The partition only
+// reaches its segments through this interface, so the mmap'ed Segment can be swapped
+// for another engine such as MemoryStore.
+//
+// Stores are reference counted like Segment (see handle.go): the owner gives its
+// reference up with Close, everyone else pairs Acquire with Release.
+type LogStore interface {
+	BaseOffset() int64
+	NextOffset() int64
+	// Size returns the number of bytes of batches held by the store.
+	Size() int64
+
+	// Append adds a batch whose BaseOffset is already assigned. It fails with
+	// ErrSegmentFull or ErrIndexFull when the partition should roll. Only the header
+	// is decoded: callers pass batches they validated (CRC included) or built.
+	Append(batchBytes []byte) (int64, error)
+	// ReadView returns the batches from the one holding offset, up to maxBytes
+	// (at least one batch). The view pins the store until it is released.
+	ReadView(offset int64, maxBytes int32) (*View, error)
+	// TruncateTo removes every batch that holds an offset >= offset.
+	TruncateTo(offset int64) error
+
+	Flush() error
+	FlushedOffset() int64
+
+	FirstTimestamp() int64
+	MaxTimestamp() int64
+	OffsetForTimestamp(ts int64) (int64, bool, error)
+	ForEachBatch(fn func(batch *message.RecordBatch) error) error
+
+	Acquire() bool
+	Release() error
+	Close() error
+}
+
+var (
+	_ LogStore = (*Segment)(nil)
+	_ LogStore = (*MemoryStore)(nil)
+)
@@ -0,0 +1,257 @@
+package segment
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const timeEntryWidth = 12 // Timestamp(8) + RelativeOffset(4)
+
+// TimeIndex maps the largest timestamp seen so far to the relative offset of the
+// batch at which it was observed. Entries are strictly increasing in timestamp.
+type TimeIndex struct {
+	mu   sync.RWMutex
+	file *os.File
+	data []byte // mmap
+	size int64  // used bytes
+
+	readOnly bool
+}
+
+// OpenTimeIndexReadOnly maps an existing time index file read-only. A missing file yields an
+// empty time index, so lookups fall back to scanning the log.
+func OpenTimeIndexReadOnly(path string) (*TimeIndex, error) {
+	f, data, err := mmapReadOnly(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &TimeIndex{readOnly: true}, nil
+		}
+		return nil, err
+	}
+
+	size := int64(len(data)) / timeEntryWidth * timeEntryWidth
+	for size > 0 && isZero(data[size-timeEntryWidth:size]) {
+		size -= timeEntryWidth
+	}
+
+	return &TimeIndex{file: f, data: data, size: size, readOnly: true}, nil
+}
+
+func NewTimeIndex(path string, maxBytes int64) (*TimeIndex, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// Entries written before the last Close (the file was trimmed to its used size)
+	size := min(fi.Size(), maxBytes) / timeEntryWidth * timeEntryWidth
+
+	// Pre-allocation with real blocks: entries are written through the mapping
+	if err := allocate(f, 0, maxBytes); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	data, err := syscall.Mmap(
+		int(f.Fd()), 0, int(maxBytes),
+		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED,
+	)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// After a crash the file was never trimmed: drop the zero-filled tail.
+	for size > 0 && isZero(data[size-timeEntryWidth:size]) {
+		size -= timeEntryWidth
+	}
+
+	return &TimeIndex{file: f, data: data, size: size}, nil
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Write appends (Timestamp, RelativeOffset).
+func (t *TimeIndex) Write(ts int64, off int32) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.readOnly {
+		return ErrReadOnly
+	}
+	if t.size+timeEntryWidth > int64(len(t.data)) {
+		return ErrIndexFull
+	}
+
+	if err := guardFault("write time index", func() {
+		binary.BigEndian.PutUint64(t.data[t.size:], uint64(ts))
+		binary.BigEndian.PutUint32(t.data[t.size+8:], uint32(off))
+	}); err != nil {
+		return err
+	}
+	t.size += timeEntryWidth
+	return nil
+}
+
+// IsFull reports whether another entry would exceed IndexMaxBytes.
+func (t *TimeIndex) IsFull() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.size+timeEntryWidth > int64(len(t.data))
+}
+
+// Lookup returns the relative offset of the last entry whose timestamp is
+// strictly smaller than ts. Every batch up to and including that offset is
+// older than ts, so a scan can safely start there. Returns -1 if no entry qualifies.
+func (t *TimeIndex) Lookup(ts int64) int32 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var outOff int32 = -1
+	entries := int(t.size / timeEntryWidth)
+	low, high := 0, entries-1
+
+	for low <= high {
+		mid := (low + high) / 2
+		entryPos := mid * timeEntryWidth
+
+		midTs := int64(binary.BigEndian.Uint64(t.data[entryPos:]))
+		midOff := int32(binary.BigEndian.Uint32(t.data[entryPos+8:]))
+
+		if midTs < ts {
+			outOff = midOff
+			low = mid + 1
+		} else {
+			high = mid - 1
+		}
+	}
+
+	return outOff
+}
+
+// entryCount returns the number of entries.
+func (t *TimeIndex) entryCount() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return int(t.size / timeEntryWidth)
+}
+
+// entry returns the n-th entry.
+func (t *TimeIndex) entry(n int) (ts int64, off int32) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	at := int64(n) * timeEntryWidth
+	ts = int64(binary.BigEndian.Uint64(t.data[at : at+8]))
+	off = int32(binary.BigEndian.Uint32(t.data[at+8 : at+timeEntryWidth]))
+	return ts, off
+}
+
+/* Last Entry */
+func (t *TimeIndex) LastEntry() (ts int64, off int32, ok bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.size == 0 {
+		return -1, 0, false
+	}
+
+	last := t.size - timeEntryWidth
+	ts = int64(binary.BigEndian.Uint64(t.data[last : last+8]))
+	off = int32(binary.BigEndian.Uint32(t.data[last+8 : last+12]))
+	return ts, off, true
+}
+
+/* Truncate */
+func (t *TimeIndex) Truncate(size int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if size > int64(len(t.data)) {
+		return io.ErrShortBuffer
+	}
+
+	t.size = size
+	return nil
+}
+
+// TruncateTo drops every entry whose relative offset is >= relOff.
+// The dropped entries are zeroed so that they are not reloaded after a crash.
+func (t *TimeIndex) TruncateTo(relOff int32) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.readOnly {
+		return ErrReadOnly
+	}
+
+	size := t.size
+	for size > 0 && int32(binary.BigEndian.Uint32(t.data[size-timeEntryWidth+8:])) >= relOff {
+		size -= timeEntryWidth
+	}
+	if size == t.size {
+		return nil
+	}
+
+	if err := zeroAndSync(t.data, size, t.size); err != nil {
+		return err
+	}
+	t.size = size
+	return nil
+}
+
+// Flush msyncs the used part of the index.
+func (t *TimeIndex) Flush() error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.size == 0 || t.readOnly {
+		return nil
+	}
+	if err := unix.Msync(t.data[:t.size], unix.MS_SYNC); err != nil {
+		return storageError("flush time index", err)
+	}
+	return nil
+}
+
+func (t *TimeIndex) Close() error {
+	if t.readOnly {
+		if t.file == nil {
+			return nil
+		}
+		var errs []error
+		if t.data != nil {
+			errs = append(errs, syscall.Munmap(t.data))
+		}
+		return errors.Join(append(errs, t.file.Close())...)
+	}
+
+	err := errors.Join(
+		syscall.Munmap(t.data),
+		t.file.Truncate(t.size), // Trim to actual size
+		t.file.Close(),
+	)
+	if err != nil {
+		return storageError("close time index", err)
+	}
+	return nil
+}